@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Palette holds the colors of the unlit and lit pixels of the screen
+type Palette struct {
+	Off, On sdl.Color
+}
+
+// Palettes to pick from with -palette. The colorblind one is the blue and
+// orange of the Okabe-Ito set, which stay apart under every common color
+// vision deficiency, and like the others it differs a lot in brightness too.
+var palettes = map[string]Palette{
+	"default":       {Off: sdl.Color{R: 0, G: 0, B: 0, A: 255}, On: sdl.Color{R: 255, G: 255, B: 255, A: 255}},
+	"high-contrast": {Off: sdl.Color{R: 0, G: 0, B: 0, A: 255}, On: sdl.Color{R: 255, G: 255, B: 0, A: 255}},
+	"inverse":       {Off: sdl.Color{R: 255, G: 255, B: 255, A: 255}, On: sdl.Color{R: 0, G: 0, B: 0, A: 255}},
+	"colorblind":    {Off: sdl.Color{R: 0, G: 40, B: 90, A: 255}, On: sdl.Color{R: 230, G: 159, B: 0, A: 255}},
+}
+
+// Colors of the screen, set by -palette
+var palette = palettes["default"]
+
+// parsePalette returns the palette called name
+func parsePalette(name string) (Palette, error) {
+	p, ok := palettes[name]
+	if !ok {
+		var names []string
+		for name := range palettes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Palette{}, fmt.Errorf("unknown palette %q, want one of %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// mix returns the color of a pixel lit by level, from 0 (off) to 1 (on), as ARGB
+func (p Palette) mix(level float64) uint32 {
+	channel := func(off, on uint8) uint32 {
+		return uint32(math.Round(float64(off) + (float64(on)-float64(off))*level))
+	}
+	return 0xFF000000 | channel(p.Off.R, p.On.R)<<16 | channel(p.Off.G, p.On.G)<<8 | channel(p.Off.B, p.On.B)
+}
+
+// With -reduce-flashes a frame that changes more than flashArea of the screen
+// is a flash, and only one is shown every flashInterval: no more than three a
+// second, the limit of the guidelines on photosensitive seizures. The frames
+// in between are held back until the interval is over.
+const (
+	flashArea     = 0.5
+	flashInterval = time.Second / 3
+)
+
+// Menu text can be scaled up to this much with -text-scale, beyond that the
+// settings at the bottom of the menu don't fit next to the ROM preview
+const (
+	minTextScale = 1.0
+	maxTextScale = 1.25
+)
+
+// limitFlashes returns the pixels to show in place of a frame's, those of the
+// last frame shown if the frame would flash again too soon
+func (s *ScreenRenderer) limitFlashes(pixels []uint8) []uint8 {
+	changed := 0
+	for i, pixel := range pixels {
+		if pixel != s.shown[i] {
+			changed++
+		}
+	}
+	if float64(changed) > flashArea*float64(len(pixels)) {
+		if time.Since(s.lastFlash) < flashInterval {
+			return s.shown
+		}
+		s.lastFlash = time.Now()
+	}
+	copy(s.shown, pixels)
+	return pixels
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"image/png"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/petersid2022/chip8/cmd"
+)
+
+// How long a request waits for the emulation loop, there is none while the menu is shown
+const apiWait = 5 * time.Second
+
+var errNotRunning = errors.New("no ROM is running")
+
+// apiRequest is work the HTTP server hands to the emulation loop, which owns the machine
+type apiRequest struct {
+	run  func(s *apiSession) error
+	done chan error
+}
+
+// Requests from the HTTP server waiting for the emulation loop
+var apiRequests = make(chan apiRequest)
+
+// apiSession is what the HTTP API controls of a running ROM
+type apiSession struct {
+	inst *Instance
+}
+
+// serve runs the requests the HTTP server queued since the last cycle
+func (s *apiSession) serve() {
+	for {
+		select {
+		case req := <-apiRequests:
+			req.done <- req.run(s)
+		default:
+			return
+		}
+	}
+}
+
+// onLoop runs fn on the emulation loop and waits for it to finish
+func onLoop(fn func(s *apiSession) error) error {
+	req := apiRequest{run: fn, done: make(chan error, 1)}
+	select {
+	case apiRequests <- req:
+		return <-req.done
+	case <-time.After(apiWait):
+		return errNotRunning
+	}
+}
+
+// apiError reports err to the client, with a status depending on what went wrong
+func apiError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if err == errNotRunning {
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// only rejects requests that don't use method
+func only(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// startAPI serves the control API on addr in the background:
+//
+//	POST /load?rom=NAME        run a ROM from the roms directory
+//	POST /pause, POST /resume  stop and continue the emulation
+//	GET  /screenshot?scale=N   the screen as a PNG, N pixels per CHIP-8 pixel
+//	GET  /screenshot?format=F  the screen as text art, F being text (# and .) or blocks
+//	GET  /state                the machine state as JSON
+//	GET  /dump?format=F        the whole machine state as a report (text) or JSON
+//	POST /key?key=K&down=BOOL  press or release key K (0-F) of the keypad
+//	GET  /debug/pprof/         profiles of the emulator, for go tool pprof
+//	GET  /debug/vars           counters of the emulation loop as JSON
+func startAPI(addr string) error {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	mux.HandleFunc("/load", only(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		rom := r.URL.Query().Get("rom")
+		if rom == "" || filepath.Base(rom) != rom {
+			apiError(w, fmt.Errorf("invalid rom %q, want the name of a file in the roms directory", rom))
+			return
+		}
+		err := onLoop(func(s *apiSession) error {
+			if s.inst.Net != nil {
+				return errors.New("can't load a ROM during netplay")
+			}
+			return s.inst.Load(rom)
+		})
+		if err != nil {
+			apiError(w, err)
+		}
+	}))
+
+	setPaused := func(paused bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			err := onLoop(func(s *apiSession) error {
+				if s.inst.Net != nil {
+					return errors.New("can't pause during netplay")
+				}
+				s.inst.Paused, s.inst.breakAt = paused, nil
+				return nil
+			})
+			if err != nil {
+				apiError(w, err)
+			}
+		}
+	}
+	mux.HandleFunc("/pause", only(http.MethodPost, setPaused(true)))
+	mux.HandleFunc("/resume", only(http.MethodPost, setPaused(false)))
+
+	mux.HandleFunc("/screenshot", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "png"
+		}
+		if format != "png" && format != "text" && format != "blocks" {
+			apiError(w, fmt.Errorf("invalid format %q, want png, text or blocks", format))
+			return
+		}
+		scale := 1
+		if v := r.URL.Query().Get("scale"); v != "" {
+			var err error
+			if scale, err = strconv.Atoi(v); err != nil || scale < 1 || scale > maxScale {
+				apiError(w, fmt.Errorf("invalid scale %q", v))
+				return
+			}
+		}
+
+		var frame Frame
+		err := onLoop(func(s *apiSession) error {
+			frame = cpuFrame(&s.inst.CPU)
+			frame.Pixels = append([]byte(nil), frame.Pixels...)
+			return nil
+		})
+		if err != nil {
+			apiError(w, err)
+			return
+		}
+
+		switch format {
+		case "png":
+			w.Header().Set("Content-Type", "image/png")
+			png.Encode(w, frameImage(frame, scale))
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, frameText(frame, format == "blocks"))
+		}
+	}))
+
+	mux.HandleFunc("/state", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		var state chip8.State
+		var rom string
+		var paused bool
+		err := onLoop(func(s *apiSession) error {
+			state, rom, paused = s.inst.CPU.SaveState(), s.inst.Name, s.inst.Paused
+			return nil
+		})
+		if err != nil {
+			apiError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Rom    string
+			Paused bool
+			chip8.State
+		}{rom, paused, state})
+	}))
+
+	mux.HandleFunc("/dump", only(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "text"
+		}
+		if format != "text" && format != "json" {
+			apiError(w, fmt.Errorf("invalid format %q, want text or json", format))
+			return
+		}
+		var d MachineDump
+		err := onLoop(func(s *apiSession) error {
+			d = s.inst.dump()
+			return nil
+		})
+		if err != nil {
+			apiError(w, err)
+			return
+		}
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			d.WriteJSON(w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		d.WriteReport(w)
+	}))
+
+	mux.HandleFunc("/key", only(http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		key, err := strconv.ParseUint(r.URL.Query().Get("key"), 16, 8)
+		if err != nil || key > 0xF {
+			apiError(w, fmt.Errorf("invalid key %q, want 0-F", r.URL.Query().Get("key")))
+			return
+		}
+		down, err := strconv.ParseBool(r.URL.Query().Get("down"))
+		if err != nil {
+			apiError(w, fmt.Errorf("invalid down %q", r.URL.Query().Get("down")))
+			return
+		}
+		err = onLoop(func(s *apiSession) error {
+			s.inst.Keys[key] = down
+			return nil
+		})
+		if err != nil {
+			apiError(w, err)
+		}
+	}))
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Control API listening", "addr", ln.Addr())
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			slog.Error("Control API stopped", "err", err)
+		}
+	}()
+	return nil
+}
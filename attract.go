@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand"
+	"path/filepath"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// The menu left alone for -attract seconds plays a random bundled ROM behind
+// itself. It runs this many instructions a frame, switches to another ROM
+// after attractLength milliseconds and holds a random key for a moment every
+// second, since most games wait for one.
+const (
+	attractIPF    = 10
+	attractLength = 30000
+	attractKeyOn  = 10 // frames
+	attractKeyAt  = 60 // frames
+)
+
+// Attract is the ROM playing behind the idle menu
+type Attract struct {
+	cpu     *chip8.CPU
+	clock   chip8.ManualClock
+	started uint32
+	frames  int
+	key     int
+}
+
+// start plays a random ROM out of those bundled, paths being those of the menu
+func (a *Attract) start(paths []string) {
+	var bundled []string
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			bundled = append(bundled, path)
+		}
+	}
+	if len(bundled) == 0 {
+		return
+	}
+	name := bundled[rand.Intn(len(bundled))]
+	data, err := readRomFile(name)
+	if err != nil {
+		slog.Warn("Failed to read the attract mode ROM", "rom", name, "err", err)
+		return
+	}
+
+	a.clock = chip8.ManualClock{}
+	cpu := &chip8.CPU{MemorySize: memorySize, LoadAt: loadAddress, Hires: machine == "hires", Font: fontData, Clock: &a.clock, Quirks: quirks}
+	cpu.Init()
+	if err := cpu.LoadRomData(data); err != nil {
+		slog.Warn("Failed to load the attract mode ROM", "rom", name, "err", err)
+		return
+	}
+	a.cpu, a.started, a.frames = cpu, sdl.GetTicks(), 0
+}
+
+// stop goes back to the plain menu
+func (a *Attract) stop() {
+	a.cpu = nil
+}
+
+// running reports whether a ROM plays behind the menu
+func (a *Attract) running() bool {
+	return a.cpu != nil
+}
+
+// draw runs a frame of the ROM and draws its screen dimmed over the whole
+// menu, the menu goes on top. Once the ROM played long enough or stopped,
+// another one starts.
+func (a *Attract) draw(renderer *sdl.Renderer, paths []string) {
+	if sdl.GetTicks()-a.started > attractLength {
+		a.start(paths)
+	}
+
+	var keys [16]bool
+	if a.frames%attractKeyAt == 0 {
+		a.key = rand.Intn(len(keys))
+	}
+	keys[a.key] = a.frames%attractKeyAt < attractKeyOn
+	a.cpu.SetKeys(keys)
+	a.clock.Advance(1)
+	a.frames++
+	for i := 0; i < attractIPF; i++ {
+		if err := a.cpu.EmulateCycle(); err != nil {
+			a.start(paths)
+			return
+		}
+	}
+
+	drawDisplay(renderer, cpuFrame(a.cpu), sdl.Rect{X: 0, Y: 0, W: winWidth, H: winHeight})
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	renderer.SetDrawColor(0, 0, 0, 192)
+	renderer.FillRect(&sdl.Rect{X: 0, Y: 0, W: winWidth, H: winHeight})
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+}
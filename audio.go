@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// The buzzer is a square wave of this pitch, in Hz, at this amplitude out
+// of 32767 at full -volume
+const (
+	beepFrequency = 440
+	beepAmplitude = 12000
+)
+
+// How much the volume keys change the -volume, in percent
+const volumeStep = 10
+
+// The sample rate and the buffer of the audio device asked for by default,
+// set with -audio-rate and -audio-buffer. The buffer is in samples, a power
+// of two between the limits. Smaller buffers make the beep follow the
+// sound timer closer, but can stutter on slow systems.
+const (
+	defaultAudioRate   = 44100
+	defaultAudioBuffer = 512
+	minAudioBuffer     = 64
+	maxAudioBuffer     = 8192
+)
+
+// How many buffers of samples are kept queued while the buzzer sounds, the
+// device plays one while the next waits
+const beepQueued = 2
+
+// How long the beep takes to rise and to fall by default, in milliseconds,
+// set with -beep-ramp. A square wave starting or stopping at full swing
+// pops the speaker.
+const (
+	defaultBeepRamp = 5
+	maxBeepRamp     = 50
+)
+
+// Beeper sounds the buzzer while the sound timer of the machine runs. The
+// samples are queued every turn of the emulation loop, a nil Beeper is
+// silent.
+type Beeper struct {
+	dev  sdl.AudioDeviceID
+	spec sdl.AudioSpec // what the device was opened with
+
+	// Samples into the square wave, for it to go on where the last batch stopped
+	phase int
+	on    bool
+
+	// How far into the rise of the beep the last sample queued was, 0 to 1
+	level float64
+}
+
+// The beeper of the window, nil if the audio device couldn't be opened
+var beeper *Beeper
+
+// openBeeper opens the default audio device with the -audio-rate and
+// -audio-buffer asked for, the device may pick another rate
+func openBeeper() (*Beeper, error) {
+	want := sdl.AudioSpec{Freq: int32(audioRate), Format: sdl.AUDIO_S16SYS, Channels: 1, Samples: uint16(audioBuffer)}
+	b := &Beeper{}
+	dev, err := sdl.OpenAudioDevice("", false, &want, &b.spec, sdl.AUDIO_ALLOW_FREQUENCY_CHANGE)
+	if err != nil {
+		return nil, err
+	}
+	b.dev = dev
+	sdl.PauseAudioDevice(dev, false)
+	slog.Info("Audio", "rate", b.spec.Freq, "buffer", b.spec.Samples, "latency_ms", b.Latency())
+	return b, nil
+}
+
+// Close closes the audio device
+func (b *Beeper) Close() {
+	if b != nil {
+		sdl.CloseAudioDevice(b.dev)
+	}
+}
+
+// Latency returns how long a beep takes to be heard once the sound timer
+// starts, in milliseconds: the queued buffers and the one the device plays
+func (b *Beeper) Latency() float64 {
+	if b == nil || b.spec.Freq == 0 {
+		return 0
+	}
+	return float64((beepQueued+1)*int(b.spec.Samples)) * 1000 / float64(b.spec.Freq)
+}
+
+// String describes the device for the input latency HUD
+func (b *Beeper) String() string {
+	return fmt.Sprintf("%d Hz, %d samples", b.spec.Freq, b.spec.Samples)
+}
+
+// Update sounds the buzzer while on, it tops up the queued samples. Once
+// off the queue is dropped so the beep ends with the sound timer, and the
+// wave fades out over -beep-ramp from where the device was playing.
+func (b *Beeper) Update(on bool) {
+	if b == nil {
+		return
+	}
+	half := max(int(b.spec.Freq)/beepFrequency/2, 1)
+	ramp := beepRamp * float64(b.spec.Freq) / 1000
+
+	if !on || muted || volume == 0 {
+		if !b.on {
+			return
+		}
+		queued := int(sdl.GetQueuedAudioSize(b.dev)) / 2
+		sdl.ClearQueuedAudio(b.dev)
+		b.on = false
+		if ramp < 1 {
+			b.level = 0
+			return
+		}
+		b.phase = ((b.phase-queued)%(2*half) + 2*half) % (2 * half)
+		b.queue(int(ramp), half, func() float64 {
+			b.level = max(b.level-1/ramp, 0)
+			return b.level
+		})
+		return
+	}
+	if !b.on {
+		b.on, b.level = true, 0
+	}
+
+	queued := int(sdl.GetQueuedAudioSize(b.dev)) / 2
+	if n := beepQueued*int(b.spec.Samples) - queued; n > 0 {
+		// Without a ramp 1/ramp is infinite, the beep starts at full swing
+		b.queue(n, half, func() float64 {
+			b.level = min(b.level+1/ramp, 1)
+			return b.level
+		})
+	}
+}
+
+// queue queues n samples of the square wave, half a period long each way,
+// with the amplitude scaled by what envelope returns for every sample
+func (b *Beeper) queue(n, half int, envelope func() float64) {
+	data := make([]byte, 2*n)
+	for i := 0; i < n; i++ {
+		v := int16(beepAmplitude * float64(volume) / 100 * envelope())
+		if (b.phase/half)%2 == 1 {
+			v = -v
+		}
+		b.phase = (b.phase + 1) % (2 * half)
+		binary.NativeEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	if err := sdl.QueueAudio(b.dev, data); err != nil {
+		slog.Error("Failed to queue audio", "err", err)
+	}
+}
+
+// toggleMute mutes or unmutes the sound, for the next runs too
+func toggleMute() {
+	muted = !muted
+	if muted {
+		notify("Sound muted")
+	} else {
+		notify("Sound on, volume %d%%", volume)
+	}
+	if err := saveSetting(flag.CommandLine, "mute"); err != nil {
+		slog.Error("Failed to save the mute setting", "err", err)
+	}
+}
+
+// changeVolume turns the volume up or down by delta percent and unmutes,
+// for the next runs too
+func changeVolume(delta int) {
+	volume, muted = min(max(volume+delta, 0), 100), false
+	notify("Volume: %d%%", volume)
+	for _, name := range []string{"volume", "mute"} {
+		if err := saveSetting(flag.CommandLine, name); err != nil {
+			slog.Error("Failed to save the volume", "err", err)
+		}
+	}
+}
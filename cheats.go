@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Cheat kinds. A freeze keeps rewriting its bytes so the game can't change
+// them, a patch changes the program once when it is enabled.
+const (
+	cheatFreeze = "freeze"
+	cheatPatch  = "patch"
+)
+
+type Cheat struct {
+	Name    string
+	Kind    string
+	Addr    int
+	Bytes   []byte
+	Enabled bool
+
+	// What a patch overwrote, put back when it is disabled
+	original []byte
+}
+
+func (c *Cheat) String() string {
+	return fmt.Sprintf("%s %03X %X", c.Kind, c.Addr, c.Bytes)
+}
+
+// Cheats is the list of cheats of a ROM, it runs as a script of the machine
+type Cheats struct {
+	hash string
+	list []*Cheat
+}
+
+func cheatsPath(hash string) (string, error) {
+	dir, err := stateDir(hash)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cheats.txt"), nil
+}
+
+// readCheats reads the cheat file of a ROM. Every line is
+//
+//	[-]<freeze|patch> <address> <hex bytes> [name]
+//
+// with addresses in hex. A leading "-" disables the cheat, "#" starts a comment.
+func readCheats(hash string) ([]*Cheat, error) {
+	path, err := cheatsPath(hash)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var cheats []*Cheat
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		cheat, err := parseCheat(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		cheats = append(cheats, cheat)
+	}
+	return cheats, scanner.Err()
+}
+
+func parseCheat(text string) (*Cheat, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("want <freeze|patch> <address> <bytes> [name], got %q", text)
+	}
+
+	cheat := &Cheat{Kind: fields[0], Enabled: true}
+	if strings.HasPrefix(cheat.Kind, "-") {
+		cheat.Kind, cheat.Enabled = cheat.Kind[1:], false
+	}
+	if cheat.Kind != cheatFreeze && cheat.Kind != cheatPatch {
+		return nil, fmt.Errorf("unknown cheat kind %q", cheat.Kind)
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "0x"), 16, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q", fields[1])
+	}
+	cheat.Addr = int(addr)
+
+	if cheat.Bytes, err = hex.DecodeString(fields[2]); err != nil || len(cheat.Bytes) == 0 {
+		return nil, fmt.Errorf("invalid bytes %q", fields[2])
+	}
+
+	cheat.Name = strings.Join(fields[3:], " ")
+	if cheat.Name == "" {
+		cheat.Name = cheat.String()
+	}
+	return cheat, nil
+}
+
+// writeCheats stores the cheats of a ROM, keeping which ones are enabled
+func writeCheats(hash string, cheats []*Cheat) error {
+	path, err := cheatsPath(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	for _, c := range cheats {
+		if !c.Enabled {
+			b.WriteString("-")
+		}
+		fmt.Fprintf(&b, "%s %s\n", c, c.Name)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// Toggle enables or disables a cheat, a patch is applied or undone right away
+func (c *Cheat) Toggle(cpu *chip8.CPU) {
+	c.Enabled = !c.Enabled
+	if c.Kind != cheatPatch {
+		return
+	}
+	if c.Enabled {
+		c.apply(cpu)
+	} else {
+		for i, b := range c.original {
+			cpu.Memory[(c.Addr+i)%len(cpu.Memory)] = b
+		}
+	}
+}
+
+// apply writes the bytes of the cheat, remembering those of a patch overwrote
+func (c *Cheat) apply(cpu *chip8.CPU) {
+	if c.Kind == cheatPatch {
+		c.original = c.original[:0]
+	}
+	for i, b := range c.Bytes {
+		addr := (c.Addr + i) % len(cpu.Memory)
+		if c.Kind == cheatPatch {
+			c.original = append(c.original, cpu.Memory[addr])
+		}
+		cpu.Memory[addr] = b
+	}
+}
+
+// Add appends a cheat to the list and saves it
+func (c *Cheats) Add(cpu *chip8.CPU, cheat *Cheat) {
+	c.list = append(c.list, cheat)
+	if cheat.Enabled {
+		cheat.apply(cpu)
+	}
+	if err := writeCheats(c.hash, c.list); err != nil {
+		slog.Error("Failed to save cheats", "err", err)
+	}
+}
+
+func (c *Cheats) Frame(ctx *ScriptContext) {}
+
+// Instruction keeps the frozen addresses at their values
+func (c *Cheats) Instruction(ctx *ScriptContext, pc, opcode uint16) {
+	for _, cheat := range c.list {
+		if cheat.Enabled && cheat.Kind == cheatFreeze {
+			cheat.apply(ctx.cpu)
+		}
+	}
+}
+
+// loadCheats reads the cheats of the ROM the machine runs and applies its patches
+func (inst *Instance) loadCheats() {
+	list, err := readCheats(inst.Hash)
+	if err != nil {
+		slog.Error("Failed to read cheats", "rom", inst.Name, "err", err)
+	}
+	if deterministic {
+		list = nil
+	}
+	if inst.cheats == nil {
+		inst.cheats = &Cheats{}
+		inst.AddScript(inst.cheats)
+	}
+	inst.cheats.hash, inst.cheats.list = inst.Hash, list
+	for _, cheat := range list {
+		if cheat.Enabled && cheat.Kind == cheatPatch {
+			cheat.apply(&inst.CPU)
+		}
+	}
+}
+
+// showCheatMenu lists the cheats of a machine and lets the player toggle them
+func showCheatMenu(renderer *sdl.Renderer, texts *TextCache, inst *Instance) {
+	// Lay out in menu coordinates whatever the window size
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	cheats := inst.cheats
+	selected := 0
+	lineHeight := int32(fontSize) + 8
+
+	draw := func(text string, x, y int32) {
+		if _, _, err := texts.Draw(text, white, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				switch t.Keysym.Sym {
+				case sdl.K_ESCAPE, sdl.K_F6:
+					return
+				case sdl.K_UP:
+					if selected > 0 {
+						selected--
+					}
+				case sdl.K_DOWN:
+					if selected < len(cheats.list)-1 {
+						selected++
+					}
+				case sdl.K_RETURN, sdl.K_SPACE:
+					if selected < len(cheats.list) {
+						cheats.list[selected].Toggle(&inst.CPU)
+						if err := writeCheats(cheats.hash, cheats.list); err != nil {
+							slog.Error("Failed to save cheats", "err", err)
+						}
+					}
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		draw(tr("Cheats"), 32, 32)
+		if len(cheats.list) == 0 {
+			path, _ := cheatsPath(cheats.hash)
+			draw(tr("No cheats for this ROM, add them to"), 32, 32+2*lineHeight)
+			draw(path, 32, 32+3*lineHeight)
+		}
+
+		// Scroll so the selected cheat stays on screen
+		visible := int((winHeight - 32 - 4*lineHeight) / lineHeight)
+		first := 0
+		if selected >= visible {
+			first = selected - visible + 1
+		}
+		for i := first; i < len(cheats.list) && i < first+visible; i++ {
+			cheat := cheats.list[i]
+			y := 32 + int32(i-first+2)*lineHeight
+			if i == selected {
+				renderer.SetDrawColor(64, 64, 64, 255)
+				renderer.FillRect(&sdl.Rect{X: 24, Y: y - 4, W: winWidth - 48, H: lineHeight})
+			}
+			box := "[ ]"
+			if cheat.Enabled {
+				box = "[x]"
+			}
+			draw(fmt.Sprintf("%s %s (%s)", box, cheat.Name, cheat), 32, y)
+		}
+
+		draw(tr("<Up>/<Down> to choose, <Enter> to toggle, <Escape> to close"), 32, winHeight-int32(fontSize)-16)
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
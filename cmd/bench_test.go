@@ -0,0 +1,102 @@
+package chip8
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Small programs exercising one kind of instruction each, they loop forever
+var benchPrograms = []struct {
+	name    string
+	program []uint16
+}{
+	// Arithmetic and logic on registers
+	{"alu", []uint16{
+		0x6001, // 200: V0 = 1
+		0x6102, // 202: V1 = 2
+		0x8014, // 204: V0 += V1
+		0x8015, // 206: V0 -= V1
+		0x8012, // 208: V0 &= V1
+		0x8013, // 20A: V0 ^= V1
+		0x801E, // 20C: V0 <<= 1
+		0x1204, // 20E: jump 204
+	}},
+	// Sprite drawing
+	{"draw", []uint16{
+		0x6000, // 200: V0 = 0
+		0xA000, // 202: I = font of 0
+		0xD015, // 204: draw 5 rows at (V0, V1)
+		0x7001, // 206: V0 += 1
+		0x1204, // 208: jump 204
+	}},
+	// Loads and stores
+	{"memory", []uint16{
+		0xA300, // 200: I = 300
+		0xF355, // 202: store V0-V3
+		0xF365, // 204: load V0-V3
+		0xF033, // 206: store BCD of V0
+		0xF01E, // 208: I += V0
+		0x1202, // 20A: jump 202
+	}},
+}
+
+// benchCycles runs cpu for b.N instructions and reports how many it ran per second
+func benchCycles(b *testing.B, cpu *CPU) {
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cpu.EmulateCycle(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+}
+
+// BenchmarkPrograms runs every program bare and with every hook installed,
+// to measure their overhead
+func BenchmarkPrograms(b *testing.B) {
+	for _, p := range benchPrograms {
+		for _, hooks := range []bool{false, true} {
+			name := p.name
+			if hooks {
+				name += "+hooks"
+			}
+			b.Run(name, func(b *testing.B) {
+				cpu, _ := newTestCPU(Quirks{})
+				loadProgram(cpu, p.program...)
+				if hooks {
+					cpu.Hooks = Hooks{
+						BeforeExecute: func(pc, opcode uint16) {},
+						AfterExecute:  func(pc, opcode uint16) {},
+						OnDraw:        func() {},
+						OnSound:       func() {},
+					}
+				}
+				benchCycles(b, cpu)
+			})
+		}
+	}
+}
+
+// BenchmarkRoms runs the ROMs bundled with the frontend
+func BenchmarkRoms(b *testing.B) {
+	paths, err := filepath.Glob(filepath.Join("..", "roms", "*"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, path := range paths {
+		if filepath.Ext(path) == ".json" {
+			continue
+		}
+		b.Run(filepath.Base(path), func(b *testing.B) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			cpu, _ := newTestCPU(Quirks{})
+			cpu.OnInvalid = InvalidIgnore
+			copy(cpu.Memory[LoadAddress:], data)
+			benchCycles(b, cpu)
+		})
+	}
+}
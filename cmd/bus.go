@@ -0,0 +1,27 @@
+package chip8
+
+// Bus is what the instructions reach memory through. Addresses come in
+// wrapped around the size of Memory and already checked in strict mode, a
+// bus maps them onto banks or devices as the variant needs.
+type Bus interface {
+	Read8(addr int) uint8
+	Write8(addr int, value uint8)
+	// Read16 reads the big-endian word at addr, like an opcode
+	Read16(addr int) uint16
+}
+
+// RAM is the plain memory of a CHIP-8, the bus a CPU without one uses.
+// Read16 wraps around the end of the memory.
+type RAM []uint8
+
+func (m RAM) Read8(addr int) uint8 {
+	return m[addr]
+}
+
+func (m RAM) Write8(addr int, value uint8) {
+	m[addr] = value
+}
+
+func (m RAM) Read16(addr int) uint16 {
+	return uint16(m[addr])<<8 | uint16(m[(addr+1)%len(m)])
+}
@@ -0,0 +1,70 @@
+package chip8
+
+import "log/slog"
+
+// Clock drives the delay and sound timers, which count down at 60 Hz. Ticks
+// returns how many 1/60 s ticks passed since some fixed point, EmulateCycle
+// applies the ones elapsed since the last cycle.
+type Clock interface {
+	Ticks() uint64
+}
+
+// ManualClock is a Clock that only moves when told to. Frontends advance it
+// as time passes while the machine runs, tests advance it by exact amounts.
+type ManualClock struct {
+	ticks uint64
+}
+
+func (c *ManualClock) Ticks() uint64 {
+	return c.ticks
+}
+
+// Advance moves the clock n ticks forward
+func (c *ManualClock) Advance(n uint64) {
+	c.ticks += n
+}
+
+// DelayTimer returns the delay timer, set by FX15 and read by FX07
+func (cpu *CPU) DelayTimer() uint8 {
+	return cpu.Delay_timer
+}
+
+// SoundTimer returns the sound timer, the buzzer sounds while it is nonzero
+func (cpu *CPU) SoundTimer() uint8 {
+	return cpu.Sound_timer
+}
+
+// Tick counts both timers down once, as if 1/60 s passed, and ticks the
+// peripherals. The OnSound hook is called when the sound timer runs out.
+func (cpu *CPU) Tick() {
+	for _, p := range cpu.peripherals {
+		p.Tick(cpu)
+	}
+
+	if cpu.Delay_timer > 0 {
+		cpu.Delay_timer = cpu.Delay_timer - 1
+	}
+
+	if cpu.Sound_timer > 0 {
+		cpu.Sound_timer = cpu.Sound_timer - 1
+		if cpu.Sound_timer == 0 {
+			slog.Debug("BEEP!")
+			if cpu.Hooks.OnSound != nil {
+				cpu.Hooks.OnSound()
+			}
+		}
+	}
+}
+
+// updateTimers ticks the timers for the time that passed on the clock, or
+// once per cycle without one.
+func (cpu *CPU) updateTimers() {
+	ticks := uint64(1)
+	if cpu.Clock != nil {
+		now := cpu.Clock.Ticks()
+		ticks, cpu.lastTick = now-cpu.lastTick, now
+	}
+	for ; ticks > 0 && (cpu.Delay_timer > 0 || cpu.Sound_timer > 0 || len(cpu.peripherals) > 0); ticks-- {
+		cpu.Tick()
+	}
+}
@@ -0,0 +1,146 @@
+package chip8
+
+import "testing"
+
+// ticksOf returns n ticks of a clock moving one tick per instruction, 60
+// of them being a second
+func ticksOf(n int) []uint64 {
+	ticks := make([]uint64, n)
+	for i := range ticks {
+		ticks[i] = 1
+	}
+	return ticks
+}
+
+// A timerTest sets the timers of a machine with FX15 and FX18, then runs an
+// FX07 for every entry of ticks after moving the clock that many ticks on.
+// Timers count down at the end of the instruction the ticks passed before,
+// the last FX07 runs within the tick, so VX reads what the delay timer is.
+var timerTests = []struct {
+	name           string
+	dt, st         uint8
+	ticks          []uint64
+	wantDT, wantST uint8
+	sounds         int // times the sound timer ran out
+}{
+	{name: "within a tick", dt: 10, st: 10, ticks: []uint64{0, 0, 0},
+		wantDT: 10, wantST: 10},
+	{name: "a tick", dt: 10, st: 10, ticks: []uint64{1},
+		wantDT: 9, wantST: 9},
+	{name: "a tick per instruction", dt: 10, st: 10, ticks: ticksOf(3),
+		wantDT: 7, wantST: 7},
+	{name: "several instructions per tick", dt: 10, st: 10, ticks: []uint64{0, 1, 0, 0, 1, 0, 0, 0, 1},
+		wantDT: 7, wantST: 7},
+	{name: "ticks caught up at once", dt: 10, st: 10, ticks: []uint64{4},
+		wantDT: 6, wantST: 6},
+	{name: "a second at 60 Hz", dt: 0xFF, st: 60, ticks: ticksOf(60),
+		wantDT: 0xFF - 60, wantST: 0, sounds: 1},
+	{name: "stopping at zero", dt: 3, st: 2, ticks: []uint64{5},
+		wantDT: 0, wantST: 0, sounds: 1},
+	{name: "sound timer of 1", st: 1, ticks: []uint64{1},
+		wantST: 0, sounds: 1},
+	{name: "sound timer running out over ticks", st: 5, ticks: ticksOf(8),
+		wantST: 0, sounds: 1},
+	{name: "sound timer running out in a catch up", st: 5, ticks: []uint64{2, 6},
+		wantST: 0, sounds: 1},
+	{name: "timers of zero", ticks: []uint64{1, 3},
+		wantDT: 0, wantST: 0},
+}
+
+func TestTimers(t *testing.T) {
+	for _, tc := range timerTests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpu, clock := newTestCPU(Quirks{})
+			sounds := 0
+			cpu.Hooks.OnSound = func() { sounds++ }
+
+			program := []uint16{0x6000 | uint16(tc.dt), 0xF015, 0x6000 | uint16(tc.st), 0xF018}
+			for range tc.ticks {
+				program = append(program, 0xF107)
+			}
+			loadProgram(cpu, append(program, 0xF107)...)
+			step := func() {
+				if err := cpu.EmulateCycle(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 4; i++ {
+				step()
+			}
+			for _, n := range tc.ticks {
+				clock.Advance(n)
+				step()
+			}
+			step()
+
+			if cpu.DelayTimer() != tc.wantDT || cpu.SoundTimer() != tc.wantST {
+				t.Errorf("DT %d ST %d, want DT %d ST %d", cpu.DelayTimer(), cpu.SoundTimer(), tc.wantDT, tc.wantST)
+			}
+			if cpu.V[1] != tc.wantDT {
+				t.Errorf("FX07 loaded %d, want %d", cpu.V[1], tc.wantDT)
+			}
+			if sounds != tc.sounds {
+				t.Errorf("sound timer ran out %d times, want %d", sounds, tc.sounds)
+			}
+		})
+	}
+}
+
+// Without a clock the timers count down once per instruction
+func TestTimersWithoutClock(t *testing.T) {
+	cpu := &CPU{}
+	cpu.Init()
+	loadProgram(cpu, 0x6005, 0xF015, 0xF018, 0x1206)
+	for i := 0; i < 5; i++ {
+		if err := cpu.EmulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// F015 and F018 set the timers to 5, three more instructions ran
+	// after F015 and two after F018, each ticking once at its end
+	if cpu.DelayTimer() != 1 || cpu.SoundTimer() != 2 {
+		t.Errorf("DT %d ST %d, want DT 1 ST 2", cpu.DelayTimer(), cpu.SoundTimer())
+	}
+}
+
+// The ticks the clock moved before Init aren't counted
+func TestInitStartsFromTheClock(t *testing.T) {
+	clock := &ManualClock{}
+	clock.Advance(100)
+	cpu := &CPU{Clock: clock}
+	cpu.Init()
+	cpu.Delay_timer = 50
+	loadProgram(cpu, 0x1200)
+	if err := cpu.EmulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	if cpu.DelayTimer() != 50 {
+		t.Errorf("DT %d, want 50", cpu.DelayTimer())
+	}
+}
+
+// tickCounter is a peripheral counting the ticks it gets
+type tickCounter struct {
+	ticks int
+}
+
+func (c *tickCounter) Tick(cpu *CPU) {
+	c.ticks++
+}
+
+// Peripherals get every tick caught up, whatever the timers are
+func TestTimersTickPeripherals(t *testing.T) {
+	cpu, clock := newTestCPU(Quirks{})
+	counter := &tickCounter{}
+	cpu.Attach(counter)
+	loadProgram(cpu, 0x1200)
+	for _, n := range []uint64{0, 3, 0, 1} {
+		clock.Advance(n)
+		if err := cpu.EmulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counter.ticks != 4 {
+		t.Errorf("%d ticks, want 4", counter.ticks)
+	}
+}
@@ -0,0 +1,43 @@
+package chip8
+
+// The longest line a Console holds before it passes it on unfinished
+const maxConsoleLine = 256
+
+// Console is a debug peripheral real machines never had: the bytes a
+// program writes to Addr come out as text on the host, a line at a time,
+// for a printf while writing a ROM. Reading Addr gives 0.
+type Console struct {
+	Addr int
+
+	// Output is handed every line the program prints, without its newline
+	Output func(line string)
+
+	line []byte
+}
+
+func (c *Console) Tick(cpu *CPU) {}
+
+func (c *Console) Region() (start, end int) {
+	return c.Addr, c.Addr + 1
+}
+
+func (c *Console) Read8(addr int) uint8 {
+	return 0
+}
+
+func (c *Console) Write8(addr int, value uint8) {
+	if value != '\n' {
+		c.line = append(c.line, value)
+	}
+	if value == '\n' || len(c.line) >= maxConsoleLine {
+		c.Flush()
+	}
+}
+
+// Flush passes on what was printed since the last newline, if anything
+func (c *Console) Flush() {
+	if len(c.line) > 0 && c.Output != nil {
+		c.Output(string(c.line))
+	}
+	c.line = c.line[:0]
+}
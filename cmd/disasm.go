@@ -0,0 +1,119 @@
+package chip8
+
+import "fmt"
+
+// Mnemonics of the 8XYN opcodes taking two registers, by N
+var aluMnemonics = map[uint16]string{0x0: "LD", 0x1: "OR", 0x2: "AND", 0x3: "XOR", 0x4: "ADD", 0x5: "SUB", 0x7: "SUBN"}
+
+// Formats of the FXNN opcodes, by NN
+var miscFormats = map[uint16]string{
+	0x07: "LD V%X, DT",
+	0x0A: "LD V%X, K",
+	0x15: "LD DT, V%X",
+	0x18: "LD ST, V%X",
+	0x1E: "ADD I, V%X",
+	0x29: "LD F, V%X",
+	0x30: "LD HF, V%X",
+	0x33: "LD B, V%X",
+	0x55: "LD [I], V%X",
+	0x65: "LD V%X, [I]",
+	0x75: "LD R, V%X",
+	0x85: "LD V%X, R",
+}
+
+// Disassemble returns the mnemonic of an opcode, in the notation of
+// Cowgod's Chip-8 technical reference. Unknown opcodes come out as data.
+func Disassemble(opcode uint16) string {
+	return disassemble(opcode, func(addr uint16) string { return fmt.Sprintf("%03X", addr) })
+}
+
+// disassemble writes the addresses opcodes refer to with address
+func disassemble(opcode uint16, address func(uint16) string) string {
+	x := (opcode & 0x0F00) >> 8
+	y := (opcode & 0x00F0) >> 4
+	n := opcode & 0x000F
+	nn := opcode & 0x00FF
+	nnn := opcode & 0x0FFF
+
+	switch opcode & 0xF000 {
+	case 0x0000:
+		switch opcode {
+		case 0x00E0:
+			return "CLS"
+		case 0x00EE:
+			return "RET"
+		}
+		return fmt.Sprintf("SYS %s", address(nnn))
+	case 0x1000:
+		return fmt.Sprintf("JP %s", address(nnn))
+	case 0x2000:
+		return fmt.Sprintf("CALL %s", address(nnn))
+	case 0x3000:
+		return fmt.Sprintf("SE V%X, %02X", x, nn)
+	case 0x4000:
+		return fmt.Sprintf("SNE V%X, %02X", x, nn)
+	case 0x5000:
+		return fmt.Sprintf("SE V%X, V%X", x, y)
+	case 0x6000:
+		return fmt.Sprintf("LD V%X, %02X", x, nn)
+	case 0x7000:
+		return fmt.Sprintf("ADD V%X, %02X", x, nn)
+	case 0x8000:
+		if name, ok := aluMnemonics[n]; ok {
+			return fmt.Sprintf("%s V%X, V%X", name, x, y)
+		}
+		switch n {
+		case 0x6:
+			return fmt.Sprintf("SHR V%X", x)
+		case 0xE:
+			return fmt.Sprintf("SHL V%X", x)
+		}
+	case 0x9000:
+		return fmt.Sprintf("SNE V%X, V%X", x, y)
+	case 0xA000:
+		return fmt.Sprintf("LD I, %s", address(nnn))
+	case 0xB000:
+		return fmt.Sprintf("JP V0, %s", address(nnn))
+	case 0xC000:
+		return fmt.Sprintf("RND V%X, %02X", x, nn)
+	case 0xD000:
+		return fmt.Sprintf("DRW V%X, V%X, %X", x, y, n)
+	case 0xE000:
+		switch nn {
+		case 0x9E:
+			return fmt.Sprintf("SKP V%X", x)
+		case 0xA1:
+			return fmt.Sprintf("SKNP V%X", x)
+		}
+	case 0xF000:
+		if format, ok := miscFormats[nn]; ok {
+			return fmt.Sprintf(format, x)
+		}
+	}
+	return fmt.Sprintf("DW %04X", opcode)
+}
+
+// OpcodeClass returns the instruction an opcode is an instance of, written
+// like the references do with its operands as X, Y, N, NN and NNN: DXYN,
+// 8XY4, FX33. Opcodes sharing a class differ only in their operands.
+func OpcodeClass(opcode uint16) string {
+	top := opcode >> 12
+	switch top {
+	case 0x0:
+		if opcode == 0x00E0 || opcode == 0x00EE || opcode == 0x0230 {
+			return fmt.Sprintf("%04X", opcode)
+		}
+		return "0NNN"
+	case 0x1, 0x2, 0xA, 0xB:
+		return fmt.Sprintf("%XNNN", top)
+	case 0x3, 0x4, 0x6, 0x7, 0xC:
+		return fmt.Sprintf("%XXNN", top)
+	case 0x5, 0x9:
+		return fmt.Sprintf("%XXY0", top)
+	case 0x8:
+		return fmt.Sprintf("8XY%X", opcode&0x000F)
+	case 0xD:
+		return "DXYN"
+	}
+	return fmt.Sprintf("%XX%02X", top, opcode&0x00FF)
+}
@@ -1,35 +1,100 @@
 package chip8
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"os"
 )
 
-var fontSet = []uint8{
-	0xF0, 0x90, 0x90, 0x90, 0xF0, //0
-	0x20, 0x60, 0x20, 0x20, 0x70, //1
-	0xF0, 0x10, 0xF0, 0x80, 0xF0, //2
-	0xF0, 0x10, 0xF0, 0x10, 0xF0, //3
-	0x90, 0x90, 0xF0, 0x10, 0x10, //4
-	0xF0, 0x80, 0xF0, 0x10, 0xF0, //5
-	0xF0, 0x80, 0xF0, 0x90, 0xF0, //6
-	0xF0, 0x10, 0x20, 0x40, 0x40, //7
-	0xF0, 0x90, 0xF0, 0x90, 0xF0, //8
-	0xF0, 0x90, 0xF0, 0x10, 0xF0, //9
-	0xF0, 0x90, 0xF0, 0x90, 0x90, //A
-	0xE0, 0x90, 0xE0, 0x90, 0xE0, //B
-	0xF0, 0x80, 0x80, 0x80, 0xF0, //C
-	0xE0, 0x90, 0x90, 0x90, 0xE0, //D
-	0xF0, 0x80, 0xF0, 0x80, 0xF0, //E
-	0xF0, 0x80, 0xF0, 0x80, 0x80, //F
+// The original Chip-8 has 4KB of RAM, later variants like XO-CHIP address up to 64KB
+const (
+	DefaultMemorySize = 0x1000
+	MaxMemorySize     = 0x10000
+)
+
+// MemoryError is returned by EmulateCycle in strict mode when the program
+// touches memory it shouldn't: executing or writing below the load address
+// (the interpreter area), or accessing anything past the end of memory.
+type MemoryError struct {
+	Access string // "fetch", "read" or "write"
+	Addr   int
+	Pc     uint16
+}
+
+func (e *MemoryError) Error() string {
+	return fmt.Sprintf("illegal memory %s at 0x%X (PC 0x%X)", e.Access, e.Addr, e.Pc)
+}
+
+// StackError is returned by EmulateCycle when a program calls a subroutine
+// with the stack full, or returns with nothing to return to. The instruction
+// isn't run and PC is left on it.
+type StackError struct {
+	Op string // "call" or "return"
+	Pc uint16
+}
+
+func (e *StackError) Error() string {
+	if e.Op == "call" {
+		return fmt.Sprintf("stack overflow: call with 16 subroutines active (PC 0x%X)", e.Pc)
+	}
+	return fmt.Sprintf("stack underflow: return outside of a subroutine (PC 0x%X)", e.Pc)
 }
 
+// OpcodeError is returned by EmulateCycle for an opcode the interpreter
+// doesn't implement when OnInvalid is InvalidStop. PC is left on it.
+type OpcodeError struct {
+	Opcode uint16
+	Pc     uint16
+}
+
+func (e *OpcodeError) Error() string {
+	return fmt.Sprintf("unknown opcode 0x%04X (PC 0x%X)", e.Opcode, e.Pc)
+}
+
+// What to do about unknown opcodes
+type InvalidOpcodePolicy int
+
+const (
+	InvalidIgnore InvalidOpcodePolicy = iota // log a warning and skip the opcode
+	InvalidStop                              // stop with an OpcodeError
+)
+
 type CPU struct {
 	// The Chip-8 language is capable of accessing up to 4KB (4,096 bytes) of RAM,
 	// from location 0x000 (0) to 0xFFF
 	// MoSound_timer Chip-8 programs start at location 0x200 (512)
-	Memory [4096]uint8
+	Memory []uint8
+
+	// Bus stands between the instructions and Memory, nil to reach Memory
+	// as RAM. Set it for banked memory or memory-mapped devices.
+	Bus Bus
+
+	// MemorySize is the amount of RAM allocated by Init, zero means DefaultMemorySize.
+	MemorySize int
+
+	// LoadAt is where programs are loaded and start running, zero means
+	// LoadAddress. Set it before Init, ETI-660 programs need ETI660LoadAddress.
+	LoadAt int
+
+	// Font is the font set Init loads, one returned by Font or a set checked by
+	// ParseFont. Nil, or a set of the wrong size, means the "chip8" set.
+	Font []uint8
+
+	// Hires selects the two-page hires CHIP-8 variant, set it before Init.
+	// The screen is 64x64 and 0230 clears it. ROMs written for it begin
+	// with a jump to the interpreter patch at 0x260 (1260), which is skipped
+	// by starting them at HiresStart.
+	Hires bool
+
+	// In Strict mode illegal memory accesses stop the program with a MemoryError,
+	// otherwise addresses past the end of memory wrap around.
+	Strict bool
+	fault  error
+
+	// OnInvalid says what to do about unknown opcodes
+	OnInvalid InvalidOpcodePolicy
 
 	// The Chip 8 has 35 Opcodes which are all two bytes long.
 	Opcode uint16
@@ -49,9 +114,17 @@ type CPU struct {
 	Delay_timer uint8
 	Sound_timer uint8
 
+	// Clock paces the timers at 60 Hz, set it before Init. Without one they
+	// count down once per cycle.
+	Clock    Clock
+	lastTick uint64
+
 	// Graphics:
 	// The graphics of the Chip 8 are black and white and the screen has a total of 2048 pixels (64 x 32).
-	Display [32][64]uint8
+	// One byte per pixel in row-major order, see Framebuffer.
+	display       []uint8
+	displayWidth  int
+	displayHeight int
 
 	// The Stack pointer (SP) can be 8-bit, it is used to point to the topmost level of the stack.
 	Stack_pointer uint8
@@ -64,14 +137,122 @@ type CPU struct {
 	Keypad [16]uint8
 
 	DrawFlag bool
+
+	// The HP-48 calculators running SCHIP have 8 user flags (RPL) that survive
+	// between runs, games use them to keep high scores.
+	// RPLFlag is set whenever FX75 changes them, so they can be saved to disk.
+	RPL     [8]uint8
+	RPLFlag bool
+
+	// Rand is the source of CXNN random numbers, the global one if nil.
+	// Machines sharing a seed stay in sync, as netplay needs.
+	Rand *rand.Rand
+
+	Hooks Hooks
+
+	// Quirks picks how the instructions old interpreters disagree on behave
+	Quirks Quirks
+
+	// The devices plugged in with Attach, and the ones among them mapped into memory
+	peripherals []Peripheral
+	mapped      []Mapped
+}
+
+// Hooks let tracers, debuggers and tests observe the emulation without
+// changing it. Any of them can be nil.
+type Hooks struct {
+	// BeforeExecute is called once an instruction is fetched, AfterExecute
+	// once it ran. pc is the address of the instruction.
+	BeforeExecute func(pc, opcode uint16)
+	AfterExecute  func(pc, opcode uint16)
+
+	// OnDraw is called whenever an instruction changes the screen
+	OnDraw func()
+
+	// OnSound is called when the sound timer runs out and the buzzer sounds
+	OnSound func()
+
+	// OnKeyRead is called when EX9E or EXA1 test a key, and with -1 when
+	// FX0A waits for any key
+	OnKeyRead func(key int)
+}
+
+// Size of the low resolution CHIP-8 screen
+const (
+	LoresWidth  = 64
+	LoresHeight = 32
+)
+
+// Size of the two-page hires CHIP-8 screen
+const (
+	HiresWidth  = 64
+	HiresHeight = 64
+)
+
+// Two-page hires ROMs begin with HiresEntry, the program proper is at HiresStart
+const (
+	HiresEntry = 0x1260
+	HiresStart = 0x2C0
+)
+
+// Framebuffer returns the screen, Width() * Height() bytes in row-major
+// order with 1 for a lit pixel and 0 otherwise. It is updated in place by
+// the emulation, copy it to keep a frame around.
+func (cpu *CPU) Framebuffer() []byte {
+	return cpu.display
+}
+
+// Width returns the width of the screen in pixels
+func (cpu *CPU) Width() int {
+	return cpu.displayWidth
+}
+
+// Height returns the height of the screen in pixels
+func (cpu *CPU) Height() int {
+	return cpu.displayHeight
+}
+
+// CallDepth returns how many subroutines deep the program is, 2NNN adds one
+// and 00EE takes one away. Debuggers step over and out of calls with it.
+func (cpu *CPU) CallDepth() int {
+	return int(cpu.Stack_pointer)
+}
+
+// NextOpcode returns the instruction at PC, the one the next cycle runs.
+// Unlike fetching it, this never faults.
+func (cpu *CPU) NextOpcode() uint16 {
+	pc := int(cpu.Pc) % len(cpu.Memory)
+	if cpu.Bus != nil {
+		return cpu.Bus.Read16(pc)
+	}
+	return RAM(cpu.Memory).Read16(pc)
+}
+
+// Idle reports whether the program is spinning in place, on a jump to itself
+// or on FX0A with no key pressed. Until a key is pressed more cycles only
+// count the timers down, so frontends may sleep instead of running them.
+func (cpu *CPU) Idle() bool {
+	opcode := cpu.NextOpcode()
+	switch {
+	case opcode&0xF000 == 0x1000:
+		return opcode&0x0FFF == cpu.Pc
+	case opcode&0xF0FF == 0xF00A:
+		for _, key := range cpu.Keypad {
+			if key != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
 }
 
 func (cpu *CPU) Init() {
 	// DrawFlag
 	cpu.DrawFlag = true
 
-	// Program counter starts at 0x200 (512)
-	Pc := 0x200
+	// Program counter starts where programs are loaded, 0x200 (512) unless LoadAt says otherwise
+	Pc := cpu.loadAddress()
 	cpu.Pc = uint16(Pc)
 
 	// Reset the current Opcode
@@ -84,11 +265,11 @@ func (cpu *CPU) Init() {
 	cpu.I = 0
 
 	// Clear Display
-	for i := 0; i < 32; i++ {
-		for j := 0; j < 64; j++ {
-			cpu.Display[i][j] = 0
-		}
+	cpu.displayWidth, cpu.displayHeight = LoresWidth, LoresHeight
+	if cpu.Hires {
+		cpu.displayWidth, cpu.displayHeight = HiresWidth, HiresHeight
 	}
+	cpu.display = make([]uint8, cpu.displayWidth*cpu.displayHeight)
 
 	// Clear stack
 	for i := 0; i < len(cpu.Stack); i++ {
@@ -100,22 +281,88 @@ func (cpu *CPU) Init() {
 		cpu.V[i] = 0
 	}
 
-	// Clear Memory
-	for i := 0; i < len(cpu.Memory); i++ {
-		cpu.Memory[i] = 0
+	// Allocate (and clear) Memory
+	size := cpu.MemorySize
+	if size <= 0 {
+		size = DefaultMemorySize
 	}
-
-	// Load fontSet
-	for i := 0; i < 80; i++ {
-		cpu.Memory[i] = fontSet[i]
+	if size > MaxMemorySize {
+		size = MaxMemorySize
 	}
+	cpu.Memory = make([]uint8, size)
+	cpu.fault = nil
+
+	// Load the font set
+	cpu.loadFont()
 
 	// Reset the delay_timer and the sound_timer registers
 	cpu.Delay_timer = 0
 	cpu.Sound_timer = 0
+	if cpu.Clock != nil {
+		cpu.lastTick = cpu.Clock.Ticks()
+	}
+}
+
+// access maps addr into memory, recording a MemoryError in strict mode
+// when the access isn't allowed.
+func (cpu *CPU) access(kind string, addr int) (int, bool) {
+	if cpu.Strict {
+		if addr >= len(cpu.Memory) || (kind != "read" && addr < cpu.loadAddress()) {
+			if cpu.fault == nil {
+				cpu.fault = &MemoryError{Access: kind, Addr: addr, Pc: cpu.Pc}
+			}
+			return 0, false
+		}
+	}
+	return addr % len(cpu.Memory), true
 }
 
-func (cpu *CPU) EmulateCycle() {
+func (cpu *CPU) read(addr int) uint8 {
+	i, ok := cpu.access("read", addr)
+	if !ok {
+		return 0
+	}
+	if m := cpu.device(i); m != nil {
+		return m.Read8(i)
+	}
+	if cpu.Bus != nil {
+		return cpu.Bus.Read8(i)
+	}
+	return cpu.Memory[i]
+}
+
+func (cpu *CPU) write(addr int, value uint8) {
+	i, ok := cpu.access("write", addr)
+	if !ok {
+		return
+	}
+	if m := cpu.device(i); m != nil {
+		m.Write8(i, value)
+		return
+	}
+	if cpu.Bus != nil {
+		cpu.Bus.Write8(i, value)
+		return
+	}
+	cpu.Memory[i] = value
+}
+
+// fetch reads the opcode at addr, both of its bytes must be in memory
+func (cpu *CPU) fetch(addr int) uint16 {
+	i, ok := cpu.access("fetch", addr)
+	if _, next := cpu.access("fetch", addr+1); !ok || !next {
+		return 0
+	}
+	if cpu.Bus != nil {
+		return cpu.Bus.Read16(i)
+	}
+	return RAM(cpu.Memory).Read16(i)
+}
+
+// EmulateCycle executes a single instruction. It fails with a StackError when
+// the stack over- or underflows, with a MemoryError in strict mode and with
+// an OpcodeError if OnInvalid is InvalidStop.
+func (cpu *CPU) EmulateCycle() error {
 	// Emulation cycle: Fetch -> Decode -> Execute
 	// Every cycle, the method EmulateCycle is called which emulates one cycle of the Chip 8 CPU.
 	// During this cycle, the emulator will Fetch, Decode and Execute one Opcode.
@@ -129,272 +376,171 @@ func (cpu *CPU) EmulateCycle() {
 	// Finally, the two results are combined using bitwise OR to form the 16-bit Opcode value.
 	// cpu.Opcode = uint16(cpu.Memory[cpu.pc]&0xF0) | uint16(cpu.Memory[cpu.pc+1]&0x0F)
 	// Or, you can simply shift left the cpu.Memory address and then perform an OR operation with the new addr.
-	cpu.Opcode = (uint16(cpu.Memory[cpu.Pc]) << 8) | uint16(cpu.Memory[cpu.Pc+1])
+	cpu.Opcode = cpu.fetch(int(cpu.Pc))
+	if cpu.fault != nil {
+		return cpu.takeFault()
+	}
+
+	pc, opcode := cpu.Pc, cpu.Opcode
+	if cpu.Hooks.BeforeExecute != nil {
+		cpu.Hooks.BeforeExecute(pc, opcode)
+	}
 
 	// Decode Opcode
 	// As we have stored our current Opcode, we need to decode the Opcode and
 	// check the Opcode table to see what it means.
-	switch cpu.Opcode & 0xF000 { // 0xF000 is 1111 0000 0000 0000 in binary
-	case 0x0000:
-		switch cpu.Opcode & 0x000F { // 0x000F is 0000 0000 0000 1111
-		case 0x0000: // 0x00E0: Clears the screen
-			for i := 0; i < 32; i++ {
-				for j := 0; j < 64; j++ {
-					cpu.Display[i][j] = 0
-				}
-			}
-			cpu.Pc = cpu.Pc + 2
-		case 0x000E: // 0x00EE: Returns from subroutine
-			cpu.Stack_pointer = cpu.Stack_pointer - 1
-			cpu.Pc = cpu.Stack[cpu.Stack_pointer]
-			cpu.Pc = cpu.Pc + 2
-		default:
-			fmt.Printf("Unknown Opcode [0x0000]: 0x%X\n", cpu.Opcode)
-		}
-
-	case 0x1000: // 1NNN: Jumps to address NNN
-		cpu.Pc = cpu.Opcode & 0x0FFF
+	// The first nibble selects the opcode class, see opcodes.go
+	cpu.dispatch(opcodeTable[:], cpu.Opcode>>12)
 
-	case 0x2000: // 2NNN: Calls subroutine at NNN.
-		cpu.Stack[cpu.Stack_pointer] = cpu.Pc
-		cpu.Stack_pointer = cpu.Stack_pointer + 1
-		cpu.Pc = cpu.Opcode & 0x0FFF
-
-	case 0x3000: // 3XNN: Skips the next instruction if VX equals NN
-		if uint16(cpu.V[(cpu.Opcode&0x0F00)>>8]) == (cpu.Opcode & 0x00FF) {
-			cpu.Pc = cpu.Pc + 4 // Skip next instruction
-		} else {
-			cpu.Pc = cpu.Pc + 2
-		}
+	// Update timers
+	cpu.updateTimers()
 
-	case 0x4000: // 4XNN: Skips the next instruction if VX does not equal NN
-		if uint16(cpu.V[(cpu.Opcode&0x0F00)>>8]) != (cpu.Opcode & 0x00FF) {
-			cpu.Pc = cpu.Pc + 4 // Skip next instruction
-		} else {
-			cpu.Pc = cpu.Pc + 2
-		}
+	if cpu.Hooks.AfterExecute != nil {
+		cpu.Hooks.AfterExecute(pc, opcode)
+	}
 
-	case 0x5000: // 5XY0: Skips the next instruction if VX equals VY
-		if uint16(cpu.V[(cpu.Opcode&0x0F00)>>8]) == uint16(cpu.V[(cpu.Opcode&0x00F0)>>4]) {
-			cpu.Pc = cpu.Pc + 4 // Skip next instruction
-		} else {
-			cpu.Pc = cpu.Pc + 2
-		}
+	return cpu.takeFault()
+}
 
-	case 0x6000: // 6XNN: Sets VX to NN.
-		cpu.V[(cpu.Opcode&0x0F00)>>8] = uint8(cpu.Opcode & 0x00FF)
-		cpu.Pc = cpu.Pc + 2
-
-	case 0x7000: // 7XNN: Adds NN to VX (carry flag is not changed).
-		cpu.V[(cpu.Opcode&0x0F00)>>8] += uint8(cpu.Opcode & 0x00FF)
-		cpu.Pc = cpu.Pc + 2
-
-		// Chip-8 ALU (arithmetic logic unit)
-		// Performs arithmetic and bitwise operations.
-	case 0x8000:
-		switch cpu.Opcode & 0x000F { // 0x000F is 0000 0000 0000 1111
-		case 0x0000: // 8XY0: Sets Vx to the value of Vy
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x00F0)>>4]
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x0001: // 8XY1: Sets VX to VX or VY. (bitwise OR operation)
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] | cpu.V[(cpu.Opcode&0x00F0)>>4]
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x0002: // 8XY2: Sets VX to VX and VY. (bitwise AND operation)
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] & cpu.V[(cpu.Opcode&0x00F0>>4)]
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x0003: // 8XY3: Sets VX to VX xor VY. (bitwise XOR operation)
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] ^ cpu.V[(cpu.Opcode&0x00F0)>>4]
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x0004: // 8XY4: Adds VY to VX. VF is set to 1 when there's a carry, and to 0 when there is not.
-			if cpu.V[(cpu.Opcode&0x00F0)>>4] > (0xFF - cpu.V[(cpu.Opcode&0x0F00)>>8]) {
-				cpu.V[0xF] = 1 //carry
-			} else {
-				cpu.V[0xF] = 0
-			}
-			cpu.V[(cpu.Opcode&0x0F00)>>8] += cpu.V[(cpu.Opcode&0x00F0)>>4]
-			cpu.Pc = cpu.Pc + 2 // Because every instruction is 2 bytes long
-
-		case 0x0005: // 8XY5: VY is subtracted from VX. VF is set to 0 when there's a borrow, and 1 when there is not.
-			if cpu.V[(cpu.Opcode&0x00F0)>>4] > cpu.V[(cpu.Opcode&0x0F00)>>8] {
-				cpu.V[0xF] = 0 // There is a borrow
-			} else {
-				cpu.V[0xF] = 1 // No borrow
-			}
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] - cpu.V[(cpu.Opcode&0x00F0)>>4]
-			cpu.Pc = cpu.Pc + 2 // Because every instruction is 2 bytes long
-
-		case 0x0006: // 0x8XY6 Shifts VY right by one and stores the result to VX (VY remains unchanged). VF is set to the value of the leaSound_timer significant bit of VY before the shift
-			cpu.V[0xF] = cpu.V[(cpu.Opcode&0x0F00)>>8] & 0x1
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] >> 1
-			cpu.Pc = cpu.Pc + 2
-		case 0x0007: // 0x8XY7 Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't
-			if cpu.V[(cpu.Opcode&0x0F00)>>8] > cpu.V[(cpu.Opcode&0x00F0)>>4] {
-				cpu.V[0xF] = 0
-			} else {
-				cpu.V[0xF] = 1
-			}
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x00F0)>>4] - cpu.V[(cpu.Opcode&0x0F00)>>8]
-			cpu.Pc = cpu.Pc + 2
-		case 0x000E: // 0x8XYE Shifts VY left by one and copies the result to VX. VF is set to the value of the moSound_timer significant bit of VY before the shift
-			cpu.V[0xF] = cpu.V[(cpu.Opcode&0x0F00)>>8] >> 7
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] << 1
-			cpu.Pc = cpu.Pc + 2
-		default:
-			fmt.Printf("Invalid Opcode %X\n", cpu.Opcode)
-		}
+// draw flags the screen for redrawing
+func (cpu *CPU) draw() {
+	cpu.DrawFlag = true
+	if cpu.Hooks.OnDraw != nil {
+		cpu.Hooks.OnDraw()
+	}
+}
 
-	case 0x9000: // 9XY0: Skips the next instruction if VX does not equal VY. (Usually the next instruction is a jump to skip a code block);
-		if cpu.V[(cpu.Opcode&0x0F00)>>8] != cpu.V[(cpu.Opcode&0x00F0)>>4] {
-			cpu.Pc = cpu.Pc + 4 // Skip the next instruction
-		} else {
-			cpu.Pc = cpu.Pc + 2 // Go to the rightmoSound_timer instruction
-		}
+// keyRead tells the OnKeyRead hook a key of the keypad was read
+func (cpu *CPU) keyRead(key int) {
+	if cpu.Hooks.OnKeyRead != nil {
+		cpu.Hooks.OnKeyRead(key)
+	}
+}
 
-	case 0xA000: // ANNN: Sets I to the address NNN
-		cpu.I = cpu.Opcode & 0x0FFF
-		cpu.Pc = cpu.Pc + 2 // Because every instruction is 2 bytes long
-
-	case 0xB000: // BNNN: Jumps to the address NNN plus V0.
-		cpu.Pc = (cpu.Opcode & 0x0FFF) + uint16(cpu.V[0x0])
-
-	case 0xC000: // CXNN: Sets VX to the result of a bitwise and operation on a random number (Typically: 0 to 255) and NN.
-		cpu.V[(cpu.Opcode&0x0F00)>>8] = uint8(rand.Intn(256)) & uint8((cpu.Opcode & 0x00FF))
-		cpu.Pc = cpu.Pc + 2
-
-	case 0xD000: // 0xDXYN Draws a sprite at coordinate (VX, VY)
-		x := cpu.V[(cpu.Opcode&0x0F00)>>8]
-		y := cpu.V[(cpu.Opcode&0x00F0)>>4]
-		h := cpu.Opcode & 0x000F
-		cpu.V[0xF] = 0
-		var j uint16
-		var i uint16
-		for j = 0; j < h; j++ {
-			pixel := cpu.Memory[cpu.I+j]
-			for i = 0; i < 8; i++ {
-				if (pixel & (0x80 >> i)) != 0 {
-					if int(y+uint8(j)) < len(cpu.Display) && int(x+uint8(i)) < len(cpu.Display[0]) {
-						if cpu.Display[y+uint8(j)][x+uint8(i)] == 1 {
-							cpu.V[0xF] = 1
-						}
-						cpu.Display[y+uint8(j)][x+uint8(i)] ^= 1
-					}
-				}
-			}
-		}
-		cpu.DrawFlag = true
-		cpu.Pc = cpu.Pc + 2
-
-	case 0xE000:
-		switch cpu.Opcode & 0x00FF {
-		case 0x009E: // 0xEX9E Skips the next instruction if the key stored in VX is pressed
-			if cpu.Keypad[cpu.V[(cpu.Opcode&0x0F00)>>8]] != 0 {
-				cpu.Pc = cpu.Pc + 4
-			} else {
-				cpu.Pc = cpu.Pc + 2
-			}
-		case 0x00A1: // 0xEXA1 Skips the next instruction if the key stored in VX isn't pressed
-			if cpu.Keypad[cpu.V[(cpu.Opcode&0x0F00)>>8]] == 0 {
-				cpu.Pc = cpu.Pc + 4
-			} else {
-				cpu.Pc = cpu.Pc + 2
-			}
-		default:
-			fmt.Printf("Invalid Opcode %X\n", cpu.Opcode)
+// unknownOpcode handles an opcode the interpreter doesn't implement as OnInvalid says
+func (cpu *CPU) unknownOpcode() {
+	if cpu.runPeripheral() {
+		return
+	}
+	if cpu.OnInvalid == InvalidStop {
+		if cpu.fault == nil {
+			cpu.fault = &OpcodeError{Opcode: cpu.Opcode, Pc: cpu.Pc}
 		}
+		return
+	}
+	slog.Warn("Unknown opcode", "opcode", fmt.Sprintf("0x%04X", cpu.Opcode), "pc", fmt.Sprintf("0x%03X", cpu.Pc))
+	cpu.Pc = cpu.Pc + 2
+}
 
-	case 0xF000:
-		switch cpu.Opcode & 0x00FF { // 0x000F is 0000 0000 0000 1111
+func (cpu *CPU) stackFault(op string) {
+	if cpu.fault == nil {
+		cpu.fault = &StackError{Op: op, Pc: cpu.Pc}
+	}
+}
 
-		case 0x0007: // FX07: Sets VX to the value of the delay timer.
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.Delay_timer
-			cpu.Pc = cpu.Pc + 2
+// takeFault returns and clears the error of the current cycle
+func (cpu *CPU) takeFault() error {
+	err := cpu.fault
+	cpu.fault = nil
+	return err
+}
 
-		case 0x000A: // FX0A: A key press is awaited, and then stored in VX (blocking operation, all instruction halted until next key event).
-			pressed := false
-			for i := 0; i < len(cpu.Keypad); i++ {
-				if cpu.Keypad[i] != 0 {
-					cpu.V[(cpu.Opcode&0x0F00)>>8] = uint8(i)
-					pressed = true
-				}
-			}
-			if !pressed {
-				return
-			}
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x0015: // FX15: Sets the delay timer to VX.
-			cpu.Delay_timer = cpu.V[(cpu.Opcode&0x0F00)>>8]
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x0018: // FX18: Sets the sound timer to VX.
-			cpu.Sound_timer = cpu.V[(cpu.Opcode&0x0F00)>>8]
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x001E: // FX1E: Adds VX to I. VF is not affected.
-			cpu.I = cpu.I + uint16(cpu.V[(cpu.Opcode&0x0F00)>>8])
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x0029: // FX29: Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
-			cpu.I = uint16(cpu.V[(cpu.Opcode&0x0F00)>>8]) * 0x5
-			cpu.Pc = cpu.Pc + 2
-
-		case 0x0033: // FX33: Stores the binary-coded decimal representation of VX, with the hundreds digit in Memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.
-			cpu.Memory[cpu.I] = cpu.V[(cpu.Opcode&0x0F00)>>8] / 100
-			cpu.Memory[cpu.I+1] = (cpu.V[(cpu.Opcode&0x0F00)>>8] / 10) % 10
-			cpu.Memory[cpu.I+2] = (cpu.V[(cpu.Opcode&0x0F00)>>8] % 100) % 10
-			cpu.Pc = cpu.Pc + 2 // Because every instruction is 2 bytes long
-
-		case 0x0055: // FX55: Stores from V0 to VX (including VX) in Memory, starting at address I. The offset from I is increased by 1 for each value written, but I itself is left unmodified.
-			cpu.Memory[cpu.I] = uint8(cpu.V[(cpu.Opcode&0x0F00)>>8])
-			for i := uint16(0); i <= ((cpu.Opcode & 0x0F00) >> 8); i++ {
-				cpu.Memory[cpu.I+i] = cpu.V[i]
-			}
-			cpu.Pc = cpu.Pc + 2
+// Programs are loaded at 0x200 (512), below is reserved for the interpreter.
+// The ETI-660 loads them at 0x600 instead.
+const (
+	LoadAddress       = 0x200
+	ETI660LoadAddress = 0x600
+)
 
-		case 0x0065: // FX65: Fills from V0 to VX (including VX) with values from Memory, starting at address I. The offset from I is increased by 1 for each value read, but I itself is left unmodified.
-			cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.Memory[cpu.I]
-			for i := uint16(0); i <= ((cpu.Opcode & 0x0F00) >> 8); i++ {
-				cpu.V[i] = cpu.Memory[cpu.I+i]
-			}
-			cpu.Pc = cpu.Pc + 2
+// loadAddress returns where programs are loaded and start
+func (cpu *CPU) loadAddress() int {
+	if cpu.LoadAt <= 0 {
+		return LoadAddress
+	}
+	return cpu.LoadAt
+}
 
-		default:
-			fmt.Printf("Unknown Opcode [0x8000]: 0x%X\n", cpu.Opcode)
-		}
+var (
+	ErrEmptyRom = errors.New("ROM is empty")
+	ErrOddRom   = errors.New("ROM has an odd number of bytes")
+	ErrPcMoved  = errors.New("the program counter is outside the new ROM")
+)
 
-	default:
-		fmt.Printf("Unknown Opcode: 0x%x\n", cpu.Opcode)
+// ValidateRom checks that a ROM fits into the memory of the machine. Since
+// every instruction is 2 bytes long strict mode also rejects odd sized ROMs.
+func (cpu *CPU) ValidateRom(data []byte) error {
+	if len(data) == 0 {
+		return ErrEmptyRom
 	}
-
-	// Update timers
-	if cpu.Delay_timer > 0 {
-		cpu.Delay_timer = cpu.Delay_timer - 1
+	if limit := len(cpu.Memory) - cpu.loadAddress(); limit < 0 || len(data) > limit {
+		return fmt.Errorf("ROM is %d bytes, only %d bytes fit in %d bytes of memory", len(data), limit, len(cpu.Memory))
 	}
-
-	if cpu.Sound_timer > 0 {
-		if cpu.Sound_timer == 1 {
-			fmt.Println("BEEP!")
-			cpu.Sound_timer = cpu.Sound_timer - 1
-		}
+	if cpu.Strict && len(data)%2 != 0 {
+		return ErrOddRom
 	}
+	return nil
 }
 
-func (cpu *CPU) LoadRom(filename string) {
+// LoadRom reads a ROM from disk into Memory, see LoadRomData.
+func (cpu *CPU) LoadRom(filename string) error {
 	data, err := os.ReadFile(filename)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if err := cpu.LoadRomData(data); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// LoadRomData validates a ROM and copies it into Memory. Init must be called first.
+func (cpu *CPU) LoadRomData(data []byte) error {
+	if err := cpu.ValidateRom(data); err != nil {
+		return err
 	}
 
 	// Load the ROM into Memory
-	for i := 0; i < len(data); i++ {
-		cpu.Memory[i+512] = data[i]
+	copy(cpu.Memory[cpu.loadAddress():], data)
+
+	// The hires patch at 0x260 is machine code, run the program after it
+	if cpu.Hires && len(data) >= 2 && uint16(data[0])<<8|uint16(data[1]) == HiresEntry {
+		cpu.Pc = HiresStart
+	}
+
+	slog.Info("ROM loaded successfully", "size", len(data))
+	return nil
+}
+
+// PatchRom swaps the running program for a new version of its ROM, old being
+// the one it was loaded from. Only the bytes that differ between the two are
+// written, so the registers, the screen and whatever the program stored in
+// memory itself carry over. It fails with ErrPcMoved, leaving memory alone,
+// if the program is running from outside the new ROM.
+func (cpu *CPU) PatchRom(old, data []byte) error {
+	if err := cpu.ValidateRom(data); err != nil {
+		return err
+	}
+	start := cpu.loadAddress()
+	if int(cpu.Pc) < start || int(cpu.Pc) >= start+len(data) {
+		return ErrPcMoved
 	}
 
-	fmt.Println("ROM loaded successfully")
+	for i := 0; i < max(len(old), len(data)); i++ {
+		var was, now uint8
+		if i < len(old) {
+			was = old[i]
+		}
+		if i < len(data) {
+			now = data[i]
+		}
+		if was != now && start+i < len(cpu.Memory) {
+			cpu.Memory[start+i] = now
+		}
+	}
+	cpu.DrawFlag = true
+
+	slog.Info("ROM patched successfully", "size", len(data))
+	return nil
 }
 
 func (cpu *CPU) SetKeys(keyStates [16]bool) {
@@ -0,0 +1,163 @@
+package chip8
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Fonts sit at the start of memory, the 4x5 digits of FX29 first and the
+// 8x10 digits of FX30 right after them.
+const (
+	FontAddress    = 0x000
+	BigFontAddress = FontAddress + SmallFontSize
+
+	SmallFontSize = 16 * 5
+	BigFontSize   = 16 * 10
+)
+
+var fontSet = []uint8{
+	0xF0, 0x90, 0x90, 0x90, 0xF0, //0
+	0x20, 0x60, 0x20, 0x20, 0x70, //1
+	0xF0, 0x10, 0xF0, 0x80, 0xF0, //2
+	0xF0, 0x10, 0xF0, 0x10, 0xF0, //3
+	0x90, 0x90, 0xF0, 0x10, 0x10, //4
+	0xF0, 0x80, 0xF0, 0x10, 0xF0, //5
+	0xF0, 0x80, 0xF0, 0x90, 0xF0, //6
+	0xF0, 0x10, 0x20, 0x40, 0x40, //7
+	0xF0, 0x90, 0xF0, 0x90, 0xF0, //8
+	0xF0, 0x90, 0xF0, 0x10, 0xF0, //9
+	0xF0, 0x90, 0xF0, 0x90, 0x90, //A
+	0xE0, 0x90, 0xE0, 0x90, 0xE0, //B
+	0xF0, 0x80, 0x80, 0x80, 0xF0, //C
+	0xE0, 0x90, 0x90, 0x90, 0xE0, //D
+	0xF0, 0x80, 0xF0, 0x80, 0xF0, //E
+	0xF0, 0x80, 0xF0, 0x80, 0x80, //F
+}
+
+// The font of the COSMAC VIP interpreter
+var vipFontSet = []uint8{
+	0xF0, 0x90, 0x90, 0x90, 0xF0, //0
+	0x60, 0x20, 0x20, 0x20, 0x70, //1
+	0xF0, 0x10, 0xF0, 0x80, 0xF0, //2
+	0xF0, 0x10, 0xF0, 0x10, 0xF0, //3
+	0xA0, 0xA0, 0xF0, 0x20, 0x20, //4
+	0xF0, 0x80, 0xF0, 0x10, 0xF0, //5
+	0xF0, 0x80, 0xF0, 0x90, 0xF0, //6
+	0xF0, 0x10, 0x10, 0x10, 0x10, //7
+	0xF0, 0x90, 0xF0, 0x90, 0xF0, //8
+	0xF0, 0x90, 0xF0, 0x10, 0xF0, //9
+	0xF0, 0x90, 0xF0, 0x90, 0x90, //A
+	0xF0, 0x50, 0x70, 0x50, 0xF0, //B
+	0xF0, 0x80, 0x80, 0x80, 0xF0, //C
+	0xF0, 0x50, 0x50, 0x50, 0xF0, //D
+	0xF0, 0x80, 0xF0, 0x80, 0xF0, //E
+	0xF0, 0x80, 0xF0, 0x80, 0x80, //F
+}
+
+// The font of the Dream 6800, 3 pixels wide
+var dream6800FontSet = []uint8{
+	0xE0, 0xA0, 0xA0, 0xA0, 0xE0, //0
+	0x40, 0x40, 0x40, 0x40, 0x40, //1
+	0xE0, 0x20, 0xE0, 0x80, 0xE0, //2
+	0xE0, 0x20, 0xE0, 0x20, 0xE0, //3
+	0x80, 0xA0, 0xA0, 0xE0, 0x20, //4
+	0xE0, 0x80, 0xE0, 0x20, 0xE0, //5
+	0xE0, 0x80, 0xE0, 0xA0, 0xE0, //6
+	0xE0, 0x20, 0x20, 0x20, 0x20, //7
+	0xE0, 0xA0, 0xE0, 0xA0, 0xE0, //8
+	0xE0, 0xA0, 0xE0, 0x20, 0xE0, //9
+	0xE0, 0xA0, 0xE0, 0xA0, 0xA0, //A
+	0xC0, 0xA0, 0xE0, 0xA0, 0xC0, //B
+	0xE0, 0x80, 0x80, 0x80, 0xE0, //C
+	0xC0, 0xA0, 0xA0, 0xA0, 0xC0, //D
+	0xE0, 0x80, 0xE0, 0x80, 0xE0, //E
+	0xE0, 0x80, 0xC0, 0x80, 0x80, //F
+}
+
+// The font of the ETI-660, 3 pixels wide
+var eti660FontSet = []uint8{
+	0xE0, 0xA0, 0xA0, 0xA0, 0xE0, //0
+	0x20, 0x20, 0x20, 0x20, 0x20, //1
+	0xE0, 0x20, 0xE0, 0x80, 0xE0, //2
+	0xE0, 0x20, 0xE0, 0x20, 0xE0, //3
+	0xA0, 0xA0, 0xE0, 0x20, 0x20, //4
+	0xE0, 0x80, 0xE0, 0x20, 0xE0, //5
+	0xE0, 0x80, 0xE0, 0xA0, 0xE0, //6
+	0xE0, 0x20, 0x20, 0x20, 0x20, //7
+	0xE0, 0xA0, 0xE0, 0xA0, 0xE0, //8
+	0xE0, 0xA0, 0xE0, 0x20, 0xE0, //9
+	0xE0, 0xA0, 0xE0, 0xA0, 0xA0, //A
+	0x80, 0x80, 0xE0, 0xA0, 0xE0, //B
+	0xE0, 0x80, 0x80, 0x80, 0xE0, //C
+	0x20, 0x20, 0xE0, 0xA0, 0xE0, //D
+	0xE0, 0x80, 0xE0, 0x80, 0xE0, //E
+	0xE0, 0x80, 0xC0, 0x80, 0x80, //F
+}
+
+// The big digits of SCHIP 1.1, which only drew 0-9, followed by the usual A-F
+var bigFontSet = []uint8{
+	0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, //0
+	0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, //1
+	0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, //2
+	0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, //3
+	0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, //4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, //5
+	0x3E, 0x7C, 0xC0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, //6
+	0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, //7
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, //8
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, //9
+	0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, //A
+	0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, //B
+	0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, //C
+	0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, //D
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, //E
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, //F
+}
+
+// The built-in font sets by name, all of them have the SCHIP big digits
+var fonts = map[string][]uint8{
+	"chip8":     fontSet,
+	"vip":       vipFontSet,
+	"dream6800": dream6800FontSet,
+	"eti660":    eti660FontSet,
+	"schip":     fontSet,
+}
+
+// Font returns a copy of the built-in font set name, the sets are shared by
+// every machine so they are never handed out to be written to
+func Font(name string) ([]uint8, bool) {
+	font, ok := fonts[name]
+	if !ok {
+		return nil, false
+	}
+	return append([]uint8(nil), font...), true
+}
+
+// ParseFont checks a font set read from a file: the 16 small digits, 5 bytes
+// each, optionally followed by the 16 big digits, 10 bytes each.
+func ParseFont(data []byte) ([]uint8, error) {
+	if len(data) != SmallFontSize && len(data) != SmallFontSize+BigFontSize {
+		return nil, fmt.Errorf("font is %d bytes, want %d or %d with the big digits", len(data), SmallFontSize, SmallFontSize+BigFontSize)
+	}
+	return data, nil
+}
+
+// loadFont copies the font set into memory, the built-in big digits are
+// used unless the set brings its own. A set ParseFont would refuse gives way
+// to the "chip8" one.
+func (cpu *CPU) loadFont() {
+	font := cpu.Font
+	if _, err := ParseFont(font); font != nil && err != nil {
+		slog.Warn("Invalid font set, loading the chip8 one", "err", err)
+		font = nil
+	}
+	if font == nil {
+		font = fontSet
+	}
+	copy(cpu.Memory[FontAddress:], font[:SmallFontSize])
+	if len(font) >= SmallFontSize+BigFontSize {
+		copy(cpu.Memory[BigFontAddress:], font[SmallFontSize:SmallFontSize+BigFontSize])
+	} else {
+		copy(cpu.Memory[BigFontAddress:], bigFontSet)
+	}
+}
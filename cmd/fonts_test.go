@@ -0,0 +1,36 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLoadFont(t *testing.T) {
+	custom := bytes.Repeat([]byte{0xAA}, SmallFontSize)
+	full := bytes.Repeat([]byte{0x55}, SmallFontSize+BigFontSize)
+	tests := []struct {
+		name       string
+		font       []uint8
+		small, big []uint8
+	}{
+		{"default", nil, fontSet, bigFontSet},
+		{"small digits only", custom, custom, bigFontSet},
+		{"both sizes", full, full[:SmallFontSize], full[SmallFontSize:]},
+		{"too short", custom[:10], fontSet, bigFontSet},
+		{"a byte short", custom[:SmallFontSize-1], fontSet, bigFontSet},
+		{"between sizes", full[:SmallFontSize+10], fontSet, bigFontSet},
+		{"empty", []uint8{}, fontSet, bigFontSet},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpu := &CPU{Font: tc.font}
+			cpu.Init()
+			if got := cpu.Memory[FontAddress:BigFontAddress]; !bytes.Equal(got, tc.small) {
+				t.Errorf("small digits % X, want % X", got, tc.small)
+			}
+			if got := cpu.Memory[BigFontAddress : BigFontAddress+BigFontSize]; !bytes.Equal(got, tc.big) {
+				t.Errorf("big digits % X, want % X", got, tc.big)
+			}
+		})
+	}
+}
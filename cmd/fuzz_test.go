@@ -0,0 +1,121 @@
+package chip8
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// Instructions a fuzzed ROM runs for, and per 1/60 s tick of the clock
+const (
+	fuzzCycles      = 2000
+	fuzzFrameCycles = 16
+)
+
+// How a fuzzed machine is set up, the bits of the mode argument
+const (
+	fuzzStrict = 1 << iota
+	fuzzBus
+	fuzzHires
+	fuzzBigMemory
+	fuzzQuirks
+)
+
+// mirrorBus is a Bus over plain memory, for the instructions to go through
+// the bus rather than straight to Memory
+type mirrorBus struct {
+	ram RAM
+}
+
+func (b *mirrorBus) Read8(addr int) uint8         { return b.ram.Read8(addr) }
+func (b *mirrorBus) Write8(addr int, value uint8) { b.ram.Write8(addr, value) }
+func (b *mirrorBus) Read16(addr int) uint16       { return b.ram.Read16(addr) }
+
+// FuzzEmulateCycle runs random ROMs with random keys held, on machines set
+// up every way mode allows. Whatever the bytes the machine must not panic,
+// and stop only with the errors EmulateCycle documents.
+func FuzzEmulateCycle(f *testing.F) {
+	// Calls itself until the stack is full, returns from nowhere
+	f.Add([]byte{0x22, 0x00}, []byte{}, uint8(0))
+	f.Add([]byte{0x00, 0xEE}, []byte{}, uint8(0))
+	// Draws at the corner from the end of memory
+	f.Add([]byte{0x60, 0x3F, 0x61, 0x1F, 0xAF, 0xFF, 0xD0, 0x1F}, []byte{}, uint8(fuzzQuirks))
+	// Stores and loads past the end of memory, writes below the load address
+	f.Add([]byte{0xAF, 0xFE, 0xFF, 0x55, 0xFF, 0x65}, []byte{}, uint8(fuzzStrict))
+	f.Add([]byte{0xA1, 0x00, 0xF0, 0x33}, []byte{}, uint8(fuzzStrict|fuzzBus))
+	// Waits for keys and tests them
+	f.Add([]byte{0xF0, 0x0A, 0xE0, 0x9E, 0x12, 0x00}, []byte{0x05, 0x15}, uint8(fuzzBus))
+	// The hires entry, a jump past 4 KB
+	f.Add([]byte{0x12, 0x60, 0x02, 0x30, 0x13, 0x00}, []byte{}, uint8(fuzzHires))
+	f.Add([]byte{0xBF, 0xFF, 0x0F, 0xFF}, []byte{}, uint8(fuzzBigMemory|fuzzQuirks))
+
+	f.Fuzz(func(t *testing.T, rom, keys []byte, mode uint8) {
+		var clock ManualClock
+		cpu := &CPU{
+			Strict:    mode&fuzzStrict != 0,
+			Hires:     mode&fuzzHires != 0,
+			Clock:     &clock,
+			Rand:      rand.New(rand.NewSource(1)),
+			OnInvalid: InvalidStop,
+		}
+		if mode&fuzzBigMemory != 0 {
+			cpu.MemorySize = MaxMemorySize
+		}
+		if mode&fuzzQuirks != 0 {
+			cpu.Quirks = Quirks{ShiftVY: true, IncrementI: true, JumpVX: true, ResetVF: true, WrapX: true, WrapY: true}
+		}
+		cpu.Init()
+		if mode&fuzzBus != 0 {
+			cpu.Bus = &mirrorBus{RAM(cpu.Memory)}
+		}
+		if err := cpu.LoadRomData(rom); err != nil {
+			return
+		}
+
+		defer func() {
+			if v := recover(); v != nil {
+				t.Fatalf("panic at PC %03X running %04X: %v", cpu.Pc, cpu.Opcode, v)
+			}
+		}()
+		for i := 0; i < fuzzCycles; i++ {
+			// Every frame the next byte of keys toggles the key of its low nibble
+			if i%fuzzFrameCycles == 0 {
+				if frame := i / fuzzFrameCycles; frame < len(keys) {
+					cpu.Keypad[keys[frame]&0xF] ^= 1
+				}
+				clock.Advance(1)
+			}
+
+			err := cpu.EmulateCycle()
+			var opcodeErr *OpcodeError
+			var memoryErr *MemoryError
+			var stackErr *StackError
+			switch {
+			case err == nil:
+			case errors.As(err, &opcodeErr):
+				// Skip it, as the headless runner of the frontend does
+				cpu.Pc += 2
+			case errors.As(err, &memoryErr):
+				if !cpu.Strict {
+					t.Fatalf("memory error outside strict mode: %v", err)
+				}
+				return
+			case errors.As(err, &stackErr):
+				sp := cpu.CallDepth()
+				if stackErr.Op == "call" && sp != len(cpu.Stack) || stackErr.Op == "return" && sp != 0 {
+					t.Fatalf("%v with %d subroutines active", err, sp)
+				}
+				return
+			default:
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cpu.CallDepth() > len(cpu.Stack) {
+				t.Fatalf("%d subroutines active, the stack holds %d", cpu.CallDepth(), len(cpu.Stack))
+			}
+			if len(cpu.Framebuffer()) != cpu.Width()*cpu.Height() {
+				t.Fatalf("screen of %d pixels, want %dx%d", len(cpu.Framebuffer()), cpu.Width(), cpu.Height())
+			}
+		}
+	})
+}
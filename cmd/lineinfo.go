@@ -0,0 +1,53 @@
+package chip8
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SourceLine is a line of the source a program was assembled from
+type SourceLine struct {
+	File string
+	Line int
+}
+
+func (l SourceLine) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// LineInfo maps the address of every instruction to the source line it was
+// assembled from
+type LineInfo map[uint16]SourceLine
+
+// ReadLineInfo parses a debug info file, one "<address> <file>:<line>" per
+// line with the address in hex. Lines starting with "#" are comments.
+func ReadLineInfo(r io.Reader) (LineInfo, error) {
+	info := LineInfo{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		addr, location, ok := strings.Cut(text, " ")
+		file, number, found := strings.Cut(strings.TrimSpace(location), ":")
+		if !ok || !found {
+			return nil, fmt.Errorf("line %d: want \"<address> <file>:<line>\", got %q", line, text)
+		}
+
+		a, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(addr), "0x"), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, addr)
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid line number %q", line, number)
+		}
+		info[uint16(a)] = SourceLine{File: file, Line: n}
+	}
+	return info, scanner.Err()
+}
@@ -0,0 +1,485 @@
+package chip8
+
+import "math/rand"
+
+// An opcodeHandler executes the instruction in cpu.Opcode
+type opcodeHandler func(cpu *CPU)
+
+// Decode tables. opcodeTable is indexed by the first nibble of the opcode,
+// the classes holding more than one instruction dispatch again on the
+// remaining bits. Empty entries are unknown opcodes.
+var (
+	opcodeTable = [16]opcodeHandler{
+		0x0: (*CPU).opSystem,
+		0x1: (*CPU).opJump,
+		0x2: (*CPU).opCall,
+		0x3: (*CPU).opSkipEqualByte,
+		0x4: (*CPU).opSkipNotEqualByte,
+		0x5: (*CPU).opSkipEqual,
+		0x6: (*CPU).opLoadByte,
+		0x7: (*CPU).opAddByte,
+		0x8: (*CPU).opALU,
+		0x9: (*CPU).opSkipNotEqual,
+		0xA: (*CPU).opLoadI,
+		0xB: (*CPU).opJumpV0,
+		0xC: (*CPU).opRandom,
+		0xD: (*CPU).opDraw,
+		0xE: (*CPU).opKeys,
+		0xF: (*CPU).opMisc,
+	}
+
+	// 00NN, indexed by NN
+	systemTable = [256]opcodeHandler{
+		0xE0: (*CPU).opClear,
+		0xEE: (*CPU).opReturn,
+	}
+
+	// 8XYN, indexed by N
+	aluTable = [16]opcodeHandler{
+		0x0: (*CPU).opLoad,
+		0x1: (*CPU).opOr,
+		0x2: (*CPU).opAnd,
+		0x3: (*CPU).opXor,
+		0x4: (*CPU).opAdd,
+		0x5: (*CPU).opSub,
+		0x6: (*CPU).opShiftRight,
+		0x7: (*CPU).opSubReverse,
+		0xE: (*CPU).opShiftLeft,
+	}
+
+	// EXNN, indexed by NN
+	keysTable = [256]opcodeHandler{
+		0x9E: (*CPU).opSkipPressed,
+		0xA1: (*CPU).opSkipNotPressed,
+	}
+
+	// FXNN, indexed by NN
+	miscTable = [256]opcodeHandler{
+		0x07: (*CPU).opLoadDelay,
+		0x0A: (*CPU).opWaitKey,
+		0x15: (*CPU).opSetDelay,
+		0x18: (*CPU).opSetSound,
+		0x1E: (*CPU).opAddI,
+		0x29: (*CPU).opLoadFont,
+		0x30: (*CPU).opLoadBigFont,
+		0x33: (*CPU).opStoreBCD,
+		0x55: (*CPU).opStore,
+		0x65: (*CPU).opLoadMemory,
+		0x75: (*CPU).opStoreRPL,
+		0x85: (*CPU).opLoadRPL,
+	}
+)
+
+// dispatch runs the handler of an opcode from table, or reports it as unknown
+func (cpu *CPU) dispatch(table []opcodeHandler, index uint16) {
+	if handler := table[index]; handler != nil {
+		handler(cpu)
+	} else {
+		cpu.unknownOpcode()
+	}
+}
+
+func (cpu *CPU) opSystem() {
+	if cpu.Hires && cpu.Opcode == 0x0230 {
+		// 0230: Clears the screen in hires mode, a routine of the hires patch
+		cpu.opClear()
+		return
+	}
+	if cpu.Opcode&0x0F00 != 0 {
+		// 0NNN: Calls a machine code routine, which can't run here
+		cpu.unknownOpcode()
+		return
+	}
+	cpu.dispatch(systemTable[:], cpu.Opcode&0x00FF)
+}
+
+func (cpu *CPU) opALU() {
+	// Chip-8 ALU (arithmetic logic unit)
+	// Performs arithmetic and bitwise operations.
+	cpu.dispatch(aluTable[:], cpu.Opcode&0x000F) // 0x000F is 0000 0000 0000 1111
+}
+
+func (cpu *CPU) opKeys() {
+	cpu.dispatch(keysTable[:], cpu.Opcode&0x00FF)
+}
+
+func (cpu *CPU) opMisc() {
+	cpu.dispatch(miscTable[:], cpu.Opcode&0x00FF)
+}
+
+// 00E0: Clears the screen
+func (cpu *CPU) opClear() {
+	for i := range cpu.display {
+		cpu.display[i] = 0
+	}
+	cpu.draw()
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 00EE: Returns from subroutine
+func (cpu *CPU) opReturn() {
+	if cpu.Stack_pointer == 0 {
+		cpu.stackFault("return")
+		return
+	}
+	cpu.Stack_pointer = cpu.Stack_pointer - 1
+	cpu.Pc = cpu.Stack[cpu.Stack_pointer]
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 1NNN: Jumps to address NNN
+func (cpu *CPU) opJump() {
+	cpu.Pc = cpu.Opcode & 0x0FFF
+}
+
+// 2NNN: Calls subroutine at NNN.
+func (cpu *CPU) opCall() {
+	if int(cpu.Stack_pointer) >= len(cpu.Stack) {
+		cpu.stackFault("call")
+		return
+	}
+	cpu.Stack[cpu.Stack_pointer] = cpu.Pc
+	cpu.Stack_pointer = cpu.Stack_pointer + 1
+	cpu.Pc = cpu.Opcode & 0x0FFF
+}
+
+// 3XNN: Skips the next instruction if VX equals NN
+func (cpu *CPU) opSkipEqualByte() {
+	if uint16(cpu.V[(cpu.Opcode&0x0F00)>>8]) == (cpu.Opcode & 0x00FF) {
+		cpu.Pc = cpu.Pc + 4 // Skip next instruction
+	} else {
+		cpu.Pc = cpu.Pc + 2
+	}
+}
+
+// 4XNN: Skips the next instruction if VX does not equal NN
+func (cpu *CPU) opSkipNotEqualByte() {
+	if uint16(cpu.V[(cpu.Opcode&0x0F00)>>8]) != (cpu.Opcode & 0x00FF) {
+		cpu.Pc = cpu.Pc + 4 // Skip next instruction
+	} else {
+		cpu.Pc = cpu.Pc + 2
+	}
+}
+
+// 5XY0: Skips the next instruction if VX equals VY
+func (cpu *CPU) opSkipEqual() {
+	if uint16(cpu.V[(cpu.Opcode&0x0F00)>>8]) == uint16(cpu.V[(cpu.Opcode&0x00F0)>>4]) {
+		cpu.Pc = cpu.Pc + 4 // Skip next instruction
+	} else {
+		cpu.Pc = cpu.Pc + 2
+	}
+}
+
+// 6XNN: Sets VX to NN.
+func (cpu *CPU) opLoadByte() {
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = uint8(cpu.Opcode & 0x00FF)
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 7XNN: Adds NN to VX (carry flag is not changed).
+func (cpu *CPU) opAddByte() {
+	cpu.V[(cpu.Opcode&0x0F00)>>8] += uint8(cpu.Opcode & 0x00FF)
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 8XY0: Sets Vx to the value of Vy
+func (cpu *CPU) opLoad() {
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x00F0)>>4]
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 8XY1: Sets VX to VX or VY. (bitwise OR operation)
+func (cpu *CPU) opOr() {
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] | cpu.V[(cpu.Opcode&0x00F0)>>4]
+	cpu.resetVF()
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 8XY2: Sets VX to VX and VY. (bitwise AND operation)
+func (cpu *CPU) opAnd() {
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] & cpu.V[(cpu.Opcode&0x00F0)>>4]
+	cpu.resetVF()
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 8XY3: Sets VX to VX xor VY. (bitwise XOR operation)
+func (cpu *CPU) opXor() {
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.V[(cpu.Opcode&0x0F00)>>8] ^ cpu.V[(cpu.Opcode&0x00F0)>>4]
+	cpu.resetVF()
+	cpu.Pc = cpu.Pc + 2
+}
+
+// resetVF clears VF after the logic instructions with the ResetVF quirk
+func (cpu *CPU) resetVF() {
+	if cpu.Quirks.ResetVF {
+		cpu.V[0xF] = 0
+	}
+}
+
+// shifted returns the register 8XY6 and 8XYE shift, VY with the ShiftVY quirk
+func (cpu *CPU) shifted() uint8 {
+	if cpu.Quirks.ShiftVY {
+		return cpu.V[(cpu.Opcode&0x00F0)>>4]
+	}
+	return cpu.V[(cpu.Opcode&0x0F00)>>8]
+}
+
+// 8XY4: Adds VY to VX. VF is set to 1 when there's a carry, and to 0 when there is not.
+// The flag is written last, so it wins over the sum when X is F.
+func (cpu *CPU) opAdd() {
+	vx, vy := cpu.V[(cpu.Opcode&0x0F00)>>8], cpu.V[(cpu.Opcode&0x00F0)>>4]
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = vx + vy
+	if vy > 0xFF-vx {
+		cpu.V[0xF] = 1 //carry
+	} else {
+		cpu.V[0xF] = 0
+	}
+	cpu.Pc = cpu.Pc + 2 // Because every instruction is 2 bytes long
+}
+
+// 8XY5: VY is subtracted from VX. VF is set to 0 when there's a borrow, and 1 when there is not.
+func (cpu *CPU) opSub() {
+	vx, vy := cpu.V[(cpu.Opcode&0x0F00)>>8], cpu.V[(cpu.Opcode&0x00F0)>>4]
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = vx - vy
+	if vy > vx {
+		cpu.V[0xF] = 0 // There is a borrow
+	} else {
+		cpu.V[0xF] = 1 // No borrow
+	}
+	cpu.Pc = cpu.Pc + 2 // Because every instruction is 2 bytes long
+}
+
+// 8XY6: Shifts VY right by one and stores the result to VX (VY remains unchanged). VF is set to the value of the leaSound_timer significant bit of VY before the shift
+func (cpu *CPU) opShiftRight() {
+	v := cpu.shifted()
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = v >> 1
+	cpu.V[0xF] = v & 0x1
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 8XY7: Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't
+func (cpu *CPU) opSubReverse() {
+	vx, vy := cpu.V[(cpu.Opcode&0x0F00)>>8], cpu.V[(cpu.Opcode&0x00F0)>>4]
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = vy - vx
+	if vx > vy {
+		cpu.V[0xF] = 0
+	} else {
+		cpu.V[0xF] = 1
+	}
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 8XYE: Shifts VY left by one and copies the result to VX. VF is set to the value of the moSound_timer significant bit of VY before the shift
+func (cpu *CPU) opShiftLeft() {
+	v := cpu.shifted()
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = v << 1
+	cpu.V[0xF] = v >> 7
+	cpu.Pc = cpu.Pc + 2
+}
+
+// 9XY0: Skips the next instruction if VX does not equal VY. (Usually the next instruction is a jump to skip a code block);
+func (cpu *CPU) opSkipNotEqual() {
+	if cpu.V[(cpu.Opcode&0x0F00)>>8] != cpu.V[(cpu.Opcode&0x00F0)>>4] {
+		cpu.Pc = cpu.Pc + 4 // Skip the next instruction
+	} else {
+		cpu.Pc = cpu.Pc + 2 // Go to the rightmoSound_timer instruction
+	}
+}
+
+// ANNN: Sets I to the address NNN
+func (cpu *CPU) opLoadI() {
+	cpu.I = cpu.Opcode & 0x0FFF
+	cpu.Pc = cpu.Pc + 2 // Because every instruction is 2 bytes long
+}
+
+// BNNN: Jumps to the address NNN plus V0, or to XNN plus VX with the JumpVX quirk.
+func (cpu *CPU) opJumpV0() {
+	if cpu.Quirks.JumpVX {
+		cpu.Pc = (cpu.Opcode & 0x0FFF) + uint16(cpu.V[(cpu.Opcode&0x0F00)>>8])
+		return
+	}
+	cpu.Pc = (cpu.Opcode & 0x0FFF) + uint16(cpu.V[0x0])
+}
+
+// CXNN: Sets VX to the result of a bitwise and operation on a random number (Typically: 0 to 255) and NN.
+func (cpu *CPU) opRandom() {
+	var n int
+	if cpu.Rand != nil {
+		n = cpu.Rand.Intn(256)
+	} else {
+		n = rand.Intn(256)
+	}
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = uint8(n) & uint8((cpu.Opcode & 0x00FF))
+	cpu.Pc = cpu.Pc + 2
+}
+
+// DXYN: Draws a sprite at coordinate (VX, VY)
+func (cpu *CPU) opDraw() {
+	x := cpu.V[(cpu.Opcode&0x0F00)>>8]
+	y := cpu.V[(cpu.Opcode&0x00F0)>>4]
+	h := cpu.Opcode & 0x000F
+	cpu.V[0xF] = 0
+	var j uint16
+	var i uint16
+	for j = 0; j < h; j++ {
+		pixel := cpu.read(int(cpu.I + j))
+		for i = 0; i < 8; i++ {
+			if (pixel & (0x80 >> i)) != 0 {
+				row, col := int(y+uint8(j)), int(x+uint8(i))
+				if cpu.Quirks.WrapX {
+					col %= cpu.displayWidth
+				}
+				if cpu.Quirks.WrapY {
+					row %= cpu.displayHeight
+				}
+				if row < cpu.displayHeight && col < cpu.displayWidth {
+					if cpu.display[row*cpu.displayWidth+col] == 1 {
+						cpu.V[0xF] = 1
+					}
+					cpu.display[row*cpu.displayWidth+col] ^= 1
+				}
+			}
+		}
+	}
+	cpu.draw()
+	cpu.Pc = cpu.Pc + 2
+}
+
+// pressedKey returns the key EX9E and EXA1 test, VX holds it in its low
+// nibble. Like on the VIP the high one is ignored rather than reaching past
+// the keypad.
+func (cpu *CPU) pressedKey() int {
+	return int(cpu.V[(cpu.Opcode&0x0F00)>>8] & 0xF)
+}
+
+// EX9E: Skips the next instruction if the key stored in VX is pressed
+func (cpu *CPU) opSkipPressed() {
+	key := cpu.pressedKey()
+	cpu.keyRead(key)
+	if cpu.Keypad[key] != 0 {
+		cpu.Pc = cpu.Pc + 4
+	} else {
+		cpu.Pc = cpu.Pc + 2
+	}
+}
+
+// EXA1: Skips the next instruction if the key stored in VX isn't pressed
+func (cpu *CPU) opSkipNotPressed() {
+	key := cpu.pressedKey()
+	cpu.keyRead(key)
+	if cpu.Keypad[key] == 0 {
+		cpu.Pc = cpu.Pc + 4
+	} else {
+		cpu.Pc = cpu.Pc + 2
+	}
+}
+
+// FX07: Sets VX to the value of the delay timer.
+func (cpu *CPU) opLoadDelay() {
+	cpu.V[(cpu.Opcode&0x0F00)>>8] = cpu.Delay_timer
+	cpu.Pc = cpu.Pc + 2
+}
+
+// FX0A: A key press is awaited, and then stored in VX (blocking operation, all instruction halted until next key event).
+func (cpu *CPU) opWaitKey() {
+	cpu.keyRead(-1)
+	pressed := false
+	for i := 0; i < len(cpu.Keypad); i++ {
+		if cpu.Keypad[i] != 0 {
+			cpu.V[(cpu.Opcode&0x0F00)>>8] = uint8(i)
+			pressed = true
+		}
+	}
+	// Until then the same instruction runs again
+	if pressed {
+		cpu.Pc = cpu.Pc + 2
+	}
+}
+
+// FX15: Sets the delay timer to VX.
+func (cpu *CPU) opSetDelay() {
+	cpu.Delay_timer = cpu.V[(cpu.Opcode&0x0F00)>>8]
+	cpu.Pc = cpu.Pc + 2
+}
+
+// FX18: Sets the sound timer to VX.
+func (cpu *CPU) opSetSound() {
+	cpu.Sound_timer = cpu.V[(cpu.Opcode&0x0F00)>>8]
+	cpu.Pc = cpu.Pc + 2
+}
+
+// FX1E: Adds VX to I. VF is not affected.
+func (cpu *CPU) opAddI() {
+	cpu.I = cpu.I + uint16(cpu.V[(cpu.Opcode&0x0F00)>>8])
+	cpu.Pc = cpu.Pc + 2
+}
+
+// FX29: Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
+func (cpu *CPU) opLoadFont() {
+	cpu.I = FontAddress + uint16(cpu.V[(cpu.Opcode&0x0F00)>>8])*0x5
+	cpu.Pc = cpu.Pc + 2
+}
+
+// FX30: Sets I to the location of the big 8x10 sprite for the character in VX, drawn with DXYA (SCHIP).
+func (cpu *CPU) opLoadBigFont() {
+	cpu.I = BigFontAddress + uint16(cpu.V[(cpu.Opcode&0x0F00)>>8])*0xA
+	cpu.Pc = cpu.Pc + 2
+}
+
+// FX33: Stores the binary-coded decimal representation of VX, with the hundreds digit in Memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.
+func (cpu *CPU) opStoreBCD() {
+	cpu.write(int(cpu.I), cpu.V[(cpu.Opcode&0x0F00)>>8]/100)
+	cpu.write(int(cpu.I)+1, (cpu.V[(cpu.Opcode&0x0F00)>>8]/10)%10)
+	cpu.write(int(cpu.I)+2, (cpu.V[(cpu.Opcode&0x0F00)>>8]%100)%10)
+	cpu.Pc = cpu.Pc + 2 // Because every instruction is 2 bytes long
+}
+
+// FX55: Stores from V0 to VX (including VX) in Memory, starting at address I. The offset from I is increased by 1 for each value written, but I itself is left unmodified.
+func (cpu *CPU) opStore() {
+	for i := uint16(0); i <= ((cpu.Opcode & 0x0F00) >> 8); i++ {
+		cpu.write(int(cpu.I+i), cpu.V[i])
+	}
+	cpu.incrementI()
+	cpu.Pc = cpu.Pc + 2
+}
+
+// FX65: Fills from V0 to VX (including VX) with values from Memory, starting at address I. The offset from I is increased by 1 for each value read, but I itself is left unmodified.
+func (cpu *CPU) opLoadMemory() {
+	for i := uint16(0); i <= ((cpu.Opcode & 0x0F00) >> 8); i++ {
+		cpu.V[i] = cpu.read(int(cpu.I + i))
+	}
+	cpu.incrementI()
+	cpu.Pc = cpu.Pc + 2
+}
+
+// incrementI moves I past the registers FX55 and FX65 went through with the IncrementI quirk
+func (cpu *CPU) incrementI() {
+	if cpu.Quirks.IncrementI {
+		cpu.I += (cpu.Opcode&0x0F00)>>8 + 1
+	}
+}
+
+// FX75: Stores V0 to VX (X <= 7) in the RPL user flags.
+func (cpu *CPU) opStoreRPL() {
+	x := (cpu.Opcode & 0x0F00) >> 8
+	if x > 7 {
+		x = 7
+	}
+	for i := uint16(0); i <= x; i++ {
+		cpu.RPL[i] = cpu.V[i]
+	}
+	cpu.RPLFlag = true
+	cpu.Pc = cpu.Pc + 2
+}
+
+// FX85: Fills V0 to VX (X <= 7) with the RPL user flags.
+func (cpu *CPU) opLoadRPL() {
+	x := (cpu.Opcode & 0x0F00) >> 8
+	if x > 7 {
+		x = 7
+	}
+	for i := uint16(0); i <= x; i++ {
+		cpu.V[i] = cpu.RPL[i]
+	}
+	cpu.Pc = cpu.Pc + 2
+}
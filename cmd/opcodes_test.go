@@ -0,0 +1,409 @@
+package chip8
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestCPU returns a machine whose timers only move when the clock is
+// advanced and that stops on unknown opcodes, so a test sees every error
+func newTestCPU(q Quirks) (*CPU, *ManualClock) {
+	clock := &ManualClock{}
+	cpu := &CPU{Quirks: q, Clock: clock, OnInvalid: InvalidStop}
+	cpu.Init()
+	return cpu, clock
+}
+
+// loadProgram assembles opcodes into the memory of cpu at the load address
+func loadProgram(cpu *CPU, program ...uint16) {
+	for i, op := range program {
+		cpu.Memory[LoadAddress+2*i] = byte(op >> 8)
+		cpu.Memory[LoadAddress+2*i+1] = byte(op)
+	}
+}
+
+// light turns on the pixel at x, y of a screen
+func light(display []uint8, x, y int) {
+	display[y*LoresWidth+x] = 1
+}
+
+// opcodeTest runs one opcode on a machine at 0x200 set up by setup. want
+// edits the state from before the opcode into the one expected after it,
+// PC already on the next instruction.
+type opcodeTest struct {
+	name   string
+	opcode uint16
+	quirks Quirks
+	setup  func(cpu *CPU)
+	want   func(s *State)
+	err    error // the error expected, nil for none
+}
+
+var opcodeTests = []opcodeTest{
+	{name: "00E0 clears the screen", opcode: 0x00E0,
+		setup: func(cpu *CPU) { light(cpu.display, 0, 0); light(cpu.display, 63, 31) },
+		want:  func(s *State) { s.Display = make([]uint8, LoresWidth*LoresHeight) }},
+	{name: "00EE returns", opcode: 0x00EE,
+		setup: func(cpu *CPU) { cpu.Stack[0], cpu.Stack_pointer = 0x300, 1 },
+		want:  func(s *State) { s.Pc, s.Stack_pointer = 0x302, 0 }},
+	{name: "00EE with an empty stack", opcode: 0x00EE,
+		want: func(s *State) { s.Pc = 0x200 },
+		err:  &StackError{Op: "return", Pc: 0x200}},
+	{name: "0NNN is unknown", opcode: 0x0123,
+		want: func(s *State) { s.Pc = 0x200 },
+		err:  &OpcodeError{Opcode: 0x0123, Pc: 0x200}},
+	{name: "1NNN jumps", opcode: 0x1345,
+		want: func(s *State) { s.Pc = 0x345 }},
+	{name: "2NNN calls", opcode: 0x2345,
+		want: func(s *State) { s.Pc, s.Stack[0], s.Stack_pointer = 0x345, 0x200, 1 }},
+	{name: "2NNN with a full stack", opcode: 0x2345,
+		setup: func(cpu *CPU) { cpu.Stack_pointer = 16 },
+		want:  func(s *State) { s.Pc = 0x200 },
+		err:   &StackError{Op: "call", Pc: 0x200}},
+
+	{name: "3XNN skips if equal", opcode: 0x3342,
+		setup: func(cpu *CPU) { cpu.V[3] = 0x42 },
+		want:  func(s *State) { s.Pc = 0x204 }},
+	{name: "3XNN doesn't skip if not equal", opcode: 0x3343,
+		setup: func(cpu *CPU) { cpu.V[3] = 0x42 },
+		want:  func(s *State) {}},
+	{name: "4XNN skips if not equal", opcode: 0x4343,
+		setup: func(cpu *CPU) { cpu.V[3] = 0x42 },
+		want:  func(s *State) { s.Pc = 0x204 }},
+	{name: "4XNN doesn't skip if equal", opcode: 0x4342,
+		setup: func(cpu *CPU) { cpu.V[3] = 0x42 },
+		want:  func(s *State) {}},
+	{name: "5XY0 skips if equal", opcode: 0x5120,
+		setup: func(cpu *CPU) { cpu.V[1], cpu.V[2] = 7, 7 },
+		want:  func(s *State) { s.Pc = 0x204 }},
+	{name: "5XY0 doesn't skip if not equal", opcode: 0x5120,
+		setup: func(cpu *CPU) { cpu.V[1], cpu.V[2] = 7, 8 },
+		want:  func(s *State) {}},
+	{name: "9XY0 skips if not equal", opcode: 0x9120,
+		setup: func(cpu *CPU) { cpu.V[1], cpu.V[2] = 7, 8 },
+		want:  func(s *State) { s.Pc = 0x204 }},
+	{name: "9XY0 doesn't skip if equal", opcode: 0x9120,
+		setup: func(cpu *CPU) { cpu.V[1], cpu.V[2] = 7, 7 },
+		want:  func(s *State) {}},
+
+	{name: "6XNN loads", opcode: 0x6A12,
+		want: func(s *State) { s.V[0xA] = 0x12 }},
+	{name: "7XNN adds without a carry", opcode: 0x7102,
+		setup: func(cpu *CPU) { cpu.V[1], cpu.V[0xF] = 0xFF, 5 },
+		want:  func(s *State) { s.V[1] = 1 }},
+
+	{name: "8XY0 loads", opcode: 0x8010,
+		setup: func(cpu *CPU) { cpu.V[1] = 7 },
+		want:  func(s *State) { s.V[0] = 7 }},
+	{name: "8XY1 ors", opcode: 0x8011,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1], cpu.V[0xF] = 0x0F, 0x30, 5 },
+		want:  func(s *State) { s.V[0] = 0x3F }},
+	{name: "8XY1 ors (Reset VF)", opcode: 0x8011, quirks: Quirks{ResetVF: true},
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1], cpu.V[0xF] = 0x0F, 0x30, 5 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0x3F, 0 }},
+	{name: "8XY2 ands", opcode: 0x8012,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1], cpu.V[0xF] = 0x3C, 0x0F, 5 },
+		want:  func(s *State) { s.V[0] = 0x0C }},
+	{name: "8XY2 ands (Reset VF)", opcode: 0x8012, quirks: Quirks{ResetVF: true},
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1], cpu.V[0xF] = 0x3C, 0x0F, 5 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0x0C, 0 }},
+	{name: "8XY3 xors", opcode: 0x8013,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1], cpu.V[0xF] = 0x3C, 0x0F, 5 },
+		want:  func(s *State) { s.V[0] = 0x33 }},
+	{name: "8XY3 xors (Reset VF)", opcode: 0x8013, quirks: Quirks{ResetVF: true},
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1], cpu.V[0xF] = 0x3C, 0x0F, 5 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0x33, 0 }},
+
+	{name: "8XY4 adds", opcode: 0x8014,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1], cpu.V[0xF] = 1, 2, 5 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 3, 0 }},
+	{name: "8XY4 carries", opcode: 0x8014,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 0xFF, 2 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 1, 1 }},
+	{name: "8XY4 into VF keeps the carry", opcode: 0x8F14,
+		setup: func(cpu *CPU) { cpu.V[0xF], cpu.V[1] = 0xFF, 2 },
+		want:  func(s *State) { s.V[0xF] = 1 }},
+	{name: "8XY4 adds VF before the carry", opcode: 0x80F4,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[0xF] = 1, 0xFF },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0, 1 }},
+	{name: "8XY5 subtracts", opcode: 0x8015,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 5, 3 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 2, 1 }},
+	{name: "8XY5 subtracts an equal value without a borrow", opcode: 0x8015,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 4, 4 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0, 1 }},
+	{name: "8XY5 borrows", opcode: 0x8015,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1], cpu.V[0xF] = 3, 5, 1 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0xFE, 0 }},
+	{name: "8XY5 into VF keeps the borrow", opcode: 0x8F15,
+		setup: func(cpu *CPU) { cpu.V[0xF], cpu.V[1] = 5, 3 },
+		want:  func(s *State) { s.V[0xF] = 1 }},
+	{name: "8XY5 subtracts VF before the borrow", opcode: 0x80F5,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[0xF] = 5, 3 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 2, 1 }},
+	{name: "8XY6 shifts VX right", opcode: 0x8016,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 5, 0x10 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 2, 1 }},
+	{name: "8XY6 shifts a 0 out", opcode: 0x8016,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[0xF] = 4, 1 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 2, 0 }},
+	{name: "8XY6 shifts VY right (Shift VY)", opcode: 0x8016, quirks: Quirks{ShiftVY: true},
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 0x10, 5 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 2, 1 }},
+	{name: "8XY6 into VF keeps the bit shifted out", opcode: 0x8F06,
+		setup: func(cpu *CPU) { cpu.V[0xF] = 5 },
+		want:  func(s *State) { s.V[0xF] = 1 }},
+	{name: "8XY7 subtracts VX from VY", opcode: 0x8017,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 3, 5 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 2, 1 }},
+	{name: "8XY7 borrows", opcode: 0x8017,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 5, 3 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0xFE, 0 }},
+	{name: "8XY7 into VF keeps the borrow", opcode: 0x8F17,
+		setup: func(cpu *CPU) { cpu.V[0xF], cpu.V[1] = 3, 5 },
+		want:  func(s *State) { s.V[0xF] = 1 }},
+	{name: "8XYE shifts VX left", opcode: 0x801E,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 0x81, 0x10 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0x02, 1 }},
+	{name: "8XYE shifts a 0 out", opcode: 0x801E,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[0xF] = 0x41, 1 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0x82, 0 }},
+	{name: "8XYE shifts VY left (Shift VY)", opcode: 0x801E, quirks: Quirks{ShiftVY: true},
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[1] = 0x10, 0x81 },
+		want:  func(s *State) { s.V[0], s.V[0xF] = 0x02, 1 }},
+	{name: "8XYE into VF keeps the bit shifted out", opcode: 0x8F0E,
+		setup: func(cpu *CPU) { cpu.V[0xF] = 0x81 },
+		want:  func(s *State) { s.V[0xF] = 1 }},
+	{name: "8XYF is unknown", opcode: 0x801F,
+		want: func(s *State) { s.Pc = 0x200 },
+		err:  &OpcodeError{Opcode: 0x801F, Pc: 0x200}},
+
+	{name: "ANNN loads I", opcode: 0xA123,
+		want: func(s *State) { s.I = 0x123 }},
+	{name: "BNNN jumps to NNN + V0", opcode: 0xB300,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[3] = 4, 2 },
+		want:  func(s *State) { s.Pc = 0x304 }},
+	{name: "BXNN jumps to XNN + VX (Jump to XNN + VX)", opcode: 0xB300, quirks: Quirks{JumpVX: true},
+		setup: func(cpu *CPU) { cpu.V[0], cpu.V[3] = 4, 2 },
+		want:  func(s *State) { s.Pc = 0x302 }},
+	{name: "CXNN masks a random number", opcode: 0xC00F,
+		setup: func(cpu *CPU) { cpu.Rand = rand.New(rand.NewSource(1)) },
+		want: func(s *State) {
+			s.V[0] = uint8(rand.New(rand.NewSource(1)).Intn(256)) & 0x0F
+		}},
+
+	// A sprite of two pixels side by side at 0x300, or one above the other at 0x302
+	{name: "DXYN draws", opcode: 0xD011,
+		setup: func(cpu *CPU) { cpu.I, cpu.Memory[0x300], cpu.V[0], cpu.V[1], cpu.V[0xF] = 0x300, 0xC0, 2, 3, 1 },
+		want: func(s *State) {
+			light(s.Display, 2, 3)
+			light(s.Display, 3, 3)
+			s.V[0xF] = 0
+		}},
+	{name: "DXYN erases and collides", opcode: 0xD011,
+		setup: func(cpu *CPU) {
+			cpu.I, cpu.Memory[0x300], cpu.V[0], cpu.V[1] = 0x300, 0xC0, 2, 3
+			light(cpu.display, 2, 3)
+		},
+		want: func(s *State) {
+			s.Display[3*LoresWidth+2] = 0
+			light(s.Display, 3, 3)
+			s.V[0xF] = 1
+		}},
+	{name: "DXYN clips at the right edge", opcode: 0xD011,
+		setup: func(cpu *CPU) { cpu.I, cpu.Memory[0x300], cpu.V[0], cpu.V[1] = 0x300, 0xC0, 63, 3 },
+		want:  func(s *State) { light(s.Display, 63, 3) }},
+	{name: "DXYN wraps at the right edge (Wrap X)", opcode: 0xD011, quirks: Quirks{WrapX: true},
+		setup: func(cpu *CPU) { cpu.I, cpu.Memory[0x300], cpu.V[0], cpu.V[1] = 0x300, 0xC0, 63, 3 },
+		want: func(s *State) {
+			light(s.Display, 63, 3)
+			light(s.Display, 0, 3)
+		}},
+	{name: "DXYN clips at the bottom edge", opcode: 0xD012,
+		setup: func(cpu *CPU) {
+			cpu.I, cpu.Memory[0x302], cpu.Memory[0x303], cpu.V[0], cpu.V[1] = 0x302, 0x80, 0x80, 5, 31
+		},
+		want: func(s *State) { light(s.Display, 5, 31) }},
+	{name: "DXYN wraps at the bottom edge (Wrap Y)", opcode: 0xD012, quirks: Quirks{WrapY: true},
+		setup: func(cpu *CPU) {
+			cpu.I, cpu.Memory[0x302], cpu.Memory[0x303], cpu.V[0], cpu.V[1] = 0x302, 0x80, 0x80, 5, 31
+		},
+		want: func(s *State) {
+			light(s.Display, 5, 31)
+			light(s.Display, 5, 0)
+		}},
+
+	{name: "EX9E skips if the key is pressed", opcode: 0xE09E,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.Keypad[5] = 5, 1 },
+		want:  func(s *State) { s.Pc = 0x204 }},
+	{name: "EX9E doesn't skip if the key isn't pressed", opcode: 0xE09E,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.Keypad[4] = 5, 1 },
+		want:  func(s *State) {}},
+	{name: "EX9E ignores the high nibble of VX", opcode: 0xE09E,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.Keypad[5] = 0xF5, 1 },
+		want:  func(s *State) { s.Pc = 0x204 }},
+	{name: "EXA1 skips if the key isn't pressed", opcode: 0xE0A1,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.Keypad[4] = 5, 1 },
+		want:  func(s *State) { s.Pc = 0x204 }},
+	{name: "EXA1 doesn't skip if the key is pressed", opcode: 0xE0A1,
+		setup: func(cpu *CPU) { cpu.V[0], cpu.Keypad[5] = 5, 1 },
+		want:  func(s *State) {}},
+
+	{name: "FX07 loads the delay timer", opcode: 0xF107,
+		setup: func(cpu *CPU) { cpu.Delay_timer = 0x30 },
+		want:  func(s *State) { s.V[1] = 0x30 }},
+	{name: "FX0A waits for a key", opcode: 0xF10A,
+		want: func(s *State) { s.Pc = 0x200 }},
+	{name: "FX0A loads the key pressed", opcode: 0xF10A,
+		setup: func(cpu *CPU) { cpu.Keypad[7] = 1 },
+		want:  func(s *State) { s.V[1] = 7 }},
+	{name: "FX15 sets the delay timer", opcode: 0xF115,
+		setup: func(cpu *CPU) { cpu.V[1] = 0x20 },
+		want:  func(s *State) { s.Delay_timer = 0x20 }},
+	{name: "FX18 sets the sound timer", opcode: 0xF118,
+		setup: func(cpu *CPU) { cpu.V[1] = 0x20 },
+		want:  func(s *State) { s.Sound_timer = 0x20 }},
+	{name: "FX1E adds to I", opcode: 0xF01E,
+		setup: func(cpu *CPU) { cpu.I, cpu.V[0], cpu.V[0xF] = 0x100, 5, 7 },
+		want:  func(s *State) { s.I = 0x105 }},
+	{name: "FX29 points I at a digit", opcode: 0xF329,
+		setup: func(cpu *CPU) { cpu.V[3] = 0xA },
+		want:  func(s *State) { s.I = FontAddress + 0xA*5 }},
+	{name: "FX30 points I at a big digit", opcode: 0xF330,
+		setup: func(cpu *CPU) { cpu.V[3] = 2 },
+		want:  func(s *State) { s.I = BigFontAddress + 2*10 }},
+	{name: "FX33 stores the BCD of VX", opcode: 0xF033,
+		setup: func(cpu *CPU) { cpu.I, cpu.V[0] = 0x300, 254 },
+		want:  func(s *State) { copy(s.Memory[0x300:], []uint8{2, 5, 4}) }},
+	{name: "FX33 stores leading zeros", opcode: 0xF033,
+		setup: func(cpu *CPU) { cpu.I, cpu.V[0] = 0x300, 7 },
+		want:  func(s *State) { s.Memory[0x302] = 7 }},
+	{name: "FX55 stores V0 to VX", opcode: 0xF255,
+		setup: func(cpu *CPU) { cpu.I, cpu.V[0], cpu.V[1], cpu.V[2], cpu.V[3] = 0x300, 1, 2, 3, 9 },
+		want:  func(s *State) { copy(s.Memory[0x300:], []uint8{1, 2, 3}) }},
+	{name: "FX55 moves I past the registers (Increment I)", opcode: 0xF255, quirks: Quirks{IncrementI: true},
+		setup: func(cpu *CPU) { cpu.I, cpu.V[0], cpu.V[1], cpu.V[2], cpu.V[3] = 0x300, 1, 2, 3, 9 },
+		want: func(s *State) {
+			copy(s.Memory[0x300:], []uint8{1, 2, 3})
+			s.I = 0x303
+		}},
+	{name: "FX65 loads V0 to VX", opcode: 0xF265,
+		setup: func(cpu *CPU) { cpu.I, cpu.V[3] = 0x300, 9; copy(cpu.Memory[0x300:], []uint8{7, 8, 9, 10}) },
+		want:  func(s *State) { s.V[0], s.V[1], s.V[2] = 7, 8, 9 }},
+	{name: "FX65 moves I past the registers (Increment I)", opcode: 0xF265, quirks: Quirks{IncrementI: true},
+		setup: func(cpu *CPU) { cpu.I, cpu.V[3] = 0x300, 9; copy(cpu.Memory[0x300:], []uint8{7, 8, 9, 10}) },
+		want:  func(s *State) { s.V[0], s.V[1], s.V[2], s.I = 7, 8, 9, 0x303 }},
+	{name: "FXFF is unknown", opcode: 0xF0FF,
+		want: func(s *State) { s.Pc = 0x200 },
+		err:  &OpcodeError{Opcode: 0xF0FF, Pc: 0x200}},
+}
+
+func TestOpcodes(t *testing.T) {
+	for _, tc := range opcodeTests {
+		t.Run(tc.name, func(t *testing.T) {
+			cpu, _ := newTestCPU(tc.quirks)
+			if tc.setup != nil {
+				tc.setup(cpu)
+			}
+			loadProgram(cpu, tc.opcode)
+			want := cpu.SaveState()
+			want.Pc += 2
+			tc.want(&want)
+
+			err := cpu.EmulateCycle()
+			if !reflect.DeepEqual(err, tc.err) {
+				t.Errorf("got error %v, want %v", err, tc.err)
+			}
+			if diff := stateDiff(cpu.SaveState(), want); diff != "" {
+				t.Errorf("%04X:\n%s", tc.opcode, diff)
+			}
+		})
+	}
+}
+
+// FX75 and FX85 keep the flags out of the state saved, they outlive it
+func TestRPLFlags(t *testing.T) {
+	cpu, _ := newTestCPU(Quirks{})
+	loadProgram(cpu, 0xFF75, 0x6000, 0x6100, 0xF185)
+	cpu.V = [16]uint8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	for i := 0; i < 4; i++ {
+		if err := cpu.EmulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && !cpu.RPLFlag {
+			t.Errorf("FX75 didn't set RPLFlag")
+		}
+	}
+	if want := [8]uint8{1, 2, 3, 4, 5, 6, 7, 8}; cpu.RPL != want {
+		t.Errorf("FF75 stored %v, want %v", cpu.RPL, want)
+	}
+	if cpu.V[0] != 1 || cpu.V[1] != 2 || cpu.V[2] != 3 {
+		t.Errorf("F185 loaded V0-V2 = %v, want 1 2 3", cpu.V[:3])
+	}
+}
+
+// stateDiff describes how two states differ, empty if they don't
+func stateDiff(got, want State) string {
+	var b strings.Builder
+	field := func(name string, got, want any) {
+		if !reflect.DeepEqual(got, want) {
+			fmt.Fprintf(&b, "  %s = %X, want %X\n", name, got, want)
+		}
+	}
+	field("PC", got.Pc, want.Pc)
+	field("I", got.I, want.I)
+	for i := range got.V {
+		field(fmt.Sprintf("V%X", i), got.V[i], want.V[i])
+	}
+	field("SP", got.Stack_pointer, want.Stack_pointer)
+	field("stack", got.Stack, want.Stack)
+	field("DT", got.Delay_timer, want.Delay_timer)
+	field("ST", got.Sound_timer, want.Sound_timer)
+	for i := 0; i < min(len(got.Memory), len(want.Memory)); i++ {
+		field(fmt.Sprintf("M[%03X]", i), got.Memory[i], want.Memory[i])
+	}
+	field("memory size", len(got.Memory), len(want.Memory))
+	field("screen size", [2]int{got.DisplayWidth, got.DisplayHeight}, [2]int{want.DisplayWidth, want.DisplayHeight})
+	if len(got.Display) == len(want.Display) {
+		for i := range got.Display {
+			if got.Display[i] != want.Display[i] {
+				fmt.Fprintf(&b, "  pixel %d,%d = %d, want %d\n", i%got.DisplayWidth, i/got.DisplayWidth, got.Display[i], want.Display[i])
+			}
+		}
+	}
+	return b.String()
+}
+
+// A loop running every class of instruction, the way games mix them
+var mixedProgram = []uint16{
+	0x6005, // 200: V0 = 5
+	0x6103, // 202: V1 = 3
+	0x8014, // 204: V0 += V1
+	0x8015, // 206: V0 -= V1
+	0xA300, // 208: I = 300
+	0xF155, // 20A: store V0-V1
+	0xF165, // 20C: load V0-V1
+	0xF033, // 20E: store BCD of V0
+	0x6200, // 210: V2 = 0
+	0xF229, // 212: I = font of V2
+	0xD125, // 214: draw 5 rows at (V1, V2)
+	0x4005, // 216: skip the call unless V0 == 5
+	0x221C, // 218: call 21C
+	0x1204, // 21A: jump 204
+	0x00EE, // 21C: return
+}
+
+func BenchmarkEmulateCycle(b *testing.B) {
+	cpu, _ := newTestCPU(Quirks{})
+	loadProgram(cpu, mixedProgram...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := cpu.EmulateCycle(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+}
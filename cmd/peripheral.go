@@ -0,0 +1,62 @@
+package chip8
+
+// Peripheral is a device plugged into the CPU with Attach, like the sound
+// board of the CHIP-8X. Tick is called every 1/60 s the timers count down,
+// frame by frame. Devices can also take a range of memory, see Mapped, or
+// run opcodes the interpreter doesn't know, see OpcodeRunner.
+type Peripheral interface {
+	Tick(cpu *CPU)
+}
+
+// Mapped is a peripheral answering the reads and writes of the addresses
+// Region returns, from start up to end excluded, in place of memory. Opcode
+// fetches still go to memory.
+type Mapped interface {
+	Peripheral
+	Region() (start, end int)
+	Read8(addr int) uint8
+	Write8(addr int, value uint8)
+}
+
+// OpcodeRunner is a peripheral implementing opcodes of its own. Unknown
+// opcodes, 0NNN calls of machine code included, are offered to it before
+// OnInvalid applies. Run reports whether it took the opcode, in which case
+// it moves PC on itself like the built-in instructions do.
+type OpcodeRunner interface {
+	Peripheral
+	Run(cpu *CPU, opcode uint16) bool
+}
+
+// Attach plugs a peripheral into the CPU, it stays through Init
+func (cpu *CPU) Attach(p Peripheral) {
+	cpu.peripherals = append(cpu.peripherals, p)
+	if m, ok := p.(Mapped); ok {
+		cpu.mapped = append(cpu.mapped, m)
+	}
+}
+
+// Peripherals returns the devices attached to the CPU, in the order they were
+func (cpu *CPU) Peripherals() []Peripheral {
+	return cpu.peripherals
+}
+
+// device returns the peripheral mapped at addr, or nil for memory
+func (cpu *CPU) device(addr int) Mapped {
+	for _, m := range cpu.mapped {
+		if start, end := m.Region(); addr >= start && addr < end {
+			return m
+		}
+	}
+	return nil
+}
+
+// runPeripheral offers an unknown opcode to the peripherals, it reports
+// whether one of them ran it
+func (cpu *CPU) runPeripheral() bool {
+	for _, p := range cpu.peripherals {
+		if r, ok := p.(OpcodeRunner); ok && r.Run(cpu, cpu.Opcode) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package chip8
+
+// Quirks are the behaviours the CHIP-8 interpreters of old disagree on. The
+// zero value is how this emulator always ran programs, which suits most of
+// the programs written since the 1990s; the COSMAC VIP ran them otherwise.
+type Quirks struct {
+	// ShiftVY makes 8XY6 and 8XYE shift VY into VX, as the VIP did,
+	// rather than shift VX in place
+	ShiftVY bool `json:"shift_vy"`
+
+	// IncrementI leaves I past the last register FX55 and FX65 stored or
+	// loaded, as the VIP did, rather than where it was
+	IncrementI bool `json:"increment_i"`
+
+	// JumpVX makes BXNN jump to XNN plus VX, as SCHIP did, rather than
+	// BNNN jump to NNN plus V0
+	JumpVX bool `json:"jump_vx"`
+
+	// ResetVF makes 8XY1, 8XY2 and 8XY3 clear VF, as the VIP did
+	ResetVF bool `json:"reset_vf"`
+
+	// WrapX draws the parts of sprites past the right edge of the screen at
+	// the left one, rather than clip them
+	WrapX bool `json:"wrap_x"`
+
+	// WrapY draws the parts of sprites past the bottom edge of the screen
+	// at the top, rather than clip them. Some games need one wrap but not
+	// the other.
+	WrapY bool `json:"wrap_y"`
+}
@@ -0,0 +1,95 @@
+package chip8
+
+import (
+	"sort"
+	"strings"
+)
+
+// RomInfo is what can be told about a ROM without running it. Every word of
+// the ROM is counted as an instruction, sprites and other data included, so
+// the numbers are estimates.
+type RomInfo struct {
+	Size int
+
+	// Machine is the one the ROM most likely needs: chip8, hires, schip or xo-chip
+	Machine string
+
+	// How often every mnemonic appears, DW for words that aren't instructions
+	Opcodes map[string]int
+
+	// The SCHIP and XO-CHIP instructions found, like 00FF or FX30
+	SCHIP, XOCHIP []string
+}
+
+// An opcodePattern matches the opcodes of an instruction, written like 00CN
+type opcodePattern struct {
+	mask, value uint16
+	pattern     string
+}
+
+// Instructions added by SCHIP and XO-CHIP
+var (
+	schipOpcodes = []opcodePattern{
+		{0xFFF0, 0x00C0, "00CN"},
+		{0xFFFF, 0x00FB, "00FB"},
+		{0xFFFF, 0x00FC, "00FC"},
+		{0xFFFF, 0x00FD, "00FD"},
+		{0xFFFF, 0x00FE, "00FE"},
+		{0xFFFF, 0x00FF, "00FF"},
+		{0xF00F, 0xD000, "DXY0"},
+		{0xF0FF, 0xF030, "FX30"},
+		{0xF0FF, 0xF075, "FX75"},
+		{0xF0FF, 0xF085, "FX85"},
+	}
+	xochipOpcodes = []opcodePattern{
+		{0xFFF0, 0x00D0, "00DN"},
+		{0xF00F, 0x5002, "5XY2"},
+		{0xF00F, 0x5003, "5XY3"},
+		{0xFFFF, 0xF000, "F000"},
+		{0xF0FF, 0xF001, "FN01"},
+		{0xFFFF, 0xF002, "F002"},
+		{0xF0FF, 0xF03A, "FX3A"},
+	}
+)
+
+// AnalyzeRom looks through the instructions of a ROM
+func AnalyzeRom(data []byte) RomInfo {
+	info := RomInfo{Size: len(data), Opcodes: map[string]int{}}
+	schip, xochip := map[string]bool{}, map[string]bool{}
+	for i := 0; i+1 < len(data); i += 2 {
+		opcode := uint16(data[i])<<8 | uint16(data[i+1])
+		info.Opcodes[strings.Fields(Disassemble(opcode))[0]]++
+		for _, o := range schipOpcodes {
+			if opcode&o.mask == o.value {
+				schip[o.pattern] = true
+			}
+		}
+		for _, o := range xochipOpcodes {
+			if opcode&o.mask == o.value {
+				xochip[o.pattern] = true
+			}
+		}
+	}
+	info.SCHIP, info.XOCHIP = sortedKeys(schip), sortedKeys(xochip)
+
+	switch {
+	case len(data) >= 2 && uint16(data[0])<<8|uint16(data[1]) == HiresEntry:
+		info.Machine = "hires"
+	case len(info.XOCHIP) > 0 || len(data) > DefaultMemorySize-LoadAddress:
+		info.Machine = "xo-chip"
+	case len(info.SCHIP) > 0:
+		info.Machine = "schip"
+	default:
+		info.Machine = "chip8"
+	}
+	return info
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package chip8
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"hash/fnv"
+	"io"
+)
+
+// State is a snapshot of the machine, everything needed to resume a program
+// exactly where it was left.
+type State struct {
+	Memory        []uint8
+	V             [16]uint8
+	I             uint16
+	Pc            uint16
+	Delay_timer   uint8
+	Sound_timer   uint8
+	Display       []uint8
+	DisplayWidth  int
+	DisplayHeight int
+	Stack_pointer uint8
+	Stack         [16]uint16
+}
+
+// SaveState takes a snapshot of the current machine state.
+func (cpu *CPU) SaveState() State {
+	return State{
+		Memory:        append([]uint8(nil), cpu.Memory...),
+		V:             cpu.V,
+		I:             cpu.I,
+		Pc:            cpu.Pc,
+		Delay_timer:   cpu.Delay_timer,
+		Sound_timer:   cpu.Sound_timer,
+		Display:       append([]uint8(nil), cpu.display...),
+		DisplayWidth:  cpu.displayWidth,
+		DisplayHeight: cpu.displayHeight,
+		Stack_pointer: cpu.Stack_pointer,
+		Stack:         cpu.Stack,
+	}
+}
+
+// LoadState restores a snapshot previously taken with SaveState.
+func (cpu *CPU) LoadState(s State) {
+	cpu.Memory = append([]uint8(nil), s.Memory...)
+	cpu.V = s.V
+	cpu.I = s.I
+	cpu.Pc = s.Pc
+	cpu.Delay_timer = s.Delay_timer
+	cpu.Sound_timer = s.Sound_timer
+	cpu.display = append([]uint8(nil), s.Display...)
+	cpu.displayWidth, cpu.displayHeight = s.DisplayWidth, s.DisplayHeight
+	cpu.Stack_pointer = s.Stack_pointer
+	cpu.Stack = s.Stack
+
+	// Redraw the restored screen
+	cpu.DrawFlag = true
+}
+
+// Hash returns an FNV-1a hash of the registers, the timers, the stack, the
+// memory and the display. Two machines that ran the same program with the
+// same keys hash the same, the first frame they don't is where they desynced.
+func (cpu *CPU) Hash() uint64 {
+	h := fnv.New64a()
+	h.Write(cpu.V[:])
+	binary.Write(h, binary.BigEndian, []uint16{cpu.I, cpu.Pc})
+	h.Write([]uint8{cpu.Delay_timer, cpu.Sound_timer, cpu.Stack_pointer})
+	binary.Write(h, binary.BigEndian, cpu.Stack)
+	h.Write(cpu.Memory)
+	h.Write(cpu.display)
+	return h.Sum64()
+}
+
+// WriteState serializes a snapshot to w.
+func WriteState(w io.Writer, s State) error {
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// ReadState deserializes a snapshot written by WriteState.
+func ReadState(r io.Reader) (State, error) {
+	var s State
+	err := gob.NewDecoder(r).Decode(&s)
+	return s, err
+}
@@ -0,0 +1,58 @@
+package chip8
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Symbols names addresses of a program, so disassembly can show labels
+type Symbols map[uint16]string
+
+// ReadSymbols parses a symbol file. Every line names one address, either as
+// "<address> <label>" like map files do or as "<label> = <address>" like
+// Octo constants. Addresses are hex, with or without 0x. Lines starting with
+// "#" or ";" are comments.
+func ReadSymbols(r io.Reader) (Symbols, error) {
+	symbols := Symbols{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+
+		var label, addr string
+		if before, after, ok := strings.Cut(text, "="); ok {
+			label, addr = strings.TrimSpace(before), strings.TrimSpace(after)
+		} else if fields := strings.Fields(text); len(fields) == 2 {
+			addr, label = fields[0], fields[1]
+		} else {
+			return nil, fmt.Errorf("line %d: want \"<address> <label>\" or \"<label> = <address>\"", line)
+		}
+
+		label = strings.TrimPrefix(strings.TrimSuffix(label, ":"), ":")
+		v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(addr), "0x"), 16, 16)
+		if err != nil || label == "" {
+			return nil, fmt.Errorf("line %d: invalid symbol %q", line, text)
+		}
+		symbols[uint16(v)] = label
+	}
+	return symbols, scanner.Err()
+}
+
+// Label returns the name of an address, or the address in hex if it has none
+func (s Symbols) Label(addr uint16) string {
+	if label, ok := s[addr]; ok {
+		return label
+	}
+	return fmt.Sprintf("%03X", addr)
+}
+
+// Disassemble is like the Disassemble function, with labels in place of the
+// addresses that have one.
+func (s Symbols) Disassemble(opcode uint16) string {
+	return disassemble(opcode, s.Label)
+}
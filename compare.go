@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+)
+
+// The colors of the diff image of chip8 compare: pixels lit by this
+// emulator only are red, pixels lit in the golden image only are blue
+var (
+	diffOnlyHere   = color.RGBA{R: 0xFF, G: 0x40, B: 0x40, A: 0xFF}
+	diffOnlyGolden = color.RGBA{R: 0x40, G: 0x60, B: 0xFF, A: 0xFF}
+)
+
+// runCompare runs a ROM to a frame and compares the screen with an image,
+// which another emulator may have taken at any whole scale. It writes an
+// image of the differences and fails if there are any.
+func runCompare(args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	frames := flags.Int("frames", 600, "frame to compare the screen at")
+	golden := flags.String("golden", "", "PNG image the screen should match")
+	out := flags.String("diff", "diff.png", "where to write the image of the differences")
+	scale := flags.Int("scale", 8, "size of the pixels of the diff image")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: chip8 compare <rom> -golden <image.png> [options]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// The options may come after the ROM as well
+	rest := flags.Args()
+	if len(rest) > 1 {
+		if err := flags.Parse(rest[1:]); err != nil {
+			return err
+		}
+		rest = append(rest[:1], flags.Args()...)
+	}
+	if len(rest) != 1 || *golden == "" {
+		flags.Usage()
+		return errors.New("want a ROM and a -golden image")
+	}
+	if *frames <= 0 {
+		return fmt.Errorf("invalid number of frames %d", *frames)
+	}
+	if *scale < 1 {
+		return fmt.Errorf("invalid diff scale %d", *scale)
+	}
+
+	data, err := os.ReadFile(rest[0])
+	if err != nil {
+		return err
+	}
+	h, err := newHeadless(data)
+	if err != nil {
+		return err
+	}
+	if n, err := h.run(*frames); err != nil {
+		return fmt.Errorf("crashed at frame %d: %w", n, err)
+	}
+	frame := cpuFrame(&h.cpu)
+
+	f, err := os.Open(*golden)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *golden, err)
+	}
+	lit := goldenPixels(img, frame.Width, frame.Height)
+	if lit == nil {
+		b := img.Bounds()
+		return fmt.Errorf("%s is %dx%d, not a whole multiple of the %dx%d screen", *golden, b.Dx(), b.Dy(), frame.Width, frame.Height)
+	}
+
+	diff, differ := diffImage(frame, lit, *scale)
+	w, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if err := png.Encode(w, diff); err != nil {
+		return err
+	}
+	if differ > 0 {
+		return fmt.Errorf("%d pixels differ from %s, see %s", differ, *golden, *out)
+	}
+	fmt.Printf("%s matches %s at frame %d\n", rest[0], *golden, *frames)
+	return nil
+}
+
+// diffImage draws a frame with the pixels that differ from lit in color and
+// returns it along with how many differ
+func diffImage(frame Frame, lit []bool, scale int) (*image.Paletted, int) {
+	palette := color.Palette{color.Black, color.White, diffOnlyHere, diffOnlyGolden}
+	img := image.NewPaletted(image.Rect(0, 0, frame.Width*scale, frame.Height*scale), palette)
+	differ := 0
+	for i, p := range frame.Pixels {
+		index := p
+		switch {
+		case p != 0 && !lit[i]:
+			index, differ = 2, differ+1
+		case p == 0 && lit[i]:
+			index, differ = 3, differ+1
+		}
+		x, y := i%frame.Width*scale, i/frame.Width*scale
+		for dy := 0; dy < scale; dy++ {
+			for dx := 0; dx < scale; dx++ {
+				img.SetColorIndex(x+dx, y+dy, index)
+			}
+		}
+	}
+	return img, differ
+}
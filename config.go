@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Flags that only make sense for a single run, they aren't read from or written to the config file
+var configSkipped = map[string]bool{"bench": true, "preset": true, "rom": true, "version": true, "watch": true}
+
+// configPath returns where the config file is kept, in $XDG_CONFIG_HOME/chip8
+// (or its equivalent on other systems)
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "config.toml"), nil
+}
+
+// readConfig parses a config file. It is the simple part of TOML: "name =
+// value" lines, where the names are those of the command line options and
+// the values are strings, numbers or booleans. Tables like [display] only
+// group settings, and "#" starts a comment.
+func readConfig(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || (strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]")) {
+			continue
+		}
+
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want \"name = value\", got %q", line, text)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		v, err := configValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		values[name] = v
+	}
+	return values, scanner.Err()
+}
+
+// configValue returns the value of a setting without its quotes or trailing comment
+func configValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		// A basic string, with escapes
+		end := 1
+		for ; end < len(value) && value[end] != '"'; end++ {
+			if value[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(value) {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after string", rest)
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		// A literal string, taken as is
+		s, rest, ok := strings.Cut(value[1:], "'")
+		if !ok {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after string", rest)
+		}
+		return s, nil
+	}
+	value, _, _ = strings.Cut(value, "#")
+	if value = strings.TrimSpace(value); value == "" {
+		return "", errors.New("missing value")
+	}
+	return value, nil
+}
+
+// Where the value of an option came from, later ones win
+const (
+	fromDefault     = "default"
+	fromConfig      = "config file"
+	fromEnv         = "environment"
+	fromCommandLine = "command line"
+)
+
+// Where every option got its value, filled in by resolveOptions
+var optionOrigins = map[string]string{}
+
+// envName returns the environment variable setting an option, like CHIP8_LOG_LEVEL for -log-level
+func envName(option string) string {
+	return "CHIP8_" + strings.ToUpper(strings.ReplaceAll(option, "-", "_"))
+}
+
+// resolveOptions parses the command line, then gives the options it didn't
+// set their value from the environment or else from the config file.
+func resolveOptions(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	flags.VisitAll(func(f *flag.Flag) {
+		optionOrigins[f.Name] = fromDefault
+	})
+	flags.Visit(func(f *flag.Flag) {
+		optionOrigins[f.Name] = fromCommandLine
+	})
+
+	values, path, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		if flags.Lookup(name) == nil || configSkipped[name] {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+		if optionOrigins[name] == fromCommandLine {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+		optionOrigins[name] = fromConfig
+	}
+
+	var envErr error
+	flags.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || configSkipped[f.Name] || optionOrigins[f.Name] == fromCommandLine || envErr != nil {
+			return
+		}
+		if err := flags.Set(f.Name, value); err != nil {
+			envErr = fmt.Errorf("%s: %w", envName(f.Name), err)
+			return
+		}
+		optionOrigins[f.Name] = fromEnv
+	})
+	return envErr
+}
+
+// loadConfig reads the config file, if there is one
+func loadConfig() (map[string]string, string, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, path, nil
+		}
+		return nil, path, err
+	}
+	defer f.Close()
+
+	values, err := readConfig(f)
+	if err != nil {
+		return nil, path, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, path, nil
+}
+
+// writeConfig stores the current options as the config file, every one of
+// them with its description so the file is easy to edit
+func writeConfig(flags *flag.FlagSet) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("# chip8 settings, CHIP8_* environment variables and the command line override them\n")
+	flags.VisitAll(func(f *flag.Flag) {
+		if configSkipped[f.Name] {
+			return
+		}
+		fmt.Fprintf(&b, "\n# %s\n%s\n", f.Usage, configLine(f))
+	})
+	return path, os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// saveSetting stores the current value of one option in the config file,
+// for settings changed while playing. The rest of the file is kept as is.
+func saveSetting(flags *flag.FlagSet, name string) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	line := configLine(flags.Lookup(name))
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	found := false
+	for i, text := range lines {
+		if n, _, ok := strings.Cut(text, "="); ok && strings.TrimSpace(n) == name && !strings.HasPrefix(strings.TrimSpace(text), "#") {
+			lines[i], found = line, true
+		}
+	}
+	if !found {
+		// Before the first table, where the setting isn't grouped
+		at := len(lines)
+		for i, text := range lines {
+			if t := strings.TrimSpace(text); strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+				at = i
+				break
+			}
+		}
+		lines = append(lines[:at], append([]string{line}, lines[at:]...)...)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.TrimPrefix(strings.Join(lines, "\n"), "\n")+"\n"), 0644)
+}
+
+// configLine writes an option the way the config file does
+func configLine(f *flag.Flag) string {
+	value := f.Value.String()
+	if getter, ok := f.Value.(flag.Getter); !ok {
+		value = strconv.Quote(value)
+	} else if _, ok := getter.Get().(string); ok {
+		value = strconv.Quote(value)
+	}
+	return f.Name + " = " + value
+}
+
+// runConfig handles the config command
+func runConfig(args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "write":
+		path, err := writeConfig(flag.CommandLine)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Wrote", path)
+	case len(args) == 1 && args[0] == "show":
+		flag.CommandLine.VisitAll(func(f *flag.Flag) {
+			if configSkipped[f.Name] {
+				return
+			}
+			origin := optionOrigins[f.Name]
+			if origin == fromEnv {
+				origin += " " + envName(f.Name)
+			}
+			fmt.Printf("%-40s # %s\n", configLine(f), origin)
+		})
+	default:
+		return errors.New("usage: chip8 [options] config show|write")
+	}
+	return nil
+}
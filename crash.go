@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Number of executed instructions kept for crash reports
+const traceLength = 100
+
+type traceEntry struct {
+	pc, opcode uint16
+}
+
+// PanicError is a panic caught while emulating, along with the crash report written for it
+type PanicError struct {
+	Value  any
+	Report string // path of the crash report, empty if it couldn't be written
+}
+
+func (e *PanicError) Error() string {
+	if e.Report == "" {
+		return fmt.Sprintf("emulator crashed: %v", e.Value)
+	}
+	return fmt.Sprintf("emulator crashed: %v\nCrash report: %s", e.Value, e.Report)
+}
+
+// trace records the instruction about to run
+func (inst *Instance) trace() {
+	inst.traced[inst.traceNext%traceLength] = traceEntry{inst.CPU.Pc, inst.CPU.NextOpcode()}
+	inst.traceNext++
+}
+
+// SafeStep runs Step, turning a panic into a PanicError after writing a crash report
+func (inst *Instance) SafeStep() (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			report, werr := inst.writeCrashReport(v, debug.Stack())
+			if werr != nil {
+				report = ""
+			}
+			err = &PanicError{Value: v, Report: report}
+		}
+	}()
+	return inst.Step()
+}
+
+func crashDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "crashes"), nil
+}
+
+// writeCrashReport stores the machine state of a crash and returns where
+func (inst *Instance) writeCrashReport(value any, stack []byte) (string, error) {
+	dir, err := crashDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Panic: %v\n\n", value)
+	d := inst.dump()
+	if err := d.WriteReport(&b); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "\nGo stack\n%s", stack)
+
+	// Named after the time, CreateTemp tells apart crashes in the same second
+	f, err := os.CreateTemp(dir, time.Now().Format("crash-20060102-150405-*.txt"))
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Symbol and debug info files sit next to their ROM, named after it with these suffixes
+const (
+	symbolsSuffix  = ".sym"
+	lineInfoSuffix = ".dbg"
+
+	// Octo sources, which debug info files refer to
+	sourceSuffix = ".8o"
+)
+
+// Width of the debugger panel on the right of the window, in window pixels
+const debugPanelWidth = 360
+
+var yellow = sdl.Color{R: 255, G: 255, B: 0, A: 255}
+
+// Debugger is the panel showing the machine while it runs or is paused, along
+// with the watches the player set up for the ROM.
+type Debugger struct {
+	Visible bool
+
+	hash    string
+	watches []*Watch
+
+	// Labels of the ROM from its symbol file, if any
+	symbols chip8.Symbols
+
+	// Source lines of the ROM from its debug info file, if any, and the
+	// source files read so far
+	lines   chip8.LineInfo
+	sources map[string][]string
+
+	// A watch being typed in, and the outcome of the last command
+	entering bool
+	entry    string
+	message  string
+}
+
+// load reads the watches kept for the ROM and the symbol file next to it
+func (d *Debugger) load(romName, hash string) {
+	d.hash = hash
+	watches, err := readWatches(hash)
+	if err != nil {
+		slog.Error("Failed to read watches", "err", err)
+	}
+	d.watches = watches
+
+	d.symbols = nil
+	if f, err := openRomFile(romName + symbolsSuffix); err == nil {
+		defer f.Close()
+		if d.symbols, err = chip8.ReadSymbols(f); err != nil {
+			slog.Error("Failed to read symbols", "rom", romName, "err", err)
+		}
+	}
+
+	d.lines, d.sources = nil, map[string][]string{}
+	if f, err := openRomFile(romName + lineInfoSuffix); err == nil {
+		defer f.Close()
+		if d.lines, err = chip8.ReadLineInfo(f); err != nil {
+			slog.Error("Failed to read debug info", "rom", romName, "err", err)
+		}
+	}
+}
+
+// sourceText returns the text of a source line, source files are looked up in the roms directory
+func (d *Debugger) sourceText(line chip8.SourceLine) string {
+	text, ok := d.sources[line.File]
+	if !ok {
+		data, err := readRomFile(line.File)
+		if err != nil {
+			slog.Error("Failed to read source", "file", line.File, "err", err)
+		}
+		text = strings.Split(string(data), "\n")
+		d.sources[line.File] = text
+	}
+	if line.Line < 1 || line.Line > len(text) {
+		return ""
+	}
+	return strings.TrimSpace(text[line.Line-1])
+}
+
+func (d *Debugger) saveWatches() {
+	if err := writeWatches(d.hash, d.watches); err != nil {
+		slog.Error("Failed to save watches", "err", err)
+	}
+}
+
+// addWatch adds a watch and saves the watches of the ROM
+func (d *Debugger) addWatch(text string) error {
+	w, err := parseWatch(text)
+	if err != nil {
+		return err
+	}
+	d.watches = append(d.watches, w)
+	d.saveWatches()
+	return nil
+}
+
+// HandleEvent handles the debugger keys, it reports whether the event was used
+func (d *Debugger) HandleEvent(event sdl.Event, inst *Instance) bool {
+	// While a watch is typed the keyboard belongs to the debugger
+	if d.entering {
+		switch t := event.(type) {
+		case *sdl.TextInputEvent:
+			d.entry += t.GetText()
+			return true
+		case *sdl.KeyboardEvent:
+			if t.Type != sdl.KEYDOWN {
+				return true
+			}
+			switch t.Keysym.Sym {
+			case sdl.K_ESCAPE:
+				d.entering = false
+			case sdl.K_BACKSPACE:
+				if d.entry != "" {
+					d.entry = d.entry[:len(d.entry)-1]
+				}
+			case sdl.K_RETURN, sdl.K_KP_ENTER:
+				d.entering = false
+				if err := d.addWatch(strings.TrimSpace(d.entry)); err != nil {
+					d.message = err.Error()
+					break
+				}
+				d.message = ""
+			}
+			return true
+		}
+		return false
+	}
+
+	t, ok := event.(*sdl.KeyboardEvent)
+	if !ok || t.Type != sdl.KEYDOWN {
+		return false
+	}
+	switch {
+	case keyShowChanges.Is(t.Keysym):
+		showChanges = !showChanges
+		notify(onOff("Changed pixels", showChanges))
+		d.Visible = true
+	case keyDebugger.Is(t.Keysym):
+		d.Visible = !d.Visible
+	case keyDump.Is(t.Keysym):
+		path, err := inst.writeDump()
+		if err != nil {
+			d.Visible, d.message = true, err.Error()
+			return true
+		}
+		notify("Machine state dumped to %s", path)
+	case keyPause.Is(t.Keysym), t.Keysym.Sym == keyStep.Key:
+		if inst.Net != nil {
+			d.Visible, d.message = true, "can't pause during netplay"
+			return true
+		}
+		if t.Keysym.Sym == keyStep.Key {
+			inst.Paused, d.Visible, d.message = true, true, ""
+			d.step(inst, t.Keysym.Mod)
+			return true
+		}
+		// Break or continue, a step in progress is cut short
+		inst.Paused = !inst.Paused || inst.breakAt != nil
+		inst.breakAt = nil
+		d.Visible = true
+	case t.Keysym.Sym == keyWatch.Key:
+		if !d.Visible {
+			return false
+		}
+		if t.Keysym.Mod&sdl.KMOD_SHIFT != 0 {
+			if len(d.watches) > 0 {
+				d.watches = d.watches[:len(d.watches)-1]
+				d.saveWatches()
+			}
+			return true
+		}
+		d.entering, d.entry, d.message = true, "", ""
+		// Don't type the key itself into the watch
+		sdl.FlushEvent(sdl.TEXTINPUT)
+	default:
+		return false
+	}
+	return true
+}
+
+// step runs a single instruction, or a source line if the ROM has debug info
+// (<Alt> still steps an instruction). With <Shift> a subroutine call runs
+// until it returns, with <Ctrl> the current subroutine runs until it returns.
+func (d *Debugger) step(inst *Instance, mod uint16) {
+	cpu := &inst.CPU
+	depth := cpu.CallDepth()
+	switch {
+	case mod&sdl.KMOD_CTRL != 0:
+		// Step out
+		if depth == 0 {
+			d.message = "not in a subroutine"
+			return
+		}
+		inst.breakAt = func() bool { return cpu.CallDepth() < depth }
+	case mod&sdl.KMOD_SHIFT != 0 && cpu.NextOpcode()&0xF000 == 0x2000:
+		// Step over the call, until the stack is back to where it is now
+		inst.breakAt = func() bool { return cpu.CallDepth() <= depth }
+	case mod&sdl.KMOD_ALT == 0 && d.lines != nil:
+		// Step to the next source line
+		start, ok := d.lines[cpu.Pc]
+		inst.breakAt = func() bool {
+			line, known := d.lines[cpu.Pc]
+			return known && (!ok || line != start)
+		}
+	default:
+		inst.breakAt = func() bool { return true }
+	}
+}
+
+// Draw draws the panel into rect
+func (d *Debugger) Draw(renderer *sdl.Renderer, texts *TextCache, inst *Instance, rect sdl.Rect) {
+	renderer.SetDrawColor(16, 16, 16, 255)
+	renderer.FillRect(&rect)
+
+	cpu := &inst.CPU
+	lineHeight := int32(fontSize) + 2
+	y := rect.Y + 8
+	line := func(text string, color sdl.Color) {
+		if y+lineHeight > rect.Y+rect.H {
+			return
+		}
+		if text != "" {
+			if _, _, err := texts.Draw(text, color, rect.X+8, y); err != nil {
+				slog.Error("Failed to render text", "err", err)
+			}
+		}
+		y += lineHeight
+	}
+
+	status := fmt.Sprintf("RUNNING  <%s> break", keyPause)
+	if inst.Paused {
+		status = fmt.Sprintf("PAUSED  <%s> go <%s> step", keyPause, keyStep)
+		if inst.breakAt != nil {
+			status = fmt.Sprintf("STEPPING  <%s> break", keyPause)
+		}
+	}
+	line(status, yellow)
+	line(fmt.Sprintf("PC %03X  I %03X  SP %d", cpu.Pc, cpu.I, cpu.Stack_pointer), white)
+	line(fmt.Sprintf("DT %02X  ST %02X", cpu.DelayTimer(), cpu.SoundTimer()), white)
+	for row := 0; row < 4; row++ {
+		v := cpu.V[row*4 : row*4+4]
+		line(fmt.Sprintf("V%X-%X %02X %02X %02X %02X", row*4, row*4+3, v[0], v[1], v[2], v[3]), white)
+	}
+
+	// The 16 bytes at I, which FX33, FX55, FX65 and DXYN work on, and the
+	// sprite they make on the right
+	drawSprite(renderer, cpu, int(cpu.I), rect.X+rect.W-8-8*debugSpritePixel, y+2)
+	for row := 0; row < 2; row++ {
+		hex := make([]string, 8)
+		for i := range hex {
+			hex[i] = fmt.Sprintf("%02X", peek(cpu, int(cpu.I)+row*8+i))
+		}
+		line(strings.Join(hex, " "), white)
+	}
+
+	// The source line at PC
+	line("", white)
+	if source, ok := d.lines[cpu.Pc]; ok {
+		line(source.String(), yellow)
+		line(d.sourceText(source), white)
+	}
+
+	// The code around PC
+	for addr := int(cpu.Pc) - 4; addr <= int(cpu.Pc)+6; addr += 2 {
+		if addr < 0 {
+			continue
+		}
+		opcode := uint16(peek(cpu, addr))<<8 | uint16(peek(cpu, addr+1))
+		marker := " "
+		if addr == int(cpu.Pc) {
+			marker = ">"
+		}
+		line(fmt.Sprintf("%s%s %s", marker, d.symbols.Label(uint16(addr)), d.symbols.Disassemble(opcode)), white)
+	}
+
+	// The call stack, innermost call first. A return address that doesn't
+	// follow a call means the stack was tampered with.
+	line("", white)
+	depth := cpu.CallDepth()
+	header := fmt.Sprintf("Call stack (%d)", depth)
+	if depth == len(cpu.Stack) {
+		header += " FULL"
+	}
+	line(header, yellow)
+	const shownCalls = 4
+	for i := depth - 1; i >= 0 && i >= depth-shownCalls; i-- {
+		site := int(cpu.Stack[i])
+		opcode := uint16(peek(cpu, site))<<8 | uint16(peek(cpu, site+1))
+		if opcode&0xF000 == 0x2000 {
+			line(fmt.Sprintf(" %s %s", d.symbols.Label(uint16(site)), d.symbols.Disassemble(opcode)), white)
+		} else {
+			line(fmt.Sprintf("!%s %s", d.symbols.Label(uint16(site)), d.symbols.Disassemble(opcode)), yellow)
+		}
+	}
+	if depth > shownCalls {
+		line(fmt.Sprintf(" ... %d more", depth-shownCalls), white)
+	}
+
+	line("", white)
+	line(fmt.Sprintf("Watches  <%s> add", keyWatch), yellow)
+	for _, w := range d.watches {
+		color := white
+		if w.changed {
+			color = yellow
+		}
+		line(fmt.Sprintf("%s = %d (%X)", w.Text, w.value, w.value), color)
+	}
+	if d.entering {
+		line("> "+d.entry+"_", white)
+	} else if d.message != "" {
+		line(d.message, yellow)
+	}
+}
+
+// Size of the pixels of the sprite at I
+const debugSpritePixel = 3
+
+// drawSprite draws the 16 rows of the sprite at addr with its top left corner at x, y
+func drawSprite(renderer *sdl.Renderer, cpu *chip8.CPU, addr int, x, y int32) {
+	renderer.SetDrawColor(palette.Off.R, palette.Off.G, palette.Off.B, 255)
+	renderer.FillRect(&sdl.Rect{X: x, Y: y, W: 8 * debugSpritePixel, H: 16 * debugSpritePixel})
+	renderer.SetDrawColor(palette.On.R, palette.On.G, palette.On.B, 255)
+	for row := 0; row < 16; row++ {
+		bits := peek(cpu, addr+row)
+		for col := 0; col < 8; col++ {
+			if bits&(0x80>>col) != 0 {
+				renderer.FillRect(&sdl.Rect{X: x + int32(col)*debugSpritePixel, Y: y + int32(row)*debugSpritePixel, W: debugSpritePixel, H: debugSpritePixel})
+			}
+		}
+	}
+}
+
+// UpdateWatches evaluates the watches, once per frame
+func (d *Debugger) UpdateWatches(cpu *chip8.CPU) {
+	for _, w := range d.watches {
+		w.Update(cpu)
+	}
+}
+
+// Break reports why the emulation stopped on the panel, instead of leaving the game
+func (d *Debugger) Break(inst *Instance, err error) {
+	inst.Paused, inst.breakAt = true, nil
+	d.Visible, d.message = true, err.Error()
+}
+
+// peek reads memory for display, addresses wrap around the end of memory
+func peek(cpu *chip8.CPU, addr int) uint8 {
+	return cpu.Memory[addr%len(cpu.Memory)]
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// chooseFile asks for a file with the file dialog of the system and returns
+// its absolute path, or "" if the dialog was cancelled. SDL 2 has no file
+// dialog of its own, so this runs the one the system comes with: PowerShell
+// on Windows, AppleScript on macOS and zenity or kdialog elsewhere. The
+// title must not hold quotes.
+func chooseFile(title string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-Command",
+			"Add-Type -AssemblyName System.Windows.Forms; "+
+				"$d = New-Object System.Windows.Forms.OpenFileDialog; "+
+				"$d.Title = '"+title+"'; "+
+				"if ($d.ShowDialog() -eq 'OK') { $d.FileName }")
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", `POSIX path of (choose file with prompt "`+title+`")`)
+	default:
+		if _, err := exec.LookPath("zenity"); err == nil {
+			cmd = exec.Command("zenity", "--file-selection", "--title="+title)
+		} else if _, err := exec.LookPath("kdialog"); err == nil {
+			cmd = exec.Command("kdialog", "--getopenfilename", ".", "--title", title)
+		} else {
+			return "", errors.New("no file dialog found, install zenity or kdialog")
+		}
+	}
+
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// Cancelled
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimSpace(string(out))
+	if path == "" {
+		return "", nil
+	}
+	return filepath.Abs(path)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Where the ROMs of the CHIP-8 Archive are downloaded from, by name
+const archiveURL = "https://johnearnest.github.io/chip8Archive/roms/%s.ch8"
+
+// ArchiveRom is a public-domain ROM of the CHIP-8 Archive. It is pinned by
+// its SHA-256, a download with other contents is refused.
+type ArchiveRom struct {
+	Name   string
+	Title  string
+	SHA256 string
+}
+
+// The ROMs the menu offers to download. Add more with the SHA-256 of a copy
+// checked by hand.
+var archiveRoms = []ArchiveRom{
+	{Name: "flightrunner", Title: "Flight Runner", SHA256: "982b4799ec822369ea26f0884669fd23caeec805d10e5e9caff434e0851b2e5e"},
+	{Name: "slipperyslope", Title: "Slippery Slope", SHA256: "9b41321353363bea616d51e1d63435e583c6ca8772ec78d6ceea33f21c89169d"},
+}
+
+// userRomDir returns the directory downloaded ROMs are kept in
+func userRomDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "roms"), nil
+}
+
+// path returns where the ROM is kept once downloaded
+func (rom ArchiveRom) path() (string, error) {
+	dir, err := userRomDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, rom.Name+".ch8"), nil
+}
+
+// downloaded reports whether the ROM is in the user ROM directory
+func (rom ArchiveRom) downloaded() bool {
+	path, err := rom.path()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// download fetches the ROM into the user ROM directory, once its hash checks out
+func (rom ArchiveRom) download() error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(fmt.Sprintf(archiveURL, rom.Name))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Request.URL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, chip8.MaxMemorySize))
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != rom.SHA256 {
+		return fmt.Errorf("%s: the download doesn't match the known SHA-256", rom.Name)
+	}
+
+	path, err := rom.path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// showDownloads lists the ROMs that can be downloaded, <Enter> fetches the
+// selected one. It returns once the player goes back to the menu.
+func showDownloads(window *sdl.Window, renderer *sdl.Renderer, texts *TextCache) {
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	lineHeight := int32(fontSize) + 8
+	selected := 0
+	status := ""
+
+	draw := func(text string, color sdl.Color, x, y int32) {
+		if _, _, err := texts.Draw(text, color, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				switch t.Keysym.Sym {
+				case sdl.K_ESCAPE:
+					return
+				case sdl.K_UP:
+					if selected > 0 {
+						selected--
+					}
+				case sdl.K_DOWN:
+					if selected < len(archiveRoms)-1 {
+						selected++
+					}
+				case sdl.K_RETURN, sdl.K_KP_ENTER:
+					rom := archiveRoms[selected]
+					if err := rom.download(); err != nil {
+						showError(window, "Failed to download "+rom.Title, err)
+						break
+					}
+					status = tr("Downloaded %s", rom.Title)
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		draw(tr("Download ROMs from the CHIP-8 Archive"), yellow, 32, 32)
+		y := 32 + 2*lineHeight
+		for i, rom := range archiveRoms {
+			if i == selected {
+				renderer.SetDrawColor(64, 64, 64, 255)
+				renderer.FillRect(&sdl.Rect{X: 24, Y: y - 4, W: winWidth - 48, H: lineHeight})
+			}
+			draw(rom.Title, white, 32, y)
+			if rom.downloaded() {
+				draw(tr("downloaded"), white, winWidth/2, y)
+			}
+			y += lineHeight
+		}
+		if status != "" {
+			draw(status, yellow, 32, winHeight-3*lineHeight)
+		}
+		draw(tr("<Up>/<Down> to choose, <Enter> to download, <Escape> to go back"), white, 32, winHeight-lineHeight-8)
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
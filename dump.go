@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/petersid2022/chip8/cmd"
+)
+
+// MachineDump is the whole state of a running machine, dumped from the
+// debugger with <Ctrl>+<F10> or from GET /dump, to attach to a bug report
+// about a ROM
+type MachineDump struct {
+	Version string
+	Rom     string
+	Hash    string
+	Time    time.Time
+	Paused  bool
+	Quirks  chip8.Quirks
+
+	Pc, I, Opcode uint16
+	V             [16]uint8
+	Stack         [16]uint16
+	StackPointer  uint8
+	DelayTimer    uint8
+	SoundTimer    uint8
+
+	// The keys of the keypad held, by number
+	Keys []int
+
+	// The last instructions run, oldest first
+	Trace []DumpInstruction
+
+	// The screen a row per line, # for a lit pixel, and the memory in hex
+	Screen []string
+	Memory hexBytes
+}
+
+// DumpInstruction is an instruction run before the dump, disassembled
+type DumpInstruction struct {
+	Pc, Opcode  uint16
+	Instruction string
+}
+
+// hexBytes is memory written in hex to JSON, rather than in base64
+type hexBytes []byte
+
+func (b hexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+func (b *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	*b = decoded
+	return err
+}
+
+// dump takes a snapshot of the machine of inst
+func (inst *Instance) dump() MachineDump {
+	cpu := &inst.CPU
+	d := MachineDump{
+		Version:      buildVersion(),
+		Rom:          inst.Name,
+		Hash:         inst.Hash,
+		Time:         time.Now(),
+		Paused:       inst.Paused,
+		Quirks:       cpu.Quirks,
+		Pc:           cpu.Pc,
+		I:            cpu.I,
+		Opcode:       cpu.Opcode,
+		V:            cpu.V,
+		Stack:        cpu.Stack,
+		StackPointer: cpu.Stack_pointer,
+		DelayTimer:   cpu.DelayTimer(),
+		SoundTimer:   cpu.SoundTimer(),
+		Memory:       append(hexBytes(nil), cpu.Memory...),
+	}
+	for k, held := range cpu.Keypad {
+		if held != 0 {
+			d.Keys = append(d.Keys, k)
+		}
+	}
+
+	n := min(inst.traceNext, traceLength)
+	for i := inst.traceNext - n; i < inst.traceNext; i++ {
+		t := inst.traced[i%traceLength]
+		d.Trace = append(d.Trace, DumpInstruction{t.pc, t.opcode, chip8.Disassemble(t.opcode)})
+	}
+
+	d.Screen = strings.Split(strings.TrimSuffix(frameText(cpuFrame(cpu), false), "\n"), "\n")
+	return d
+}
+
+// WriteReport writes the dump for people to read: the registers, the last
+// instructions, the screen and the memory, rows of zeros left out
+func (d *MachineDump) WriteReport(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "chip8 %s\n", d.Version)
+	fmt.Fprintf(&b, "ROM %s (%s)\n", d.Rom, d.Hash)
+	fmt.Fprintf(&b, "Dumped %s", d.Time.Format(time.RFC3339))
+	if d.Paused {
+		b.WriteString(", paused")
+	}
+	fmt.Fprintf(&b, "\nQuirks %s\n\n", quirkNames(d.Quirks))
+
+	fmt.Fprintf(&b, "PC %03X  I %03X  SP %d  DT %02X  ST %02X  Opcode %04X\n", d.Pc, d.I, d.StackPointer, d.DelayTimer, d.SoundTimer, d.Opcode)
+	for x, v := range d.V {
+		fmt.Fprintf(&b, "V%X %02X ", x, v)
+		if x%8 == 7 {
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("Stack")
+	for _, addr := range d.Stack {
+		fmt.Fprintf(&b, " %03X", addr)
+	}
+	b.WriteString("\nKeys")
+	for _, k := range d.Keys {
+		fmt.Fprintf(&b, " %X", k)
+	}
+	b.WriteString("\n\n")
+
+	fmt.Fprintf(&b, "Last %d instructions\n", len(d.Trace))
+	for _, t := range d.Trace {
+		fmt.Fprintf(&b, "%03X %04X %s\n", t.Pc, t.Opcode, t.Instruction)
+	}
+
+	b.WriteString("\nScreen\n")
+	for _, row := range d.Screen {
+		b.WriteString(row + "\n")
+	}
+
+	fmt.Fprintf(&b, "\nMemory, %d bytes\n", len(d.Memory))
+	zeros := make([]byte, 16)
+	skipped := false
+	for addr := 0; addr < len(d.Memory); addr += 16 {
+		row := d.Memory[addr:min(addr+16, len(d.Memory))]
+		if string(row) == string(zeros[:len(row)]) {
+			if !skipped {
+				b.WriteString("*\n")
+			}
+			skipped = true
+			continue
+		}
+		skipped = false
+		fmt.Fprintf(&b, "%04X ", addr)
+		for _, v := range row {
+			fmt.Fprintf(&b, " %02X", v)
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the dump as indented JSON
+func (d *MachineDump) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// quirkNames lists the quirks that are on, like the quirks menu names them
+func quirkNames(q chip8.Quirks) string {
+	var names []string
+	for _, s := range quirkSettings {
+		if *s.flag(&q) {
+			names = append(names, s.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+func dumpDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "dumps"), nil
+}
+
+// writeDump dumps the machine of inst both as a report and as JSON, named
+// after the ROM and the time, and returns the path of the report
+func (inst *Instance) writeDump() (string, error) {
+	dir, err := dumpDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	d := inst.dump()
+	rom := filepath.Base(inst.Name)
+	base := filepath.Join(dir, strings.TrimSuffix(rom, filepath.Ext(rom))+d.Time.Format("-20060102-150405"))
+
+	var report, data strings.Builder
+	if err := d.WriteReport(&report); err != nil {
+		return "", err
+	}
+	if err := d.WriteJSON(&data); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".json", []byte(data.String()), 0644); err != nil {
+		return "", err
+	}
+	return base + ".txt", os.WriteFile(base+".txt", []byte(report.String()), 0644)
+}
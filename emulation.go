@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Emulation runs the machines on a goroutine of their own, so a machine
+// running very fast doesn't hold up the window. The machines are shared with
+// the UI, which locks the emulation to look at them or change them, and the
+// goroutine unlocks it while netplay waits on the network. Nothing on the
+// goroutine calls into SDL but its timer.
+type Emulation struct {
+	sync.Mutex
+
+	instances []*Instance
+	player    *Instance
+
+	// The machine a misbehaving program stopped and why, the UI reports it
+	Failed *Instance
+	Err    error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// The most timer ticks the clocks move along at once. After the host was
+// suspended or stalled the machines carry on where they were rather than
+// count down the time they missed.
+const maxElapsedTicks = 6
+
+// How often -deterministic runs log the hash of the machines, in frames. Runs
+// that should have gone the same can be compared line by line to find the
+// first frame they differ.
+const hashFrames = 60
+
+// startEmulation starts running the machines, the first one being the player's
+func startEmulation(instances []*Instance) *Emulation {
+	e := &Emulation{
+		instances: instances,
+		player:    instances[0],
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Stop stops the machines and waits for the goroutine to be done with them,
+// it must not be called with the emulation locked
+func (e *Emulation) Stop() {
+	close(e.stop)
+	// A machine waiting for the other player would only notice after netTimeout
+	if e.player.Net != nil {
+		e.player.Net.conn.Close()
+	}
+	<-e.done
+}
+
+// step runs an instruction of a machine, it returns false when a program misbehaved
+func (e *Emulation) step(inst *Instance) bool {
+	statInstructions.Add(1)
+	if err := inst.SafeStep(); err != nil {
+		// Let the debugger show what went wrong if it is open, or if
+		// unknown opcodes should pause into it
+		var opcodeErr *chip8.OpcodeError
+		pause := e.player.debug.Visible || (onInvalid == "pause" && errors.As(err, &opcodeErr))
+		if inst == e.player && pause && e.player.Net == nil {
+			e.player.debug.Break(e.player, err)
+			return true
+		}
+		e.Failed, e.Err = inst, err
+		return false
+	}
+	// Stop again once a step of the debugger is done
+	if inst.breakAt != nil && inst.breakAt() {
+		inst.breakAt = nil
+	}
+	return true
+}
+
+// running reports whether a machine runs, paused ones only do while the debugger steps
+func running(inst *Instance) bool {
+	return !inst.Paused || inst.breakAt != nil
+}
+
+// idle reports whether a machine only waits for a key, in which case it
+// can skip instructions. Netplay has to run every one of them to stay in
+// lockstep.
+func idle(inst *Instance) bool {
+	return inst.Net == nil && inst.CPU.Idle()
+}
+
+// run is the emulation goroutine. Machines timed in frames run one per turn
+// of the loop, in bursts the UI can get in between to hand over keys. The
+// others run a single instruction per turn, paced by the delay of the menu.
+func (e *Emulation) run() {
+	defer close(e.done)
+
+	// 60 Hz timer ticks so far, the clocks of running machines move along
+	timerTicks := uint64(sdl.GetTicks()) * 60 / 1000
+
+	// When the next frame is due, in milliseconds, for machines timed in frames
+	frameDue := float64(sdl.GetTicks())
+
+	for {
+		select {
+		case <-e.stop:
+			return
+		default:
+		}
+
+		e.Lock()
+		now := uint64(sdl.GetTicks()) * 60 / 1000
+		elapsed := min(now-timerTicks, maxElapsedTicks)
+		timerTicks = now
+
+		framed := false
+		for _, inst := range e.instances {
+			if !running(inst) {
+				continue
+			}
+			if inst.framed() {
+				// Their timers tick once per frame
+				framed = true
+				inst.clock.Advance(1)
+				if inst.Net != nil {
+					if err := e.syncNet(inst); err != nil {
+						e.Failed, e.Err = inst, err
+						e.Unlock()
+						return
+					}
+				}
+				if deterministic && inst.frames%hashFrames == 0 {
+					slog.Info("State hash", "rom", inst.Name, "frame", inst.frames, "hash", fmt.Sprintf("%016x", inst.CPU.Hash()))
+				}
+				inst.frames++
+				continue
+			}
+			inst.clock.Advance(elapsed)
+			if !e.step(inst) {
+				e.Unlock()
+				return
+			}
+		}
+		e.Unlock()
+
+		for burst := 0; framed && burst < inputBursts; burst++ {
+			e.Lock()
+			for _, inst := range e.instances {
+				if !inst.framed() {
+					continue
+				}
+				n := inst.perFrame()
+				for i := burst * n / inputBursts; i < (burst+1)*n/inputBursts && running(inst); i++ {
+					if !e.step(inst) {
+						e.Unlock()
+						return
+					}
+					// The rest of the burst would spin in place
+					if idle(inst) {
+						break
+					}
+				}
+			}
+			e.Unlock()
+		}
+
+		// Delay to control the emulation speed, frames last 1/60 s. While
+		// every machine waits for a key there is no need to spin.
+		e.Lock()
+		waiting := true
+		for _, inst := range e.instances {
+			waiting = waiting && (!running(inst) || idle(inst))
+		}
+		e.Unlock()
+		if !framed && waiting {
+			sdl.Delay(16)
+		} else if !framed {
+			sdl.Delay(uint32(delay / target_fps))
+		} else if frameDue += 1000.0 / 60; frameDue > float64(sdl.GetTicks()) {
+			sdl.Delay(uint32(frameDue - float64(sdl.GetTicks())))
+		} else {
+			// Running behind, don't rush to catch up
+			frameDue = float64(sdl.GetTicks())
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// Golden frames sit in this directory next to the ROMs, one PNG per ROM
+const goldenDir = "golden"
+
+// runGolden runs every ROM of a directory to a frame and compares the screen
+// with its golden image, or stores the screen as the golden image with -update.
+func runGolden(args []string) error {
+	flags := flag.NewFlagSet("golden", flag.ContinueOnError)
+	frames := flags.Int("frames", 600, "frame to compare the screen at")
+	update := flags.Bool("update", false, "write the screens as the new golden images")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: chip8 golden [options] <dir>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("want one ROM directory")
+	}
+	if *frames <= 0 {
+		return fmt.Errorf("invalid number of frames %d", *frames)
+	}
+
+	dir := flags.Arg(0)
+	entries, err := listRoms(os.DirFS(dir), ".")
+	if err != nil {
+		return err
+	}
+	checked, failed := 0, 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		checked++
+		var status string
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err == nil {
+			status, err = goldenCheck(data, filepath.Join(dir, goldenDir, entry.Name()+".png"), *frames, *update)
+		}
+		if err != nil {
+			status = err.Error()
+			failed++
+		}
+		fmt.Printf("  %-24s %s\n", entry.Name(), status)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d ROMs don't match their golden frame", failed, checked)
+	}
+	return nil
+}
+
+// goldenCheck runs a ROM and compares or updates its golden image at path
+func goldenCheck(data []byte, path string, frames int, update bool) (string, error) {
+	h, err := newHeadless(data)
+	if err != nil {
+		return "", err
+	}
+	if n, err := h.run(frames); err != nil {
+		return "", fmt.Errorf("crashed at frame %d: %w", n, err)
+	}
+	frame := cpuFrame(&h.cpu)
+
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		return "updated", png.Encode(f, frameImage(frame, 1))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.New("no golden frame, run with -update")
+		}
+		return "", err
+	}
+	defer f.Close()
+	golden, err := png.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	if diff := frameDiff(frame, golden); diff != 0 {
+		return "", fmt.Errorf("%d pixels differ from the golden frame", diff)
+	}
+	return "ok", nil
+}
+
+// frameDiff counts the pixels of a frame that differ from an image, every
+// pixel differs if the sizes don't match
+func frameDiff(frame Frame, img image.Image) int {
+	lit := goldenPixels(img, frame.Width, frame.Height)
+	if lit == nil {
+		return frame.Width * frame.Height
+	}
+	diff := 0
+	for i, p := range frame.Pixels {
+		if lit[i] != (p != 0) {
+			diff++
+		}
+	}
+	return diff
+}
+
+// goldenPixels reads which pixels of a screen an image shows lit, bright
+// ones are. The image may be the screen at any whole scale, every pixel is
+// read at the middle of its square. It returns nil for images of other sizes.
+func goldenPixels(img image.Image, width, height int) []bool {
+	bounds := img.Bounds()
+	scale := bounds.Dx() / width
+	if scale == 0 || bounds.Dx() != width*scale || bounds.Dy() != height*scale {
+		return nil
+	}
+	lit := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*scale+scale/2, bounds.Min.Y+y*scale+scale/2).RGBA()
+			lit[y*width+x] = (r+g+b)/3 >= 0x8000
+		}
+	}
+	return lit
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the screens of TestGolden as its new golden images")
+
+// Frame the screens of the bundled ROMs are compared at
+const goldenTestFrames = 300
+
+// TestGolden runs every bundled ROM headlessly, with no keys pressed and the
+// random numbers of -deterministic, and compares its screen with the one in
+// testdata/golden. Run it with -update after a change to the screens that is
+// intended.
+func TestGolden(t *testing.T) {
+	roms, err := romFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rom := range roms {
+		t.Run(rom.Name(), func(t *testing.T) {
+			data, err := readRomFile(rom.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", goldenDir, rom.Name()+".png")
+			if _, err := goldenCheck(data, path, goldenTestFrames, *update); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Hotkey is a key of the frontend along with the modifiers held with it,
+// written like F5 or Shift+F7 with the key names of SDL
+type Hotkey struct {
+	Key sdl.Keycode
+	Mod uint16
+}
+
+// The modifiers a hotkey can have, by name. Either side of the keyboard will do.
+var hotkeyMods = []struct {
+	name string
+	mod  uint16
+}{
+	{"Ctrl", sdl.KMOD_CTRL},
+	{"Alt", sdl.KMOD_ALT},
+	{"Shift", sdl.KMOD_SHIFT},
+}
+
+// The hotkeys of a running game, set with -key-<name> on the command line or
+// key-<name> in the config file
+var (
+	keyRestart     = Hotkey{Key: sdl.K_BACKSPACE}
+	keyQuit        = Hotkey{Key: sdl.K_ESCAPE}
+	keyFaster      = Hotkey{Key: sdl.K_PAGEUP}
+	keySlower      = Hotkey{Key: sdl.K_PAGEDOWN}
+	keyKeypad      = Hotkey{Key: sdl.K_F1}
+	keyInput       = Hotkey{Key: sdl.K_F1, Mod: sdl.KMOD_SHIFT}
+	keyGrid        = Hotkey{Key: sdl.K_F2}
+	keyPerf        = Hotkey{Key: sdl.K_F2, Mod: sdl.KMOD_SHIFT}
+	keyLatency     = Hotkey{Key: sdl.K_F2, Mod: sdl.KMOD_CTRL}
+	keyCRT         = Hotkey{Key: sdl.K_F3}
+	keyCopyScreen  = Hotkey{Key: sdl.K_F3, Mod: sdl.KMOD_SHIFT}
+	keyBlend       = Hotkey{Key: sdl.K_F4}
+	keySave        = Hotkey{Key: sdl.K_F5}
+	keyExport      = Hotkey{Key: sdl.K_F5, Mod: sdl.KMOD_CTRL}
+	keyCheats      = Hotkey{Key: sdl.K_F6}
+	keySearch      = Hotkey{Key: sdl.K_F7}
+	keySprites     = Hotkey{Key: sdl.K_F7, Mod: sdl.KMOD_SHIFT}
+	keyWatch       = Hotkey{Key: sdl.K_F8}
+	keyLoad        = Hotkey{Key: sdl.K_F9}
+	keyDebugger    = Hotkey{Key: sdl.K_F10}
+	keyShowChanges = Hotkey{Key: sdl.K_F10, Mod: sdl.KMOD_SHIFT}
+	keyDump        = Hotkey{Key: sdl.K_F10, Mod: sdl.KMOD_CTRL}
+	keyPause       = Hotkey{Key: sdl.K_F11}
+	keySpeed       = Hotkey{Key: sdl.K_F11, Mod: sdl.KMOD_SHIFT}
+	keyStep        = Hotkey{Key: sdl.K_F12}
+	keyKioskExit   = Hotkey{Key: sdl.K_q, Mod: sdl.KMOD_CTRL | sdl.KMOD_ALT}
+	keyMute        = Hotkey{Key: sdl.K_m}
+	keyVolumeUp    = Hotkey{Key: sdl.K_EQUALS}
+	keyVolumeDown  = Hotkey{Key: sdl.K_MINUS}
+)
+
+// hotkeys lists the hotkeys by name. Modifiers change what the loose ones
+// do, so they are taken whatever the modifiers held and none can be added
+// to them.
+var hotkeys = []struct {
+	name, usage string
+	key         *Hotkey
+	loose       bool
+}{
+	{"restart", "go back to the menu", &keyRestart, false},
+	{"quit", "quit", &keyQuit, false},
+	{"faster", "run one instruction more per frame, 10 with Shift", &keyFaster, true},
+	{"slower", "run one instruction less per frame, 10 with Shift", &keySlower, true},
+	{"keypad", "toggle the on-screen keypad", &keyKeypad, false},
+	{"input", "toggle the input overlay", &keyInput, false},
+	{"grid", "toggle the pixel grid", &keyGrid, false},
+	{"perf", "toggle the performance HUD", &keyPerf, false},
+	{"latency", "toggle the input latency HUD", &keyLatency, false},
+	{"crt", "toggle the CRT effects", &keyCRT, false},
+	{"copy-screen", "copy the screen to the clipboard as text art", &keyCopyScreen, false},
+	{"blend", "toggle frame blending", &keyBlend, false},
+	{"save", "save the game to a slot", &keySave, false},
+	{"export", "export the settings of the game as a preset to share", &keyExport, false},
+	{"cheats", "toggle cheats", &keyCheats, false},
+	{"search", "search the memory for new cheats", &keySearch, false},
+	{"sprites", "browse the sprites in memory", &keySprites, false},
+	{"watch", "add a watch to the debugger, remove the last one with Shift", &keyWatch, true},
+	{"load", "load the game from a slot", &keyLoad, false},
+	{"debugger", "show the debugger", &keyDebugger, false},
+	{"show-changes", "color what the last draw changed in the debugger", &keyShowChanges, false},
+	{"dump", "dump the machine state to a file, for a bug report", &keyDump, false},
+	{"pause", "pause or continue in the debugger", &keyPause, false},
+	{"speed", "pick the speed of a machine of old", &keySpeed, false},
+	{"step", "run a single instruction, Shift steps over a call and Ctrl out of the subroutine", &keyStep, true},
+	{"mute", "mute or unmute the sound", &keyMute, false},
+	{"volume-up", "turn the volume up", &keyVolumeUp, true},
+	{"volume-down", "turn the volume down", &keyVolumeDown, true},
+	{"kiosk-exit", "quit in -kiosk mode, where the quit and restart keys are off", &keyKioskExit, false},
+}
+
+// Is reports whether key is the hotkey, with exactly its modifiers
+func (h Hotkey) Is(key sdl.Keysym) bool {
+	if key.Sym != h.Key {
+		return false
+	}
+	for _, m := range hotkeyMods {
+		if (key.Mod&m.mod != 0) != (h.Mod&m.mod != 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// String writes the hotkey the way Set reads it
+func (h Hotkey) String() string {
+	var b strings.Builder
+	for _, m := range hotkeyMods {
+		if h.Mod&m.mod != 0 {
+			b.WriteString(m.name + "+")
+		}
+	}
+	b.WriteString(sdl.GetKeyName(h.Key))
+	return b.String()
+}
+
+// Set reads a hotkey written like F5 or Ctrl+Shift+S, it implements flag.Value
+func (h *Hotkey) Set(s string) error {
+	rest := s
+	var mod uint16
+	for {
+		// A "+" at the end is the key itself
+		i := strings.Index(rest, "+")
+		if i == -1 || i == len(rest)-1 {
+			break
+		}
+		found := false
+		for _, m := range hotkeyMods {
+			if strings.EqualFold(rest[:i], m.name) {
+				mod |= m.mod
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown modifier %q in %q, want Ctrl, Alt or Shift", rest[:i], s)
+		}
+		rest = rest[i+1:]
+	}
+	key := sdl.GetKeyFromName(rest)
+	if key == sdl.K_UNKNOWN {
+		return fmt.Errorf("unknown key %q", rest)
+	}
+	h.Key, h.Mod = key, mod
+	return nil
+}
+
+// checkHotkeys makes sure no two hotkeys are the same, and that none without
+// Ctrl or Alt takes a key of the keypad, of either machine when two play
+// side by side. Keypad keys are those of a QWERTY keyboard.
+func checkHotkeys(split bool) error {
+	var errs []error
+	for i, a := range hotkeys {
+		if a.key.Mod&(sdl.KMOD_CTRL|sdl.KMOD_ALT) == 0 && (mapKey(a.key.Key) != -1 || (split && mapKeyRight(a.key.Key) != -1)) {
+			errs = append(errs, fmt.Errorf("-key-%s: %s is a key of the keypad", a.name, a.key))
+		}
+		if a.loose && a.key.Mod != 0 {
+			errs = append(errs, fmt.Errorf("-key-%s: %s can't have modifiers, they change what it does", a.name, a.key))
+		}
+		for _, b := range hotkeys[i+1:] {
+			if a.key.Key == b.key.Key && (a.key.Mod == b.key.Mod || a.loose || b.loose) {
+				errs = append(errs, fmt.Errorf("-key-%s and -key-%s are both %s", a.name, b.name, b.key))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/petersid2022/chip8/cmd"
+)
+
+// runInfo prints what can be told about ROM files without running them
+func runInfo(paths []string) error {
+	if len(paths) == 0 {
+		return errors.New("usage: chip8 info <rom>...")
+	}
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		printRomInfo(path, data)
+	}
+	return nil
+}
+
+func printRomInfo(name string, data []byte) {
+	info := chip8.AnalyzeRom(data)
+	fmt.Println(name)
+	fmt.Printf("  %-10s %d bytes\n", "Size", info.Size)
+	fmt.Printf("  %-10s %s\n", "SHA-1", romHash(data))
+	fmt.Printf("  %-10s %s\n", "Machine", info.Machine)
+	fmt.Printf("  %-10s %s\n", "SCHIP", listOrNone(info.SCHIP))
+	fmt.Printf("  %-10s %s\n", "XO-CHIP", listOrNone(info.XOCHIP))
+
+	// Most used first, data words count too so this is an estimate
+	mnemonics := make([]string, 0, len(info.Opcodes))
+	for m := range info.Opcodes {
+		mnemonics = append(mnemonics, m)
+	}
+	sort.Slice(mnemonics, func(i, j int) bool {
+		a, b := mnemonics[i], mnemonics[j]
+		if info.Opcodes[a] != info.Opcodes[b] {
+			return info.Opcodes[a] > info.Opcodes[b]
+		}
+		return a < b
+	})
+	fmt.Println("  Opcodes")
+	for _, m := range mnemonics {
+		fmt.Printf("    %-8s %5d\n", m, info.Opcodes[m])
+	}
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, " ")
+}
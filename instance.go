@@ -0,0 +1,263 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Instance is one emulated machine along with the frontend state that
+// belongs to it: its screen, its keys and where its files are kept.
+type Instance struct {
+	Name   string
+	Hash   string
+	CPU    chip8.CPU
+	Screen *ScreenRenderer
+	Keys   [16]bool
+
+	// Paused stops the emulation, until breakAt is true when it is set
+	Paused  bool
+	breakAt func() bool
+
+	// Paces the timers of the machine, it only moves while the machine runs
+	clock chip8.ManualClock
+
+	// Frames run so far, -deterministic logs the hash of the machine every hashFrames
+	frames uint64
+
+	// Instructions per frame set for the ROM, 0 to go by -ipf
+	ipf int
+
+	// The debugger panel and the watches of the ROM
+	debug Debugger
+
+	// The last instructions run, for crash reports
+	traced    [traceLength]traceEntry
+	traceNext int
+
+	// Net keeps the machine in lockstep with a remote one, nil when playing locally
+	Net *Netplay
+
+	// Scripts attached with AddScript and what they can reach
+	scripts []Script
+	script  *ScriptContext
+
+	// The cheats of the ROM, see cheats.go
+	cheats *Cheats
+
+	// The memory search in progress, see search.go
+	search MemorySearch
+
+	// mapKey returns the keypad key a keyboard key stands for, or -1
+	mapKey func(sdl.Keycode) int
+
+	// The on-screen keypad, see keypad.go
+	keypad Keypad
+
+	// Measures how long key presses take to reach the program, see latency.go
+	latency LatencyMeter
+}
+
+// The seed of CXNN in -deterministic mode, and of netplay sessions hosted in it
+const deterministicSeed = 0xC8
+
+// newInstance loads a ROM from the roms directory into a fresh machine
+func newInstance(renderer *sdl.Renderer, romName string, keys func(sdl.Keycode) int) (*Instance, error) {
+	inst := &Instance{mapKey: keys}
+	if err := inst.Load(romName); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if inst.Screen, err = NewScreenRenderer(renderer); err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+// Load replaces the machine with a fresh one running a ROM from the roms directory
+func (inst *Instance) Load(romName string) error {
+	romData, err := readRomFile(romName)
+	if err != nil {
+		return err
+	}
+
+	cpu := chip8.CPU{
+		MemorySize: memorySize,
+		Strict:     strictMemory,
+		LoadAt:     loadAddress,
+		Hires:      machine == "hires",
+		Font:       fontData,
+		OnInvalid:  chip8.InvalidIgnore,
+		Clock:      &inst.clock,
+		Quirks:     quirks,
+	}
+	if onInvalid != "ignore" {
+		cpu.OnInvalid = chip8.InvalidStop
+	}
+	hash := romHash(romData)
+	if cpu.Quirks, err = romQuirks(romName, quirks); err != nil {
+		slog.Error("Failed to read the quirks of the ROM", "rom", romName, "err", err)
+	}
+	if p := presetFor(hash); p != nil {
+		slog.Info("Playing with the settings of the preset", "rom", romName)
+		cpu.Quirks = p.Quirks
+	}
+	if deterministic {
+		cpu.Rand = rand.New(rand.NewSource(deterministicSeed))
+	}
+	cpu.Init()
+	if consoleAddress != -1 {
+		cpu.Attach(&chip8.Console{Addr: consoleAddress, Output: func(line string) {
+			slog.Info("Console", "rom", romName, "text", line)
+		}})
+	}
+	if err := cpu.LoadRomData(romData); err != nil {
+		return err
+	}
+
+	// Restore the RPL user flags (high scores) of earlier sessions, which
+	// -deterministic runs start without like the speed and cheats saved
+	if !deterministic {
+		if cpu.RPL, err = readRPL(hash); err != nil {
+			slog.Error("Failed to read RPL flags", "rom", romName, "err", err)
+		}
+	}
+
+	inst.Name, inst.Hash, inst.CPU = romName, hash, cpu
+	inst.Keys = [16]bool{}
+	inst.search = MemorySearch{}
+	inst.traceNext = 0
+	inst.frames = 0
+	inst.debug.load(romName, hash)
+	inst.CPU.DrawFlag = true
+	inst.hookScripts()
+	inst.CPU.Hooks.OnKeyRead = func(key int) {
+		inst.keypad.noteRead(&inst.CPU, key)
+		inst.latency.noteRead(&inst.CPU, key)
+	}
+	inst.loadCheats()
+	if deterministic {
+		inst.ipf = 0
+	} else if p := presetFor(hash); p != nil {
+		inst.ipf = p.IPF
+	} else if inst.ipf, err = readSpeed(hash); err != nil {
+		slog.Error("Failed to read instructions per frame", "rom", romName, "err", err)
+	}
+	return nil
+}
+
+// HandleKey updates the keypad of the instance, it reports whether the key
+// belongs to it. Presses are timed from the timestamp of their event.
+func (inst *Instance) HandleKey(key sdl.Keysym, down bool, timestamp uint32) bool {
+	code := key.Sym
+	if !keycodeMapping {
+		code = qwertyKey(key.Scancode)
+	}
+	chip8Key := inst.mapKey(code)
+	if chip8Key == -1 {
+		return false
+	}
+	if down && !inst.Keys[chip8Key] {
+		inst.latency.keyDown(chip8Key, timestamp)
+	}
+	inst.Keys[chip8Key] = down
+	return true
+}
+
+// Step runs one cycle of the machine and persists the RPL flags if the ROM changed them
+func (inst *Instance) Step() error {
+	inst.trace()
+	if opcodeCounts != nil {
+		opcodeCounts[inst.CPU.NextOpcode()]++
+	}
+	if err := inst.CPU.EmulateCycle(); err != nil {
+		return err
+	}
+
+	if inst.CPU.RPLFlag {
+		if err := writeRPL(inst.Hash, inst.CPU.RPL); err != nil {
+			slog.Error("Failed to save RPL flags", "rom", inst.Name, "err", err)
+		}
+		inst.CPU.RPLFlag = false
+	}
+
+	// Netplay trades the keys with the other player first, see syncNet
+	if inst.Net == nil {
+		inst.CPU.SetKeys(inst.Keys)
+	}
+	return nil
+}
+
+// Destroy frees the screen texture of the instance
+func (inst *Instance) Destroy() {
+	inst.Screen.Destroy()
+}
+
+// mapKeyRight maps the right hand side of the keyboard to the keypad, for
+// the second machine when two run side by side.
+func mapKeyRight(sdlKey sdl.Keycode) int {
+	switch sdlKey {
+	case sdl.K_7:
+		return 0x1
+	case sdl.K_8:
+		return 0x2
+	case sdl.K_9:
+		return 0x3
+	case sdl.K_0:
+		return 0xC
+	case sdl.K_u:
+		return 0x4
+	case sdl.K_i:
+		return 0x5
+	case sdl.K_o:
+		return 0x6
+	case sdl.K_p:
+		return 0xD
+	case sdl.K_j:
+		return 0x7
+	case sdl.K_k:
+		return 0x8
+	case sdl.K_l:
+		return 0x9
+	case sdl.K_SEMICOLON:
+		return 0xE
+	case sdl.K_m:
+		return 0xA
+	case sdl.K_COMMA:
+		return 0x0
+	case sdl.K_PERIOD:
+		return 0xB
+	case sdl.K_SLASH:
+		return 0xF
+	default:
+		return -1 // Invalid key
+	}
+}
+
+// qwertyKey returns the key at the position of a scancode on a US QWERTY
+// keyboard, so the keypad stays in the same place on other layouts.
+func qwertyKey(code sdl.Scancode) sdl.Keycode {
+	switch {
+	case code >= sdl.SCANCODE_A && code <= sdl.SCANCODE_Z:
+		return sdl.K_a + sdl.Keycode(code-sdl.SCANCODE_A)
+	case code >= sdl.SCANCODE_1 && code <= sdl.SCANCODE_9:
+		return sdl.K_1 + sdl.Keycode(code-sdl.SCANCODE_1)
+	}
+	switch code {
+	case sdl.SCANCODE_0:
+		return sdl.K_0
+	case sdl.SCANCODE_SEMICOLON:
+		return sdl.K_SEMICOLON
+	case sdl.SCANCODE_COMMA:
+		return sdl.K_COMMA
+	case sdl.SCANCODE_PERIOD:
+		return sdl.K_PERIOD
+	case sdl.SCANCODE_SLASH:
+		return sdl.K_SLASH
+	default:
+		return sdl.K_UNKNOWN
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// The keys of the keypad in the order they are laid out, row by row
+var keypadLayout = [16]int{
+	0x1, 0x2, 0x3, 0xC,
+	0x4, 0x5, 0x6, 0xD,
+	0x7, 0x8, 0x9, 0xE,
+	0xA, 0x0, 0xB, 0xF,
+}
+
+// How long a key stays highlighted after the program read it, in milliseconds
+const keyReadHighlight = 300
+
+// Keypad is the on-screen keypad of a machine, shown with -keypad or <F1>.
+// Its keys are pressed with the mouse or with fingers on a touch screen, and
+// light up as the program reads them to show which keys a game uses.
+type Keypad struct {
+	// Where the keypad was last drawn, in window pixels
+	bounds sdl.Rect
+
+	// The key held with the mouse, if mouseHeld, and the keys held by every finger
+	mouseKey  int
+	mouseHeld bool
+	fingers   map[sdl.FingerID]int
+
+	// When the program last read every key, and last waited with FX0A
+	read   [16]uint32
+	waited uint32
+
+	// The last FX0A wait, for the input overlay
+	wait keyWait
+}
+
+// keyWait is an FX0A instruction waiting for a key, times are in SDL ticks
+type keyWait struct {
+	pc         uint16
+	reg        int
+	start, end uint32 // end is 0 until a key is pressed
+	key        int
+}
+
+// noteRead is the OnKeyRead hook of the machine
+func (k *Keypad) noteRead(cpu *chip8.CPU, key int) {
+	now := sdl.GetTicks()
+	switch {
+	case key == -1:
+		k.waited = now
+		if k.wait.start == 0 || k.wait.end != 0 || k.wait.pc != cpu.Pc {
+			k.wait = keyWait{pc: cpu.Pc, reg: int(cpu.Opcode&0x0F00) >> 8, start: now}
+		}
+		// FX0A takes the highest key held
+		for i := range cpu.Keypad {
+			if cpu.Keypad[i] != 0 {
+				k.wait.key, k.wait.end = i, now
+			}
+		}
+	case key < len(k.read):
+		k.read[key] = now
+	}
+}
+
+// keyAt returns the key under a point of the window, or -1
+func (k *Keypad) keyAt(x, y int32) int {
+	b := k.bounds
+	if b.W == 0 || x < b.X || y < b.Y || x >= b.X+b.W || y >= b.Y+b.H {
+		return -1
+	}
+	col, row := (x-b.X)*4/b.W, (y-b.Y)*4/b.H
+	return keypadLayout[row*4+col]
+}
+
+// HandleEvent presses and releases the keys of inst touched or clicked on
+// the keypad, it reports whether the event was used
+func (k *Keypad) HandleEvent(event sdl.Event, inst *Instance, window *sdl.Window) bool {
+	if !showKeypad {
+		return false
+	}
+	switch t := event.(type) {
+	case *sdl.MouseButtonEvent:
+		// Touches come as finger events too, they are handled below
+		if t.Which == sdl.TOUCH_MOUSEID || t.Button != sdl.BUTTON_LEFT {
+			return false
+		}
+		if t.Type == sdl.MOUSEBUTTONDOWN {
+			if k.mouseKey = k.keyAt(t.X, t.Y); k.mouseKey == -1 {
+				return false
+			}
+			k.mouseHeld = true
+			inst.Keys[k.mouseKey] = true
+			return true
+		}
+		if !k.mouseHeld {
+			return false
+		}
+		inst.Keys[k.mouseKey] = false
+		k.mouseHeld = false
+		return true
+	case *sdl.TouchFingerEvent:
+		// Fingers are in fractions of the window
+		w, h := window.GetSize()
+		x, y := int32(t.X*float32(w)), int32(t.Y*float32(h))
+		if k.fingers == nil {
+			k.fingers = map[sdl.FingerID]int{}
+		}
+		switch t.Type {
+		case sdl.FINGERDOWN:
+			key := k.keyAt(x, y)
+			if key == -1 {
+				return false
+			}
+			k.fingers[t.FingerID] = key
+			inst.Keys[key] = true
+		case sdl.FINGERMOTION:
+			// Sliding onto another key presses that one instead
+			key, ok := k.fingers[t.FingerID]
+			if !ok {
+				return false
+			}
+			if next := k.keyAt(x, y); next != key {
+				inst.Keys[key] = false
+				if next == -1 {
+					delete(k.fingers, t.FingerID)
+				} else {
+					k.fingers[t.FingerID] = next
+					inst.Keys[next] = true
+				}
+			}
+		case sdl.FINGERUP:
+			key, ok := k.fingers[t.FingerID]
+			if !ok {
+				return false
+			}
+			delete(k.fingers, t.FingerID)
+			inst.Keys[key] = false
+		}
+		return true
+	}
+	return false
+}
+
+// Draw draws the keypad over the bottom right corner of the screen of inst,
+// half as high as the screen. Held keys are filled, keys the program read
+// lately are outlined, and all of them are while it waits with FX0A.
+func (k *Keypad) Draw(renderer *sdl.Renderer, texts *TextCache, inst *Instance, screen sdl.Rect) {
+	size := min(screen.W, screen.H) / 2
+	k.bounds = sdl.Rect{X: screen.X + screen.W - size - 8, Y: screen.Y + screen.H - size - 8, W: size, H: size}
+	now := sdl.GetTicks()
+	waiting := now-k.waited < keyReadHighlight
+
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	defer renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+	for i, key := range keypadLayout {
+		cell := sdl.Rect{
+			X: k.bounds.X + int32(i%4)*size/4 + 2,
+			Y: k.bounds.Y + int32(i/4)*size/4 + 2,
+			W: size/4 - 4,
+			H: size/4 - 4,
+		}
+		labelColor := white
+		if inst.Keys[key] {
+			renderer.SetDrawColor(255, 255, 255, 192)
+			labelColor = sdl.Color{R: 0, G: 0, B: 0, A: 255}
+		} else {
+			renderer.SetDrawColor(64, 64, 64, 160)
+		}
+		renderer.FillRect(&cell)
+		if waiting || now-k.read[key] < keyReadHighlight {
+			renderer.SetDrawColor(230, 159, 0, 255)
+			renderer.DrawRect(&cell)
+			renderer.DrawRect(&sdl.Rect{X: cell.X + 1, Y: cell.Y + 1, W: cell.W - 2, H: cell.H - 2})
+		}
+
+		label := fmt.Sprintf("%X", key)
+		w, h, err := texts.Size(label)
+		if err != nil {
+			slog.Error("Failed to render text", "err", err)
+			return
+		}
+		texts.Draw(label, labelColor, cell.X+(cell.W-w)/2, cell.Y+(cell.H-h)/2)
+	}
+}
+
+// DrawInput draws the input overlay in the top left corner of the screen of
+// inst: the keypad as the machine sees it, held keys in yellow, and the last
+// time the program waited for a key with FX0A.
+func (k *Keypad) DrawInput(renderer *sdl.Renderer, texts *TextCache, inst *Instance, screen sdl.Rect) {
+	lineHeight := int32(fontSize) + 2
+	charWidth, _, err := texts.Size("0 ")
+	if err != nil {
+		slog.Error("Failed to render text", "err", err)
+		return
+	}
+
+	wait := "FX0A not run yet"
+	if w := k.wait; w.start != 0 {
+		wait = fmt.Sprintf("FX0A at %03X into V%X: waiting %.1f s", w.pc, w.reg, float64(sdl.GetTicks()-w.start)/1000)
+		if w.end != 0 {
+			wait = fmt.Sprintf("FX0A at %03X into V%X: got %X after %.1f s", w.pc, w.reg, w.key, float64(w.end-w.start)/1000)
+		}
+	}
+	waitWidth, _, err := texts.Size(wait)
+	if err != nil {
+		slog.Error("Failed to render text", "err", err)
+		return
+	}
+
+	box := sdl.Rect{X: screen.X + 8, Y: screen.Y + 8, W: max(4*charWidth, waitWidth) + 16, H: 5*lineHeight + 16}
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	renderer.SetDrawColor(0, 0, 0, 192)
+	renderer.FillRect(&box)
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+
+	for i, key := range keypadLayout {
+		color := white
+		if inst.CPU.Keypad[key] != 0 {
+			color = yellow
+		}
+		x := box.X + 8 + int32(i%4)*charWidth
+		y := box.Y + 8 + int32(i/4)*lineHeight
+		texts.Draw(fmt.Sprintf("%X", key), color, x, y)
+	}
+	texts.Draw(wait, white, box.X+8, box.Y+8+4*lineHeight)
+}
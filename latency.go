@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// How many key presses the input latency HUD averages
+const latencySamples = 32
+
+// latencySample is how long a key press took to reach the program
+type latencySample struct {
+	ms     uint32
+	frames int64
+}
+
+// LatencyMeter measures the input latency, from the time SDL stamped a key
+// press with to the instruction that first saw the key held: EX9E, EXA1 or
+// FX0A. Shown with -latency-hud or <Ctrl>+<F2>, for tuning -ipf, the
+// bursts and the buffers of the frontend.
+type LatencyMeter struct {
+	// The key presses not seen yet, by key: when they happened and the
+	// frames drawn by then. A zero time is no press.
+	pressed      [16]uint32
+	pressedFrame [16]int64
+
+	samples [latencySamples]latencySample
+	next    int
+	count   int
+}
+
+// keyDown notes a press of a key of the keypad, at the SDL timestamp of the event
+func (l *LatencyMeter) keyDown(key int, timestamp uint32) {
+	// zero is no press, a press in the first millisecond can do without
+	l.pressed[key], l.pressedFrame[key] = max(timestamp, 1), statFrames.Value()
+}
+
+// noteRead is called along with the OnKeyRead hook of the machine, a press
+// is measured once the program reads the key while it is held
+func (l *LatencyMeter) noteRead(cpu *chip8.CPU, key int) {
+	keys := []int{key}
+	if key == -1 {
+		keys = keys[:0]
+		for i := range cpu.Keypad {
+			keys = append(keys, i)
+		}
+	}
+	for _, k := range keys {
+		if k >= len(l.pressed) || l.pressed[k] == 0 || cpu.Keypad[k] == 0 {
+			continue
+		}
+		s := latencySample{ms: sdl.GetTicks() - l.pressed[k], frames: statFrames.Value() - l.pressedFrame[k]}
+		l.pressed[k] = 0
+		l.samples[l.next] = s
+		l.next = (l.next + 1) % latencySamples
+		l.count = min(l.count+1, latencySamples)
+		slog.Debug("Input latency", "key", fmt.Sprintf("%X", k), "ms", s.ms, "frames", s.frames)
+	}
+}
+
+// Draw shows the last latency measured and those of the last presses in
+// the top right corner of screen, with the latency of the sound
+func (l *LatencyMeter) Draw(renderer *sdl.Renderer, texts *TextCache, screen sdl.Rect) {
+	lines := []string{tr("Input latency: press a key the game reads")}
+	if l.count > 0 {
+		last := l.samples[(l.next+latencySamples-1)%latencySamples]
+		var total, worst uint32
+		for _, s := range l.samples[:l.count] {
+			total += s.ms
+			worst = max(worst, s.ms)
+		}
+		lines = []string{
+			tr("Input latency: %d ms, %d frames", last.ms, last.frames),
+			tr("Last %d keys: %.1f ms on average, %d ms at worst", l.count, float64(total)/float64(l.count), worst),
+		}
+	}
+	if beeper != nil {
+		lines = append(lines, tr("Sound: %s, %.0f ms behind the sound timer", beeper, beeper.Latency()))
+	}
+
+	lineHeight := int32(fontSize) + 2
+	var width int32
+	for _, line := range lines {
+		w, _, err := texts.Size(line)
+		if err != nil {
+			slog.Error("Failed to render text", "err", err)
+			return
+		}
+		width = max(width, w)
+	}
+	box := sdl.Rect{W: width + 16, H: int32(len(lines))*lineHeight + 16}
+	box.X, box.Y = screen.X+screen.W-box.W-8, screen.Y+8
+
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	renderer.SetDrawColor(0, 0, 0, 192)
+	renderer.FillRect(&box)
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+	for i, line := range lines {
+		if _, _, err := texts.Draw(line, white, box.X+8, box.Y+8+int32(i)*lineHeight); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+}
@@ -1,9 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
 
 	"github.com/petersid2022/chip8/cmd"
 	sdl "github.com/veandco/go-sdl2/sdl"
@@ -17,13 +32,68 @@ var (
 	target_fps          uint32 = 60
 )
 
+// Command line options
+var (
+	memorySize     int
+	strictMemory   bool
+	loadAddress    int
+	machine        string
+	quirksName     string
+	quirks         chip8.Quirks
+	fontData       []uint8
+	frameIPF       int
+	windowScale    int
+	integerScaling bool
+	showGrid       bool
+	showKeypad     bool
+	showInput      bool
+	showPerf       bool
+	showLatency    bool
+	crtEffects     bool
+	antiFlicker    bool
+	showChanges    bool
+	reduceFlashes  bool
+	keycodeMapping bool
+	textScale      float64
+	frameBlend     float64
+	frameSkip      int
+	audioRate      int
+	audioBuffer    int
+	volume         int
+	muted          bool
+	beepRamp       float64
+	borderColor    sdl.Color
+	verbose        bool
+	logLevel       string
+	logFile        string
+	splitScreen    bool
+	splitRom       string
+	netHost        string
+	netJoin        string
+	apiAddr        string
+	romPath        string
+	watchPath      string
+	watchKeep      bool
+	deterministic  bool
+	opcodeStatsTo  string
+	consoleAddress = -1 // -1 without -console
+	pauseMinimized bool
+	pauseUnfocused bool
+	attractDelay   int
+	keepAwake      bool
+	kiosk          bool
+	onInvalid      string
+)
+
 //go:embed font.ttf
 var contentfont embed.FS
 var fontSize = 24
 
 type MenuItem struct {
-	Text   string
-	Bounds sdl.Rect
+	Text     string
+	Bounds   sdl.Rect
+	Index    int // position in the ROM directory
+	Selected bool
 }
 
 func mapKey(sdlKey sdl.Keycode) int {
@@ -68,92 +138,462 @@ func mapKey(sdlKey sdl.Keycode) int {
 //go:embed roms
 var content embed.FS
 
-func showMenu(renderer *sdl.Renderer, font *ttf.Font) string {
-	files, err := content.ReadDir("roms")
+// romFiles lists the ROMs in the roms directory
+func romFiles() ([]fs.DirEntry, error) {
+	return listRoms(content, "roms")
+}
+
+// The name of the ROM read from stdin with -rom -, and its contents
+const stdinRom = "-"
+
+var stdinData []byte
+
+// menuRoms lists the ROMs of the menu, the bundled ones and then those
+// downloaded to the user ROM directory, along with the names to load them by:
+// the path of the downloaded ones.
+func menuRoms() ([]fs.DirEntry, []string, error) {
+	files, err := romFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Name())
+	}
+
+	dir, err := userRomDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	downloaded, err := listRoms(os.DirFS(dir), ".")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	for _, file := range downloaded {
+		files = append(files, file)
+		paths = append(paths, filepath.Join(dir, file.Name()))
+	}
+	return files, paths, nil
+}
+
+// readRomFile reads a file of the roms directory. ROMs and the files that go
+// along with them are read from the copy built into the binary, so they are
+// found whatever the working directory is, or on systems without one to
+// speak of like Android. Absolute paths, like those of ROMs picked with the
+// file dialog, are read from the disk.
+func readRomFile(name string) ([]byte, error) {
+	if name == stdinRom {
+		return stdinData, nil
+	}
+	if !filepath.IsAbs(name) {
+		return content.ReadFile(path.Join("roms", name))
+	}
+	if archive, member, ok := splitZip(name); ok {
+		return readZipRom(archive, member)
+	}
+	return os.ReadFile(name)
+}
+
+// openRomFile opens a file of the roms directory, see readRomFile
+func openRomFile(name string) (io.ReadCloser, error) {
+	if !filepath.IsAbs(name) {
+		return content.Open(path.Join("roms", name))
+	}
+	if archive, member, ok := splitZip(name); ok {
+		data, err := readZipRom(archive, member)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return os.Open(name)
+}
+
+// listRoms lists the ROMs in a directory, leaving out the files that go along with them
+func listRoms(fsys fs.FS, dir string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []fs.DirEntry
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case symbolsSuffix, lineInfoSuffix, sourceSuffix:
+		default:
+			if entry.Name() != romIndexFile {
+				files = append(files, entry)
+			}
+		}
+	}
+	return files, nil
+}
+
+func showMenu(window *sdl.Window, renderer *sdl.Renderer, texts *TextCache) string {
+	files, paths, err := menuRoms()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to read ROM directory: %s\n", err)
+		showError(window, "Failed to read ROM directory", err)
 		return ""
 	}
 
-	menuItems := make([]MenuItem, len(files))
+	// The menu is laid out for winWidth x winHeight and scaled to the window
+	renderer.SetLogicalSize(winWidth, winHeight)
+
 	lineHeight := fontSize + 10
 
-	const itemsPerColumn = 10
-	columnWidth := winWidth / 4
-	numColumns := (len(files) + itemsPerColumn - 1) / itemsPerColumn
-	columnSpacing := (winWidth - int32(numColumns)*columnWidth) / (int32(numColumns) + 1)
+	// Larger text doesn't leave room for the hints on the right of the
+	// settings, they go on rows of their own above them. The ROMs get the
+	// rows left above the settings and the search box, in fewer columns.
+	stackHints := textScale > 1
+	settingsRows := 3
+	if stackHints {
+		settingsRows = 6
+	}
+	itemsPerColumn := (int(winHeight) - 96 - settingsRows*(fontSize+8) - fontSize - 24) / lineHeight
+	maxColumns := int(4 / textScale)
+	columnWidth := winWidth / int32(maxColumns)
 
-	for i, file := range files {
-		columnIndex := i / itemsPerColumn
-		itemIndex := i % itemsPerColumn
-		itemText := fmt.Sprintf("%d) %s", i+1, file.Name())
-		itemRect := sdl.Rect{
-			X: (int32(columnIndex) * (columnWidth + columnSpacing)) + columnSpacing,
-			Y: 96 + (int32(lineHeight) * int32(itemIndex)),
-			W: columnWidth,
-			H: int32(lineHeight),
+	// With ROM descriptions the last column describes the selected ROM
+	index, err := readRomIndex()
+	if err != nil {
+		slog.Warn("Failed to read the ROM descriptions", "err", err)
+	}
+	for _, rom := range archiveRoms {
+		if _, ok := index[rom.Name+".ch8"]; !ok {
+			if index == nil {
+				index = map[string]RomMeta{}
+			}
+			index[rom.Name+".ch8"] = RomMeta{Title: rom.Title}
 		}
-		menuItems[i] = MenuItem{Text: itemText, Bounds: itemRect}
 	}
+	listWidth := winWidth
+	if len(index) > 0 && maxColumns > 1 {
+		maxColumns--
+		listWidth -= columnWidth
+	}
+
+	// Keyboard selection (an index into the ROMs matching the search) and
+	// the first column shown when there are more ROMs than fit on screen
+	selected := 0
+	firstColumn := 0
+
+	// Typing a number selects the ROM with that index, digits typed
+	// within a second of each other make up a single number
+	number := 0
+	var numberTicks uint32
+
+	// Type-to-filter search, started with "/"
+	searching := false
+	filter := ""
+
+	// Previews of the ROMs, rendered once the selection rests on one for a moment
+	previews := map[int]*Frame{}
+	previewIndex := -1
+	var previewTicks uint32
+
+	// A ROM plays behind the menu once it was left alone for a while
+	var attract Attract
+	inputTicks := sdl.GetTicks()
 
 	for {
+		var matches []int
+		for i, file := range files {
+			name := file.Name() + " " + index[file.Name()].Title
+			if strings.Contains(strings.ToLower(name), strings.ToLower(filter)) {
+				matches = append(matches, i)
+			}
+		}
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+
+		// Scroll so that the selected column is visible
+		numColumns := (len(matches) + itemsPerColumn - 1) / itemsPerColumn
+		visibleColumns := numColumns
+		if visibleColumns > maxColumns {
+			visibleColumns = maxColumns
+		}
+		if column := selected / itemsPerColumn; column < firstColumn {
+			firstColumn = column
+		} else if column >= firstColumn+maxColumns {
+			firstColumn = column - maxColumns + 1
+		}
+		if firstColumn > numColumns-visibleColumns {
+			firstColumn = numColumns - visibleColumns
+		}
+		spacedColumns := int32(visibleColumns)
+		if spacedColumns == 0 {
+			spacedColumns = 1
+		}
+		columnSpacing := (listWidth - spacedColumns*columnWidth) / (spacedColumns + 1)
+
+		// Note when the selection moved, to know how long it has been resting
+		if len(matches) > 0 && matches[selected] != previewIndex {
+			previewIndex = matches[selected]
+			previewTicks = sdl.GetTicks()
+		}
+		if len(matches) == 0 {
+			previewIndex = -1
+		}
+
+		var menuItems []MenuItem
+		for pos, i := range matches {
+			columnIndex := pos/itemsPerColumn - firstColumn
+			if columnIndex < 0 || columnIndex >= visibleColumns {
+				continue
+			}
+			itemIndex := pos % itemsPerColumn
+			itemRect := sdl.Rect{
+				X: (int32(columnIndex) * (columnWidth + columnSpacing)) + columnSpacing,
+				Y: 96 + (int32(lineHeight) * int32(itemIndex)),
+				W: columnWidth,
+				H: int32(lineHeight),
+			}
+			title := files[i].Name()
+			if meta, ok := index[title]; ok && meta.Title != "" {
+				title = meta.Title
+			}
+			menuItems = append(menuItems, MenuItem{
+				Text:     fmt.Sprintf("%d) %s", i+1, title),
+				Bounds:   itemRect,
+				Index:    i,
+				Selected: pos == selected,
+			})
+		}
+
 		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch event.(type) {
+			case *sdl.KeyboardEvent, *sdl.TextInputEvent, *sdl.MouseButtonEvent, *sdl.MouseMotionEvent, *sdl.MouseWheelEvent, *sdl.TouchFingerEvent:
+				inputTicks = sdl.GetTicks()
+				// The input that wakes the menu up does nothing else
+				if attract.running() {
+					attract.stop()
+					continue
+				}
+			}
+
 			switch t := event.(type) {
 			case *sdl.QuitEvent:
 				return ""
 			case *sdl.MouseButtonEvent:
 				if t.Type == sdl.MOUSEBUTTONDOWN {
-					for i, item := range menuItems {
+					for _, item := range menuItems {
 						if t.X >= item.Bounds.X && t.X < item.Bounds.X+item.Bounds.W &&
 							t.Y >= item.Bounds.Y && t.Y < item.Bounds.Y+item.Bounds.H {
-							return files[i].Name()
+							return paths[item.Index]
 						}
 					}
 				}
+			case *sdl.MouseMotionEvent:
+				// The item under the mouse cursor becomes the selection
+				for _, item := range menuItems {
+					if t.X >= item.Bounds.X && t.X < item.Bounds.X+item.Bounds.W &&
+						t.Y >= item.Bounds.Y && t.Y < item.Bounds.Y+item.Bounds.H {
+						for pos, i := range matches {
+							if i == item.Index {
+								selected = pos
+							}
+						}
+					}
+				}
+			case *sdl.MouseWheelEvent:
+				// Scroll a column per notch, dragging the selection along
+				firstColumn -= int(t.Y)
+				if firstColumn > numColumns-visibleColumns {
+					firstColumn = numColumns - visibleColumns
+				}
+				if firstColumn < 0 {
+					firstColumn = 0
+				}
+				if column := selected / itemsPerColumn; column < firstColumn {
+					selected = firstColumn*itemsPerColumn + selected%itemsPerColumn
+				} else if column >= firstColumn+visibleColumns {
+					selected = (firstColumn+visibleColumns-1)*itemsPerColumn + selected%itemsPerColumn
+				}
+				// The last column may be shorter than the others
+				if selected >= len(matches) {
+					selected = len(matches) - 1
+				}
+			case *sdl.TextInputEvent:
+				if searching {
+					filter += t.GetText()
+					selected = 0
+				}
 			case *sdl.KeyboardEvent:
 				// Handle key down event
-				if t.Type == sdl.KEYDOWN {
-					// Exit the game if the "Backspace" key is pressed
-					if t.Keysym.Sym == sdl.K_ESCAPE {
-						// restart the game
-						fmt.Println("Exiting")
-						return ""
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+
+				if handleScaleKey(window, t) {
+					break
+				}
+
+				// Move the selection around with the arrow keys, <Enter> plays it
+				switch t.Keysym.Sym {
+				case sdl.K_UP:
+					if selected > 0 {
+						selected--
 					}
-					if t.Keysym.Sym == sdl.K_i {
-						// increment by -5 target_fps
-						// until target_fps is 0
-						if target_fps > 0 {
-							target_fps -= 5
-						}
+				case sdl.K_DOWN:
+					if selected < len(matches)-1 {
+						selected++
 					}
-					if t.Keysym.Sym == sdl.K_p {
-						// increment by +5 target_fps
-						if target_fps < 100 {
-							target_fps += 5
-						}
+				case sdl.K_LEFT:
+					if selected >= itemsPerColumn {
+						selected -= itemsPerColumn
 					}
-					if t.Keysym.Sym == sdl.K_j {
-						// increment by -100 delay
-						// if delay is 100 do nothing
-						if delay > 100 {
-							delay -= 100
-						}
+				case sdl.K_RIGHT:
+					if selected+itemsPerColumn < len(matches) {
+						selected += itemsPerColumn
+					}
+				case sdl.K_PAGEUP:
+					selected -= itemsPerColumn * maxColumns
+					firstColumn -= maxColumns
+					if selected < 0 {
+						selected = 0
+					}
+					if firstColumn < 0 {
+						firstColumn = 0
+					}
+				case sdl.K_PAGEDOWN:
+					selected += itemsPerColumn * maxColumns
+					firstColumn += maxColumns
+					if selected >= len(matches) {
+						selected = len(matches) - 1
 					}
-					if t.Keysym.Sym == sdl.K_l {
-						// increment by +100 delay
-						// if delay is 1000 do nothing
-						if delay < 1000 {
-							delay += 100
+					if firstColumn > numColumns-visibleColumns {
+						firstColumn = numColumns - visibleColumns
+					}
+				case sdl.K_RETURN, sdl.K_KP_ENTER:
+					// Several keys may have moved the selection since it was last clamped
+					if selected >= 0 && selected < len(matches) {
+						return paths[matches[selected]]
+					}
+				}
+
+				// While searching the keyboard types into the search box
+				if searching {
+					switch t.Keysym.Sym {
+					case sdl.K_ESCAPE:
+						searching = false
+						filter = ""
+					case sdl.K_BACKSPACE:
+						if len(filter) > 0 {
+							_, size := utf8.DecodeLastRuneInString(filter)
+							filter = filter[:len(filter)-size]
 						}
 					}
+					break
 				}
 
+				// Exit the game if the "Escape" key is pressed, or the
+				// combination of a -kiosk cabinet
+				if (t.Keysym.Sym == sdl.K_ESCAPE && !kiosk) || (kiosk && keyKioskExit.Is(t.Keysym)) {
+					slog.Info("Exiting")
+					return ""
+				}
+				if t.Keysym.Sym == sdl.K_SLASH {
+					searching = true
+					// Don't type the "/" itself into the search box
+					sdl.FlushEvent(sdl.TEXTINPUT)
+				}
+				if t.Keysym.Sym == sdl.K_q {
+					showQuirks(renderer, texts)
+					previews, previewIndex = map[int]*Frame{}, -1
+				}
+				if t.Keysym.Sym == sdl.K_t {
+					showSelfTest(renderer, texts)
+					previews, previewIndex = map[int]*Frame{}, -1
+				}
+				if t.Keysym.Sym == sdl.K_d {
+					showDownloads(window, renderer, texts)
+					if files, paths, err = menuRoms(); err != nil {
+						showError(window, "Failed to read ROM directory", err)
+						return ""
+					}
+					previews, previewIndex = map[int]*Frame{}, -1
+				}
+				if t.Keysym.Sym == sdl.K_o {
+					path, err := chooseFile(tr("Open ROM"))
+					if err != nil {
+						showError(window, "Failed to show the file dialog", err)
+						break
+					}
+					// Archives hold as many ROMs as they like
+					if _, _, ok := splitZip(path); ok {
+						path = chooseZipRom(window, renderer, texts, path)
+					}
+					if path != "" {
+						return path
+					}
+				}
+				if t.Keysym.Sym >= sdl.K_0 && t.Keysym.Sym <= sdl.K_9 {
+					now := sdl.GetTicks()
+					if now-numberTicks > 1000 {
+						number = 0
+					}
+					number = number*10 + int(t.Keysym.Sym-sdl.K_0)
+					numberTicks = now
+					for pos, i := range matches {
+						if i+1 == number {
+							selected = pos
+						}
+					}
+				}
+				if t.Keysym.Sym == sdl.K_i {
+					// increment by -5 target_fps
+					// until target_fps is 0
+					if target_fps > 0 {
+						target_fps -= 5
+					}
+				}
+				if t.Keysym.Sym == sdl.K_p {
+					// increment by +5 target_fps
+					if target_fps < 100 {
+						target_fps += 5
+					}
+				}
+				if t.Keysym.Sym == sdl.K_j {
+					// increment by -100 delay
+					// if delay is 100 do nothing
+					if delay > 100 {
+						delay -= 100
+					}
+				}
+				if t.Keysym.Sym == sdl.K_l {
+					// increment by +100 delay
+					// if delay is 1000 do nothing
+					if delay < 1000 {
+						delay += 100
+					}
+				}
+				if t.Keysym.Sym == sdl.K_LEFTBRACKET {
+					setScale(window, windowScale-1)
+				}
+				if t.Keysym.Sym == sdl.K_RIGHTBRACKET {
+					setScale(window, windowScale+1)
+				}
+				if t.Keysym.Sym == sdl.K_u {
+					integerScaling = !integerScaling
+				}
 			}
 		}
 
 		renderer.SetDrawColor(0, 0, 0, 255)
 		renderer.Clear()
 
+		if attractDelay > 0 && !attract.running() && sdl.GetTicks()-inputTicks > uint32(attractDelay)*1000 {
+			attract.start(paths)
+			// Don't try again right away if no ROM could start
+			inputTicks = sdl.GetTicks()
+		}
+		if attract.running() {
+			attract.draw(renderer, paths)
+		}
+
 		// -----------------------------
 		// -----------------------------
 		// -----------------------------
@@ -162,21 +602,9 @@ func showMenu(renderer *sdl.Renderer, font *ttf.Font) string {
 		// -----------------------------
 		// -----------------------------
 
-		textSurface, err := font.RenderUTF8Solid("Click on a ROM to play", sdl.Color{R: 255, G: 255, B: 255, A: 255})
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to render text: %s\n", err)
-			return ""
-		}
-		defer textSurface.Free()
-		textTexture, err := renderer.CreateTextureFromSurface(textSurface)
+		textTexture, textWidth, textHeight, err := texts.Texture(tr("Click on a ROM to play"), white)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create texture: %s\n", err)
-			return ""
-		}
-		defer textTexture.Destroy()
-		_, _, textWidth, textHeight, err := textTexture.Query()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to query texture: %s\n", err)
+			showError(window, "Failed to render text", err)
 			return ""
 		}
 		textX := (winWidth - 2*textWidth) / 2
@@ -191,26 +619,14 @@ func showMenu(renderer *sdl.Renderer, font *ttf.Font) string {
 		// -----------------------------
 		// -----------------------------
 
-		delaySurface, err := font.RenderUTF8Solid(fmt.Sprintf("delay: %d (j: -100, l: +100)", delay), sdl.Color{R: 255, G: 255, B: 255, A: 255})
+		delayText := tr("delay: %d (j: -100, l: +100)", delay)
+		_, delayHeight, err := texts.Size(delayText)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to render text: %s\n", err)
+			showError(window, "Failed to render text", err)
 			return ""
 		}
-		defer delaySurface.Free()
-		delayTexture, err := renderer.CreateTextureFromSurface(delaySurface)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create texture: %s\n", err)
-			return ""
-		}
-		defer delayTexture.Destroy()
-		_, _, delayWidth, delayHeight, err := delayTexture.Query()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to query texture: %s\n", err)
-			return ""
-		}
-		// delayX := (winWidth - delayWidth) / 8
 		delayY := int32(winHeight - delayHeight - 8)
-		renderer.Copy(delayTexture, nil, &sdl.Rect{X: columnSpacing, Y: delayY, W: delayWidth, H: delayHeight})
+		texts.Draw(delayText, white, columnSpacing, delayY)
 
 		// -----------------------------
 		// -----------------------------
@@ -220,56 +636,80 @@ func showMenu(renderer *sdl.Renderer, font *ttf.Font) string {
 		// -----------------------------
 		// -----------------------------
 
-		target_fpsSurface, err := font.RenderUTF8Solid(fmt.Sprintf("target_fps: %d (i: -5, p: +5)", target_fps), sdl.Color{R: 255, G: 255, B: 255, A: 255})
+		target_fpsText := tr("target_fps: %d (i: -5, p: +5)", target_fps)
+		_, target_fpsHeight, err := texts.Size(target_fpsText)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to render text: %s\n", err)
+			showError(window, "Failed to render text", err)
 			return ""
 		}
-		defer target_fpsSurface.Free()
-		target_fpsTexture, err := renderer.CreateTextureFromSurface(target_fpsSurface)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create texture: %s\n", err)
-			return ""
+		target_fpsY := int32(winHeight - target_fpsHeight - 8 - delayHeight - 8)
+		texts.Draw(target_fpsText, white, columnSpacing, target_fpsY)
+
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+		// SCALE TEXT
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+
+		integerText := tr("off")
+		if integerScaling {
+			integerText = tr("on")
 		}
-		defer target_fpsTexture.Destroy()
-		_, _, target_fpsWidth, target_fpsHeight, err := target_fpsTexture.Query()
+		scaleText := tr("scale: %dx ([: -1, ]: +1), integer: %s (u)", windowScale, integerText)
+		_, scaleHeight, err := texts.Size(scaleText)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to query texture: %s\n", err)
+			showError(window, "Failed to render text", err)
 			return ""
 		}
-		// target_fpsX := (winWidth - target_fpsWidth) / 8
-		target_fpsY := int32(winHeight - target_fpsHeight - 8 - delayHeight - 8)
-		renderer.Copy(target_fpsTexture, nil, &sdl.Rect{X: columnSpacing, Y: target_fpsY, W: target_fpsWidth, H: target_fpsHeight})
+		scaleY := target_fpsY - scaleHeight - 8
+		texts.Draw(scaleText, white, columnSpacing, scaleY)
 
 		// -----------------------------
 		// -----------------------------
 		// -----------------------------
-		// Render "Credits" text
+		// QUIRKS TEXT
 		// -----------------------------
 		// -----------------------------
 		// -----------------------------
 
-		creditsSurface, err := font.RenderUTF8Solid("(c) Peter Sideris 2023", sdl.Color{R: 255, G: 255, B: 255, A: 255})
+		quirksText := tr("<Q> quirks: %s", quirksLabel())
+		quirksWidth, _, err := texts.Size(quirksText)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to render text: %s\n", err)
+			showError(window, "Failed to render text", err)
 			return ""
 		}
-		defer creditsSurface.Free()
-		creditsTexture, err := renderer.CreateTextureFromSurface(creditsSurface)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create texture: %s\n", err)
-			return ""
+		quirksX, quirksY := winWidth-columnSpacing-quirksWidth, scaleY
+		if stackHints {
+			quirksX, quirksY = columnSpacing, scaleY-3*(scaleHeight+8)
 		}
-		defer creditsTexture.Destroy()
-		_, _, creditsWidth, creditsHeight, err := creditsTexture.Query()
+		texts.Draw(quirksText, white, quirksX, quirksY)
+
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+		// Render "Credits" text
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+
+		// The version of the build for a moment, for bug reports
+		creditsText := "(c) Peter Sideris 2023"
+		if sdl.GetTicks() < versionShown {
+			creditsText = "chip8 " + releaseVersion()
+		}
+		creditsWidth, _, err := texts.Size(creditsText)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to query texture: %s\n", err)
+			showError(window, "Failed to render text", err)
 			return ""
 		}
-		// creditsX := (winWidth - creditsWidth) / 2
 		creditsX := (winWidth - columnSpacing - creditsWidth)
 		creditsY := int32(winHeight - delayHeight - 8)
-		renderer.Copy(creditsTexture, nil, &sdl.Rect{X: creditsX, Y: creditsY, W: creditsWidth, H: creditsHeight})
+		if stackHints {
+			creditsX, creditsY = columnSpacing, scaleY-scaleHeight-8
+		}
+		texts.Draw(creditsText, white, creditsX, creditsY)
 
 		// -----------------------------
 		// -----------------------------
@@ -279,26 +719,95 @@ func showMenu(renderer *sdl.Renderer, font *ttf.Font) string {
 		// -----------------------------
 		// -----------------------------
 
-		exitSurface, err := font.RenderUTF8Solid("Press <Escape> to exit.", sdl.Color{R: 255, G: 255, B: 255, A: 255})
+		exitText := tr("<D> more ROMs, <T> self test, <Escape> to exit")
+		exitWidth, _, err := texts.Size(exitText)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to render text: %s\n", err)
+			showError(window, "Failed to render text", err)
 			return ""
 		}
-		defer exitSurface.Free()
-		exitTexture, err := renderer.CreateTextureFromSurface(exitSurface)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to create texture: %s\n", err)
-			return ""
+		exitX := (winWidth - columnSpacing - exitWidth)
+		exitY := int32(winHeight - target_fpsHeight - 8 - delayHeight - 8)
+		if stackHints {
+			exitX, exitY = columnSpacing, creditsY-scaleHeight-8
 		}
-		defer exitTexture.Destroy()
-		_, _, exitWidth, exitHeight, err := exitTexture.Query()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to query texture: %s\n", err)
+		texts.Draw(exitText, white, exitX, exitY)
+
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+		// Render the scrollbar
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+
+		if numColumns > visibleColumns {
+			track := sdl.Rect{X: columnSpacing, Y: 96 + int32(lineHeight*itemsPerColumn) + 4, W: listWidth - 2*columnSpacing, H: 6}
+			renderer.SetDrawColor(64, 64, 64, 255)
+			renderer.FillRect(&track)
+			renderer.SetDrawColor(255, 255, 255, 255)
+			renderer.FillRect(&sdl.Rect{
+				X: track.X + track.W*int32(firstColumn)/int32(numColumns),
+				Y: track.Y,
+				W: track.W * int32(visibleColumns) / int32(numColumns),
+				H: track.H,
+			})
+		}
+
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+		// Render the search box
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+
+		searchText := tr("</> search, <O> open a file, <Enter> play")
+		if searching {
+			searchText = tr("Search: %s_", filter)
+		}
+		if _, _, err := texts.Draw(searchText, white, columnSpacing, 96+int32(lineHeight*itemsPerColumn)+16); err != nil {
+			showError(window, "Failed to render text", err)
 			return ""
 		}
-		exitX := (winWidth - columnSpacing - exitWidth)
-		exitY := int32(winHeight - target_fpsHeight - 8 - delayHeight - 8)
-		renderer.Copy(exitTexture, nil, &sdl.Rect{X: exitX, Y: exitY, W: exitWidth, H: exitHeight})
+
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+		// Render the description of the selected ROM
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+
+		if previewIndex != -1 {
+			if meta, ok := index[files[previewIndex].Name()]; ok {
+				drawRomMeta(renderer, texts, meta, sdl.Rect{X: listWidth, Y: 96, W: columnWidth - 8, H: int32(lineHeight * itemsPerColumn)})
+			}
+		}
+
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+		// Render the preview of the selected ROM
+		// -----------------------------
+		// -----------------------------
+		// -----------------------------
+
+		if previewIndex != -1 && sdl.GetTicks()-previewTicks > 500 {
+			preview, ok := previews[previewIndex]
+			if !ok {
+				var err error
+				if preview, err = previewRom(paths[previewIndex]); err != nil {
+					slog.Warn("Failed to preview ROM", "rom", files[previewIndex].Name(), "err", err)
+				}
+				previews[previewIndex] = preview
+			}
+			if preview != nil {
+				thumb := sdl.Rect{X: winWidth - columnSpacing - 128, Y: 96 + int32(lineHeight*itemsPerColumn) + 16, W: 128, H: 64}
+				renderer.SetDrawColor(96, 96, 96, 255)
+				renderer.DrawRect(&sdl.Rect{X: thumb.X - 1, Y: thumb.Y - 1, W: thumb.W + 2, H: thumb.H + 2})
+				drawDisplay(renderer, *preview, thumb)
+			}
+		}
 
 		// -----------------------------
 		// -----------------------------
@@ -309,28 +818,88 @@ func showMenu(renderer *sdl.Renderer, font *ttf.Font) string {
 		// -----------------------------
 
 		for _, item := range menuItems {
-			itemSurface, err := font.RenderUTF8Solid(item.Text, sdl.Color{R: 255, G: 255, B: 255, A: 255})
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to render text: %s\n", err)
-				return ""
+			// Highlight the selection (under the mouse cursor or picked with the keyboard)
+			if item.Selected {
+				renderer.SetDrawColor(64, 64, 64, 255)
+				renderer.FillRect(&item.Bounds)
 			}
-			defer itemSurface.Free()
 
-			itemTexture, err := renderer.CreateTextureFromSurface(itemSurface)
+			itemTexture, _, _, err := texts.Texture(item.Text, white)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to create texture: %s\n", err)
+				showError(window, "Failed to render text", err)
 				return ""
 			}
-			defer itemTexture.Destroy()
-
 			renderer.Copy(itemTexture, nil, &item.Bounds)
 		}
 
 		renderer.Present()
+		texts.Sweep()
 		sdl.Delay(16)
 	}
 }
 
+// Return values of run and play
+const (
+	runQuit    = 0 // the user quit
+	runRestart = 1 // go back to the menu
+	runFailed  = 2 // the frontend couldn't be set up, the user has been told why
+)
+
+// showError logs a failure and shows it to the user in a message box, on top of window if there is one.
+// A -kiosk cabinet only logs it, there is no one to close the box.
+func showError(window *sdl.Window, message string, err error) {
+	slog.Error(message, "err", err)
+	if kiosk {
+		return
+	}
+	if err := sdl.ShowSimpleMessageBox(sdl.MESSAGEBOX_ERROR, winTitle, fmt.Sprintf("%s:\n%s", message, err), window); err != nil {
+		slog.Error("Failed to show message box", "err", err)
+	}
+}
+
+// requestQuit queues a quit event. Screens of their own that stop at a quit
+// event queue it again, for the screen they were opened from to quit too.
+func requestQuit() {
+	sdl.PushEvent(&sdl.QuitEvent{Type: sdl.QUIT, Timestamp: sdl.GetTicks()})
+}
+
+// readFont returns a built-in font set by name, or reads one from a file
+func readFont(name string) ([]uint8, error) {
+	if font, ok := chip8.Font(name); ok {
+		return font, nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return chip8.ParseFont(data)
+}
+
+// Number of instructions run to render the preview of a ROM
+const previewCycles = 500
+
+// previewRom runs a ROM headlessly for a moment and returns what it drew
+func previewRom(romName string) (*Frame, error) {
+	data, err := readRomFile(romName)
+	if err != nil {
+		return nil, err
+	}
+
+	cpu := chip8.CPU{MemorySize: memorySize, Strict: strictMemory, LoadAt: loadAddress, Hires: machine == "hires", Font: fontData, Quirks: quirks}
+	cpu.Init()
+	if err := cpu.LoadRomData(data); err != nil {
+		return nil, err
+	}
+	for i := 0; i < previewCycles; i++ {
+		if err := cpu.EmulateCycle(); err != nil {
+			break
+		}
+	}
+	frame := cpuFrame(&cpu)
+	return &frame, nil
+}
+
+// run sets up the window and plays ROMs until the user quits
 func run() int {
 	var window *sdl.Window
 	var renderer *sdl.Renderer
@@ -338,180 +907,1021 @@ func run() int {
 
 	// Setting up graphics and creating a window
 	if err = sdl.Init(sdl.INIT_EVERYTHING); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize SDL: %s\n", err)
-		return 2
+		showError(nil, "Failed to initialize SDL", err)
+		return runFailed
 	}
 	defer sdl.Quit()
 
-	if window, err = sdl.CreateWindow(winTitle, sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, winWidth, winHeight, sdl.WINDOW_SHOWN); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create window: %s\n", err)
-		return 3
+	// Quit on Ctrl+C or when told to terminate the same way as when the
+	// window is closed, saving the game and freeing everything
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for range signals {
+			slog.Info("Quitting on a signal")
+			requestQuit()
+		}
+	}()
+
+	// A -kiosk cabinet takes the whole display, which KMSDRM on a Raspberry
+	// Pi without a desktop needs anyway
+	flags := uint32(sdl.WINDOW_SHOWN | sdl.WINDOW_RESIZABLE)
+	if kiosk {
+		flags |= sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
+	if window, err = sdl.CreateWindow(winTitle, sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, winWidth, winHeight, flags); err != nil {
+		showError(nil, "Failed to create window", err)
+		return runFailed
 	}
 	defer window.Destroy()
 
+	// SDL keeps the screensaver away as long as it runs, the menu lets it in
+	// but on a -kiosk cabinet
+	if kiosk {
+		sdl.ShowCursor(sdl.DISABLE)
+	} else {
+		sdl.EnableScreenSaver()
+	}
+
+	if windowScale != 0 {
+		setScale(window, windowScale)
+	} else {
+		windowScale = int(winWidth / 64)
+	}
+
 	if renderer, err = sdl.CreateRenderer(window, -1, sdl.RENDERER_ACCELERATED); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create renderer: %s\n", err)
-		return 4
+		showError(window, "Failed to create renderer", err)
+		return runFailed
 	}
 	renderer.Clear()
 	defer renderer.Destroy()
 
+	// Play on without sound if there is no audio device
+	if beeper, err = openBeeper(); err != nil {
+		slog.Warn("Failed to open the audio device, no sound", "err", err)
+	}
+	defer beeper.Close()
+
 	if err = ttf.Init(); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize TTF: %s\n", err)
-		return 4
+		showError(window, "Failed to initialize TTF", err)
+		return runFailed
 	}
 	defer ttf.Quit()
 
-	fontData, err := contentfont.ReadFile("font.ttf")
+	ttfData, err := contentfont.ReadFile("font.ttf")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to read font file: %s\n", err)
-		return 5
+		showError(window, "Failed to read font file", err)
+		return runFailed
 	}
 
-	rwops, err := sdl.RWFromMem(fontData)
+	rwops, err := sdl.RWFromMem(ttfData)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed on rwops: %s\n", err)
-		return 5
+		showError(window, "Failed on rwops", err)
+		return runFailed
 	}
 
 	font, err := ttf.OpenFontRW(rwops, 1, fontSize)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to open font from RWops: %s\n", err)
-		return 5
+		showError(window, "Failed to open font from RWops", err)
+		return runFailed
 	}
 
 	defer font.Close()
 
-	romName := showMenu(renderer, font)
+	texts := NewTextCache(renderer, font)
+	defer texts.Destroy()
+
+	// Going back to the menu keeps the window, the renderer and the font.
+	// The ROM given with -rom is played first, the menu comes after it. A
+	// -kiosk cabinet starts it over instead, after a crash too. A -playlist
+	// plays its ROMs in turn.
+	rom := romPath
+	for {
+		if playlist != nil {
+			rom = playlist.advance()
+		}
+		if result := play(window, renderer, texts, rom); result != runRestart {
+			return result
+		}
+		if !kiosk {
+			rom = ""
+		} else if rom != "" {
+			// A ROM that fails right away isn't loaded again and again
+			sdl.Delay(1000)
+		}
+	}
+}
+
+// play runs a ROM, or the one picked in the menu if rom is "", until the
+// user quits or goes back to the menu
+func play(window *sdl.Window, renderer *sdl.Renderer, texts *TextCache, rom string) int {
+	romName := rom
 	if romName == "" {
-		return 0
+		romName = showMenu(window, renderer, texts)
+	}
+	if romName == "" {
+		return runQuit
+	}
+
+	// Initialize the Chip8 systems and load the games into memory. Side by
+	// side the second machine runs its own ROM, or the same one to race it.
+	romNames := []string{romName}
+	keyMaps := []func(sdl.Keycode) int{mapKey, mapKeyRight}
+	if splitScreen {
+		second := splitRom
+		if second == "" {
+			second = romName
+		}
+		romNames = append(romNames, second)
+	}
+	var instances []*Instance
+	defer func() {
+		for _, inst := range instances {
+			inst.Destroy()
+		}
+	}()
+	for i, name := range romNames {
+		inst, err := newInstance(renderer, name, keyMaps[i])
+		if err != nil {
+			showError(window, "Failed to load "+name, err)
+			return runRestart
+		}
+		instances = append(instances, inst)
 	}
+	player := instances[0]
 
-	// Initialize the Chip8 system and load the game into memory
-	chip8 := chip8.CPU{}
-	chip8.Init()
-	chip8.LoadRom("./roms/" + romName)
+	// Play against someone else over the network, the session starts from the
+	// power-on state on both sides
+	if netHost != "" || netJoin != "" {
+		host, addr := netHost != "", netHost+netJoin
+		conn, err := connectPeer(renderer, texts, host, addr)
+		if err == errCancelled {
+			return runRestart
+		}
+		if err != nil {
+			showError(window, "Failed to connect to the other player", err)
+			return runRestart
+		}
+		defer conn.Close()
+		if player.Net, err = startNetplay(conn, host, player); err != nil {
+			showError(window, "Failed to start netplay", err)
+			return runRestart
+		}
+	}
 
-	// Initialize the key states array
-	keyStates := &[16]bool{}
+	// Games played with few keys, or only watched, would let the display sleep
+	if keepAwake && !kiosk {
+		sdl.DisableScreenSaver()
+		defer sdl.EnableScreenSaver()
+	}
 
-	// Emulation loop
-	for {
+	// Save states only apply to a single local machine, a race or a network
+	// session always starts from scratch
+	single := len(instances) == 1 && player.Net == nil
+
+	// Offer to pick up where the ROM was last quit, a -kiosk cabinet and a
+	// -playlist always start over
+	if single && !kiosk && playlist == nil {
+		if autosave, ok := readAutosave(player.Hash); ok && askResume(renderer, texts, autosave) {
+			player.CPU.LoadState(autosave.State)
+		}
+	}
+
+	// Remember where the ROM was left when quitting mid-game
+	autosave := func() {
+		if !single {
+			return
+		}
+		if err := writeAutosave(player.Hash, player.CPU.SaveState()); err != nil {
+			slog.Error("Failed to autosave", "err", err)
+		}
+	}
+
+	// redraw makes every machine draw its screen on the next cycle
+	redraw := func() {
+		for _, inst := range instances {
+			inst.CPU.DrawFlag = true
+		}
+	}
+
+	// What the HTTP API controls, only the first machine
+	api := &apiSession{inst: player}
+
+	// Whether the player was paused for the window being minimized or losing the focus
+	autoPaused := false
+
+	// handleEvents handles the pending events, it returns false along with
+	// the outcome of run when the emulation is over
+	handleEvents := func() (int, bool) {
 		// Handle keyboard events
 		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			if player.debug.HandleEvent(event, player) {
+				redraw()
+				continue
+			}
+			pressed := false
+			for _, inst := range instances {
+				if inst.keypad.HandleEvent(event, inst, window) {
+					pressed = true
+					break
+				}
+			}
+			if pressed {
+				redraw()
+				continue
+			}
 			switch t := event.(type) {
 			case *sdl.KeyboardEvent:
 				// Handle key down event
 				if t.Type == sdl.KEYDOWN {
-					// Restart the game if the "ESC" key is pressed
-					if t.Keysym.Sym == sdl.K_BACKSPACE {
-						// restart the game
-						fmt.Println("Restarting")
-						return 1
+					// A -kiosk cabinet only quits with its own combination
+					if kiosk {
+						if keyKioskExit.Is(t.Keysym) {
+							slog.Info("Exiting")
+							return runQuit, false
+						}
+					} else {
+						// Go back to the menu if the restart key ("Backspace") is pressed
+						if keyRestart.Is(t.Keysym) {
+							slog.Info("Restarting")
+							return runRestart, false
+						}
+
+						// Exit the game if the quit key ("Escape") is pressed
+						if keyQuit.Is(t.Keysym) {
+							slog.Info("Exiting")
+							autosave()
+							return runQuit, false
+						}
+					}
+
+					if handleScaleKey(window, t) {
+						continue
+					}
+
+					// Changes to the machine would make a -deterministic run differ
+					if deterministic && (t.Keysym.Sym == keyFaster.Key || t.Keysym.Sym == keySlower.Key || keySpeed.Is(t.Keysym) ||
+						keyCheats.Is(t.Keysym) || keySearch.Is(t.Keysym) || keyLoad.Is(t.Keysym)) {
+						notify("Not in -deterministic mode")
+						continue
+					}
+					// Both sides of netplay run at the speed of the host
+					if player.Net != nil && (t.Keysym.Sym == keyFaster.Key || t.Keysym.Sym == keySlower.Key || keySpeed.Is(t.Keysym)) {
+						notify("Not during netplay")
+						continue
+					}
+
+					// Change the instructions per frame of the ROM if "PageUp" or "PageDown" is pressed
+					if t.Keysym.Sym == keyFaster.Key || t.Keysym.Sym == keySlower.Key {
+						delta := 1
+						if t.Keysym.Mod&sdl.KMOD_SHIFT != 0 {
+							delta = 10
+						}
+						if t.Keysym.Sym == keySlower.Key {
+							delta = -delta
+						}
+						player.changeSpeed(delta)
+						continue
+					}
+
+					// Pick a speed preset if "Shift+F11" is pressed
+					if keySpeed.Is(t.Keysym) {
+						showSpeedPresets(renderer, texts, player)
+						player.Keys = [16]bool{}
+						redraw()
+						continue
+					}
+
+					// Toggle frame blending if the "F4" key is pressed
+					if keyBlend.Is(t.Keysym) {
+						antiFlicker = !antiFlicker
+						notify(onOff("Frame blending", antiFlicker))
+						redraw()
+						continue
+					}
+
+					// Toggle the CRT effects if the "F3" key is pressed
+					if keyCRT.Is(t.Keysym) {
+						crtEffects = !crtEffects
+						notify(onOff("CRT effects", crtEffects))
+						redraw()
+						continue
+					}
+
+					// Toggle the on-screen keypad if the "F1" key is pressed
+					if keyKeypad.Is(t.Keysym) {
+						showKeypad = !showKeypad
+						redraw()
+						continue
+					}
+
+					// Toggle the input overlay if "Shift+F1" is pressed
+					if keyInput.Is(t.Keysym) {
+						showInput = !showInput
+						redraw()
+						continue
+					}
+
+					// Toggle the performance HUD if "Shift+F2" is pressed
+					if keyPerf.Is(t.Keysym) {
+						showPerf = !showPerf
+						redraw()
+						continue
+					}
+
+					// Export the settings of the game if "Ctrl+F5" is pressed
+					if keyExport.Is(t.Keysym) {
+						if path, err := player.exportPreset(); err != nil {
+							showError(window, "Failed to export the settings", err)
+						} else {
+							notify("Settings exported to %s", path)
+						}
+						continue
+					}
+
+					// Copy the screen as text art if "Shift+F3" is pressed
+					if keyCopyScreen.Is(t.Keysym) {
+						if err := sdl.SetClipboardText(frameText(cpuFrame(&player.CPU), true)); err != nil {
+							slog.Error("Failed to copy the screen", "err", err)
+							notify("Failed to copy the screen")
+						} else {
+							notify("Screen copied to the clipboard")
+						}
+						continue
+					}
+
+					// Mute with "M", turn the volume up and down with "+" and "-"
+					if keyMute.Is(t.Keysym) {
+						toggleMute()
+						continue
+					}
+					if t.Keysym.Sym == keyVolumeUp.Key || t.Keysym.Sym == keyVolumeDown.Key || t.Keysym.Sym == sdl.K_KP_PLUS || t.Keysym.Sym == sdl.K_KP_MINUS {
+						delta := volumeStep
+						if t.Keysym.Sym == keyVolumeDown.Key || t.Keysym.Sym == sdl.K_KP_MINUS {
+							delta = -delta
+						}
+						changeVolume(delta)
+						continue
 					}
 
-					// Exit the game if the "Backspace" key is pressed
-					if t.Keysym.Sym == sdl.K_ESCAPE {
-						// restart the game
-						fmt.Println("Exiting")
-						return 0
+					// Toggle the input latency HUD if "Ctrl+F2" is pressed
+					if keyLatency.Is(t.Keysym) {
+						showLatency = !showLatency
+						redraw()
+						continue
 					}
 
-					// Map the keyboard key to the corresponding Chip8 keypad key
-					chip8Key := mapKey(t.Keysym.Sym)
+					// Toggle the pixel grid if the "F2" key is pressed
+					if keyGrid.Is(t.Keysym) {
+						showGrid = !showGrid
+						redraw()
+						continue
+					}
 
-					// Set the corresponding key state in the keyStates array
-					if chip8Key != -1 {
-						(*keyStates)[chip8Key] = true
+					// Save the game to one of the slots if the "F5" key is pressed
+					if keySave.Is(t.Keysym) && single {
+						if slot := showSlotPicker(renderer, texts, tr("Save state"), readSlots(player.Hash)); slot != -1 {
+							if err := writeSlot(player.Hash, slot, player.CPU.SaveState()); err != nil {
+								slog.Error("Failed to save state", "err", err)
+								notify("Failed to save the state")
+							} else {
+								notify("State saved to slot %d", slot)
+							}
+						}
+						player.Keys = [16]bool{}
+						redraw()
+						continue
 					}
-				} else if t.Type == sdl.KEYUP {
-					// Map the keyboard key to the corresponding Chip8 keypad key
-					chip8Key := mapKey(t.Keysym.Sym)
 
-					// Clear the corresponding key state in the keyStates array
-					if chip8Key != -1 {
-						(*keyStates)[chip8Key] = false
+					// Toggle cheats if the "F6" key is pressed, they would desync netplay
+					if keyCheats.Is(t.Keysym) && player.Net == nil {
+						showCheatMenu(renderer, texts, player)
+						player.Keys = [16]bool{}
+						redraw()
+						continue
+					}
+
+					// Browse the sprites in memory if "Shift+F7" is pressed
+					if keySprites.Is(t.Keysym) && player.Net == nil {
+						showSprites(renderer, texts, player)
+						player.Keys = [16]bool{}
+						redraw()
+						continue
+					}
+
+					// Search the memory for the score or the lives if the "F7" key is pressed
+					if keySearch.Is(t.Keysym) && player.Net == nil {
+						showMemorySearch(renderer, texts, player)
+						player.Keys = [16]bool{}
+						redraw()
+						continue
+					}
+
+					// Load the game from one of the slots if the "F9" key is pressed
+					if keyLoad.Is(t.Keysym) && single {
+						slots := readSlots(player.Hash)
+						if slot := showSlotPicker(renderer, texts, tr("Load state"), slots); slot != -1 && slots[slot].Used {
+							player.CPU.LoadState(slots[slot].State)
+							notify("State loaded from slot %d", slot)
+						}
+						player.Keys = [16]bool{}
+						redraw()
+						continue
 					}
 				}
+
+				// Route the key to the machine it is mapped to
+				for _, inst := range instances {
+					if inst.HandleKey(t.Keysym, t.Type == sdl.KEYDOWN, t.Timestamp) {
+						break
+					}
+				}
+			case *sdl.TouchFingerEvent:
+				// Three fingers on the screen go back to the menu, like <Backspace>
+				if t.Type == sdl.FINGERDOWN && sdl.GetNumTouchFingers(t.TouchID) >= 3 && !kiosk {
+					slog.Info("Restarting")
+					return runRestart, false
+				}
+			case *sdl.WindowEvent:
+				// Pause while the window is minimized or out of focus, unless
+				// the player paused already
+				away := (t.Event == sdl.WINDOWEVENT_MINIMIZED && pauseMinimized) || (t.Event == sdl.WINDOWEVENT_FOCUS_LOST && pauseUnfocused)
+				back := t.Event == sdl.WINDOWEVENT_RESTORED || t.Event == sdl.WINDOWEVENT_FOCUS_GAINED
+				switch {
+				case away && !player.Paused && player.Net == nil:
+					player.Paused, autoPaused = true, true
+				case back && autoPaused && !(pauseMinimized && window.GetFlags()&sdl.WINDOW_MINIMIZED != 0):
+					player.Paused, autoPaused = false, false
+					notify("Resumed")
+				}
+				// Redraw after the window was resized or uncovered
+				redraw()
 			case *sdl.QuitEvent:
-				return 0
+				autosave()
+				return runQuit, false
 			}
 		}
+		return 0, true
+	}
 
-		// Emulate one cycle
-		chip8.EmulateCycle()
+	var stats loopStats
 
-		// If the draw flag is set, update the screen
-		if chip8.DrawFlag {
-			// Draw graphics
-			renderer.SetDrawColor(0, 0, 0, 255)
-			renderer.Clear()
+	// The ROM of -watch starts over whenever it changes
+	var watch *fileWatch
+	if watchPath != "" && romName == romPath {
+		watch = newFileWatch(romName)
+	}
 
-			windowWidth, windowHeight := window.GetSize()
-			pixelWidth := windowWidth / 64
-			pixelHeight := windowHeight / 32
+	// When the screens were last drawn, and whether toasts were drawn over them
+	var drawTicks uint32
+	toastsShown := false
 
-			for i := 0; i < 32; i++ {
-				for j := 0; j < 64; j++ {
-					if chip8.Display[i][j] == 1 {
-						renderer.SetDrawColor(255, 255, 255, 255)
-					} else {
-						renderer.SetDrawColor(0, 0, 0, 255)
-					}
-					renderer.FillRect(&sdl.Rect{
-						X: int32(j) * pixelWidth,
-						Y: int32(i) * pixelHeight,
-						W: pixelWidth,
-						H: pixelHeight,
-					})
+	// The screen changes -frame-skip left undrawn since the last draw
+	skipped := 0
+
+	// The performance HUD of -perf-hud
+	var perf PerfHUD
+
+	// turn handles the events and draws the screens, with the emulation
+	// locked. It returns false along with the outcome of run when the
+	// emulation is over.
+	turn := func(emulation *Emulation) (int, bool) {
+		if result, ok := handleEvents(); !ok {
+			return result, false
+		}
+
+		// Run what the HTTP API asked for
+		if apiAddr != "" {
+			api.serve()
+			stats.update()
+		}
+
+		if watch != nil && watch.changed() {
+			watch.reload(player)
+		}
+
+		// Go back to the menu if a program misbehaved
+		if emulation.Err != nil {
+			showError(window, "Emulation of "+emulation.Failed.Name+" stopped", emulation.Err)
+			return runRestart, false
+		}
+
+		// Sound the buzzer while the sound timer of a running machine does
+		sound := false
+		for _, inst := range instances {
+			sound = sound || (!inst.Paused && inst.CPU.SoundTimer() > 0)
+		}
+		beeper.Update(sound)
+
+		// Go on to the next ROM of the playlist once this one is over
+		if playlist != nil && playlist.over(&player.CPU) {
+			return runRestart, false
+		}
+
+		// Draw at most once a frame, whatever the speed of the machines
+		if sdl.GetTicks()-drawTicks < 16 {
+			return 0, true
+		}
+		draw := false
+		for _, inst := range instances {
+			draw = draw || inst.CPU.DrawFlag
+		}
+
+		// Skip frames for -frame-skip while the program keeps drawing, the
+		// last change is drawn as soon as a frame goes by without one
+		if draw && skipped < frameSkip-1 {
+			skipped++
+			draw = false
+			for _, inst := range instances {
+				if inst.CPU.DrawFlag {
+					statDraws.Add(1)
+					inst.CPU.DrawFlag = false
 				}
 			}
-			footerSurface, err := font.RenderUTF8Solid("<Escape> to exit, <Backspace> to restart", sdl.Color{R: 255, G: 255, B: 255, A: 255})
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to render text: %s\n", err)
-			}
-			defer footerSurface.Free()
+			drawTicks = sdl.GetTicks()
+		} else if draw || skipped > 0 {
+			draw = true
+			skipped = 0
+		}
 
-			footerTexture, err := renderer.CreateTextureFromSurface(footerSurface)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to create texture: %s\n", err)
+		// Keep the debugger panel, the overlays and the toasts live even if the screen doesn't change
+		if player.debug.Visible || showKeypad || showInput || showPerf || showLatency || toastsShown {
+			draw = true
+		}
+
+		// If a draw flag is set, update the screen
+		if draw {
+			// Draw graphics, in window pixels. What the screens don't cover is the border
+			renderer.SetLogicalSize(0, 0)
+			renderer.SetDrawColor(borderColor.R, borderColor.G, borderColor.B, 255)
+			renderer.Clear()
+
+			// Every machine gets an equal column of the window, beside the debugger
+			windowWidth, windowHeight := window.GetSize()
+			gameWidth := windowWidth
+			if player.debug.Visible && windowWidth > debugPanelWidth {
+				gameWidth -= debugPanelWidth
+				player.debug.UpdateWatches(&player.CPU)
+				player.debug.Draw(renderer, texts, player, sdl.Rect{X: gameWidth, Y: 0, W: debugPanelWidth, H: windowHeight})
 			}
-			defer footerTexture.Destroy()
+			columnWidth := gameWidth / int32(len(instances))
+			for i, inst := range instances {
+				inst.runFrameScripts()
+				frame := cpuFrame(&inst.CPU)
+				inst.Screen.ShowChanges = showChanges && inst == player && player.debug.Visible
+				screenRect := displayRect(columnWidth, windowHeight, frame.Width, frame.Height)
+				screenRect.X += int32(i) * columnWidth
+				if err := inst.Screen.Draw(frame, screenRect); err != nil {
+					showError(window, "Failed to draw the screen", err)
+					return runRestart, false
+				}
+				if showGrid {
+					drawGrid(renderer, screenRect, frame.Width, frame.Height)
+				}
+				inst.drawHUD(texts, screenRect)
+				if showKeypad {
+					inst.keypad.Draw(renderer, texts, inst, screenRect)
+				}
+				if showInput {
+					inst.keypad.DrawInput(renderer, texts, inst, screenRect)
+				}
+				if showPerf && inst == player {
+					perf.sample()
+					perf.Draw(renderer, texts, screenRect)
+				}
+				if showLatency {
+					inst.latency.Draw(renderer, texts, screenRect)
+				}
 
-			// Get the dimensions of the text texture
-			_, _, footerWidth, footerHeight, err := footerTexture.Query()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to query texture: %s\n", err)
+				// Reset the draw flag
+				if inst.CPU.DrawFlag {
+					statDraws.Add(1)
+					inst.CPU.DrawFlag = false
+				}
 			}
+			// A -kiosk cabinet doesn't tell how to leave
+			if !kiosk {
+				footerText := tr("<%s> to exit, <%s> to restart", keyQuit, keyRestart)
+
+				// Get the dimensions of the text texture
+				footerWidth, footerHeight, err := texts.Size(footerText)
+				if err != nil {
+					showError(window, "Failed to render text", err)
+					return runRestart, false
+				}
 
-			// Position the text at the center of the window
-			footerX := (winWidth - footerWidth) / 2
-			footerY := int32(winHeight - footerHeight - 4)
+				// Position the text at the center of the screens
+				footerX := (gameWidth - footerWidth) / 2
+				footerY := int32(windowHeight - footerHeight - 4)
 
-			// Render the text
-			renderer.Copy(footerTexture, nil, &sdl.Rect{X: footerX, Y: footerY, W: footerWidth, H: footerHeight})
+				// Render the text
+				texts.Draw(footerText, white, footerX, footerY)
+			}
+			toastsShown = drawToasts(renderer, texts, sdl.Rect{X: 0, Y: 0, W: gameWidth, H: windowHeight})
 
 			renderer.Present()
+			texts.Sweep()
+			statFrames.Add(1)
+			drawTicks = sdl.GetTicks()
+		}
+		return 0, true
+	}
 
-			// Reset the draw flag
-			chip8.DrawFlag = false
+	// Emulation loop, the machines run on their own while the UI looks at
+	// them every fraction of a frame
+	emulation := startEmulation(instances)
+	defer emulation.Stop()
+	defer beeper.Update(false)
+	for {
+		emulation.Lock()
+		result, ok := turn(emulation)
+		emulation.Unlock()
+		if !ok {
+			return result
 		}
+		sdl.Delay(1000 / 60 / inputBursts)
+	}
+}
 
-		// Store key press state (Press and Release)
-		chip8.SetKeys(*keyStates)
+// setupLogging installs the default logger as configured on the command
+// line and returns a function closing the log file, if any.
+func setupLogging() (func(), error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return nil, err
+	}
+	if verbose {
+		level = slog.LevelDebug
+	}
 
-		// Delay to control the emulation speed
-		sdl.Delay(uint32(delay / target_fps))
+	var w io.Writer = os.Stderr
+	closeLog := func() {}
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+		closeLog = func() { f.Close() }
 	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})))
+	return closeLog, nil
+}
+
+// SDL wants its window and events handled on the main thread, and the
+// machines run on a goroutine of their own, so main stays on it
+func init() {
+	runtime.LockOSThread()
 }
 
 func main() {
-	os.Stdout = nil
-	for {
-		returnValue := run()
+	flag.StringVar(&romPath, "rom", "", "play this ROM file instead of picking one in the menu, - to read it from stdin, archive.zip plays the first .ch8 of an archive and archive.zip/name.ch8 the one named")
+	flag.StringVar(&watchPath, "watch", "", "play this ROM file and reload it whenever it changes")
+	flag.BoolVar(&keepAwake, "keep-awake", true, "keep the screensaver and display sleep away while a ROM runs")
+	flag.IntVar(&attractDelay, "attract", 60, "seconds the menu is left alone before a random ROM plays behind it, 0 never")
+	flag.BoolVar(&pauseMinimized, "pause-minimized", true, "pause while the window is minimized")
+	flag.BoolVar(&pauseUnfocused, "pause-unfocused", false, "pause while another window has the focus")
+	flag.StringVar(&opcodeStatsTo, "opcode-stats", "", "count the instructions run by opcode and print a histogram at exit, - for standard output or a .json file")
+	flag.BoolVar(&deterministic, "deterministic", false, "reproducible runs: a fixed random seed, timers counted in frames and no speed, cheat, search or state changes while a ROM runs")
+	flag.BoolVar(&watchKeep, "watch-keep", false, "patch the changes of a -watch ROM into memory instead of starting over")
+	flag.IntVar(&memorySize, "memory", chip8.DefaultMemorySize, "memory size in bytes (4096 up to 65536 for XO-CHIP)")
+	flag.BoolVar(&strictMemory, "strict", false, "stop on writes below the load address or accesses past the end of memory instead of wrapping")
+	flag.StringVar(&machine, "machine", "chip8", "machine to emulate: chip8 or hires (two-page 64x64 CHIP-8)")
+	flag.StringVar(&quirksName, "quirks", "chip8", "quirks profile: chip8, vip, schip or one saved from the quirks screen of the menu")
+	font := flag.String("font", "chip8", "font set: chip8, vip, dream6800, eti660, schip or a file holding one")
+	load := flag.String("load-address", "200", "hex address programs are loaded and start at, 600 for ETI-660 programs")
+	console := flag.String("console", "", "hex address the bytes a ROM writes to are logged from, a line at a time, for debugging homebrew")
+	flag.IntVar(&windowScale, "scale", 0, "window size as a multiple of the 64x32 screen, 1 to 16 (default 800x600)")
+	flag.IntVar(&frameIPF, "ipf", 0, "instructions per frame, run in bursts with the keyboard read in between (default one instruction at a time, paced by the delay of the menu)")
+	flag.StringVar(&language, "lang", localeLanguage(), "language of the interface, en or es, taken from the locale by default")
+	flag.StringVar(&onInvalid, "on-invalid", "ignore", "what unknown opcodes do: ignore (skip them), pause (into the debugger) or stop")
+	flag.BoolVar(&integerScaling, "integer-scale", false, "only scale the screen by whole numbers, keeping pixels square")
+	flag.BoolVar(&showGrid, "grid", false, "draw grid lines between the pixels")
+	flag.BoolVar(&showKeypad, "keypad", false, "show a keypad on the screen to press with the mouse or by touch")
+	flag.BoolVar(&showInput, "show-input", false, "show the keys the machine sees held and its last wait for a key, toggled with <Shift>+<F1>")
+	flag.BoolVar(&showPerf, "perf-hud", false, "graph the frame time, the instructions per frame and the draws of the last seconds, toggled with <Shift>+<F2>")
+	flag.BoolVar(&showLatency, "latency-hud", false, "show how long key presses take to reach the program, from the key event to the EX9E, EXA1 or FX0A that sees the key, toggled with <Ctrl>+<F2>")
+	flag.BoolVar(&crtEffects, "crt", false, "CRT effects: scanlines, curvature and vignette")
+	flag.BoolVar(&antiFlicker, "anti-flicker", false, "blend every frame with the previous one to reduce sprite flicker")
+	flag.BoolVar(&showChanges, "show-changes", false, "while the debugger is open, color the pixels the last draw set red and those it cleared blue")
+	flag.Float64Var(&frameBlend, "blend", 0.5, "weight of the previous frame when blending, 0 to 1")
+	flag.IntVar(&audioRate, "audio-rate", defaultAudioRate, "sample rate of the sound in Hz, the audio device may pick another")
+	flag.IntVar(&audioBuffer, "audio-buffer", defaultAudioBuffer, "audio buffer in samples, a power of two from 64 to 8192; smaller ones make the beep lag less behind the sound timer but can stutter")
+	flag.IntVar(&volume, "volume", 50, "volume of the sound in percent, changed with + and - while playing")
+	flag.BoolVar(&muted, "mute", false, "start with the sound muted, toggled with M while playing")
+	flag.Float64Var(&beepRamp, "beep-ramp", defaultBeepRamp, "milliseconds the beep takes to rise and fall, so the speaker doesn't pop, 0 to 50")
+	flag.IntVar(&frameSkip, "frame-skip", 1, "only draw every Nth frame the program changed the screen in, for hosts too slow to draw them all; the emulation keeps its speed")
+	paletteName := flag.String("palette", "default", "colors of the screen: default, high-contrast, inverse or colorblind")
+	flag.BoolVar(&reduceFlashes, "reduce-flashes", false, "show at most three flashes of the whole screen a second")
+	flag.Float64Var(&textScale, "text-scale", 1, "size of the menu text, 1 to 1.25")
+	border := flag.String("border-color", "000000", "color (RRGGBB) of the window around the screen")
+	flag.BoolVar(&keycodeMapping, "keycodes", false, "map the keypad by the letters on the keys instead of where they are, as on a QWERTY keyboard")
+	flag.BoolVar(&verbose, "v", false, "verbose output, same as -log-level debug")
+	flag.StringVar(&logLevel, "log-level", "error", "minimum level of logged messages: debug, info, warn or error")
+	flag.StringVar(&logFile, "log-file", "", "write the log to this file instead of stderr")
+	flag.BoolVar(&splitScreen, "split", false, "run two machines side by side, the second one played with the right hand side of the keyboard")
+	flag.StringVar(&splitRom, "split-rom", "", "ROM of the second machine, implies -split (default the one picked in the menu)")
+	flag.StringVar(&netHost, "host", "", "host a netplay session on this address, like :7000")
+	flag.StringVar(&netJoin, "join", "", "join the netplay session at this address, like example.com:7000")
+	flag.StringVar(&apiAddr, "api", "", "serve the HTTP control API on this address, like localhost:8080")
+	presetPath := flag.String("preset", "", "settings exported with <Ctrl>+<F5> to play with: the quirks and speed for the ROM they were exported from, the palette and keys for every ROM")
+	playlistPath := flag.String("playlist", "", "play the ROMs of this file in turn, each for its minutes or until its game over condition, over and over")
+	flag.BoolVar(&kiosk, "kiosk", false, "for cabinets: fullscreen without a cursor, the quit and restart keys off but for -key-kiosk-exit, -rom played again whenever it stops")
+	showVersion := flag.Bool("version", false, "print the version of the emulator, then exit")
+	for _, h := range hotkeys {
+		flag.Var(h.key, "key-"+h.name, "hotkey to "+h.usage)
+	}
+	if err := resolveOptions(flag.CommandLine, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid options: %s\n", err)
+		os.Exit(2)
+	}
+	if *showVersion {
+		fmt.Println("chip8", buildVersion())
+		return
+	}
 
-		if returnValue == 0 {
-			break
+	closeLog, err := setupLogging()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %s\n", err)
+		os.Exit(2)
+	}
+	defer closeLog()
+	slog.Info("Starting", "version", buildVersion())
+
+	if *presetPath != "" {
+		if preset, err = readPreset(*presetPath); err == nil {
+			err = preset.applyFlags(flag.CommandLine)
+		}
+		if err != nil {
+			slog.Error("Invalid preset", "err", err)
+			closeLog()
+			os.Exit(2)
+		}
+	}
+
+	if memorySize < chip8.DefaultMemorySize || memorySize > chip8.MaxMemorySize {
+		slog.Error("Invalid memory size", "memory", memorySize, "min", chip8.DefaultMemorySize, "max", chip8.MaxMemorySize)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(*load), "0x"), 16, 16); err != nil || addr < chip8.LoadAddress || int(addr) >= memorySize {
+		slog.Error("Invalid load address, want hex between 200 and the end of memory", "load-address", *load)
+		closeLog()
+		os.Exit(2)
+	} else {
+		loadAddress = int(addr)
+	}
+
+	if *console != "" {
+		if addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(*console), "0x"), 16, 16); err != nil || int(addr) < loadAddress || int(addr) >= memorySize {
+			slog.Error("Invalid console address, want hex between the load address and the end of memory", "console", *console)
+			closeLog()
+			os.Exit(2)
+		} else {
+			consoleAddress = int(addr)
+		}
+	}
+
+	if quirks, err = findQuirks(quirksName); err != nil {
+		slog.Error("Invalid -quirks", "quirks", quirksName, "err", err)
+		closeLog()
+		os.Exit(2)
+	}
+
+	switch machine {
+	case "chip8", "hires":
+	default:
+		slog.Error("Invalid -machine, want chip8 or hires", "machine", machine)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if fontData, err = readFont(*font); err != nil {
+		slog.Error("Invalid font set", "font", *font, "err", err)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if borderColor, err = parseColor(*border); err != nil {
+		slog.Error("Invalid border color", "err", err)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if palette, err = parsePalette(*paletteName); err != nil {
+		slog.Error("Invalid palette", "err", err)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if textScale < minTextScale || textScale > maxTextScale {
+		slog.Error("Invalid text scale", "text-scale", textScale, "min", minTextScale, "max", maxTextScale)
+		closeLog()
+		os.Exit(2)
+	}
+	fontSize = int(math.Round(float64(fontSize) * textScale))
+
+	if frameIPF < 0 || frameIPF > maxIPF {
+		slog.Error("Invalid instructions per frame", "ipf", frameIPF, "max", maxIPF)
+		closeLog()
+		os.Exit(2)
+	}
+
+	switch onInvalid {
+	case "ignore", "pause", "stop":
+	default:
+		slog.Error("Invalid -on-invalid policy, want ignore, pause or stop", "on-invalid", onInvalid)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if frameBlend < 0 || frameBlend > 1 {
+		slog.Error("Invalid frame blend weight", "blend", frameBlend)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if audioRate < 8000 || audioRate > 192000 {
+		slog.Error("Invalid audio sample rate, want 8000 to 192000", "audio-rate", audioRate)
+		closeLog()
+		os.Exit(2)
+	}
+	if audioBuffer < minAudioBuffer || audioBuffer > maxAudioBuffer || audioBuffer&(audioBuffer-1) != 0 {
+		slog.Error("Invalid audio buffer, want a power of two", "audio-buffer", audioBuffer, "min", minAudioBuffer, "max", maxAudioBuffer)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if volume < 0 || volume > 100 {
+		slog.Error("Invalid volume, want 0 to 100", "volume", volume)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if beepRamp < 0 || beepRamp > maxBeepRamp {
+		slog.Error("Invalid beep ramp", "beep-ramp", beepRamp, "max", maxBeepRamp)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if frameSkip < 1 {
+		slog.Error("Invalid frame skip, want 1 or more", "frame-skip", frameSkip)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if windowScale != 0 && (windowScale < minScale || windowScale > maxScale) {
+		slog.Error("Invalid window scale", "scale", windowScale, "min", minScale, "max", maxScale)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if splitRom != "" {
+		splitScreen = true
+	}
+	// M is a key of the keypad of the right hand machine side by side, mute
+	// takes Ctrl+M there unless set otherwise
+	if splitScreen && optionOrigins["key-mute"] == fromDefault {
+		keyMute.Mod = sdl.KMOD_CTRL
+	}
+	if err := checkHotkeys(splitScreen); err != nil {
+		slog.Error("Invalid hotkeys", "err", err)
+		closeLog()
+		os.Exit(2)
+	}
+
+	if watchPath != "" {
+		if romPath != "" {
+			slog.Error("Only one of -rom and -watch can be given")
+			closeLog()
+			os.Exit(2)
 		}
+		if netHost != "" || netJoin != "" {
+			slog.Error("-watch can't be combined with netplay")
+			closeLog()
+			os.Exit(2)
+		}
+		if deterministic {
+			slog.Error("-watch can't be combined with -deterministic")
+			closeLog()
+			os.Exit(2)
+		}
+		romPath = watchPath
+	}
+
+	if *playlistPath != "" {
+		if romPath != "" {
+			slog.Error("-playlist can't be combined with -rom or -watch")
+			closeLog()
+			os.Exit(2)
+		}
+		entries, err := readPlaylist(*playlistPath)
+		if err != nil {
+			slog.Error("Failed to read the playlist", "err", err)
+			closeLog()
+			os.Exit(2)
+		}
+		playlist = &Playlist{entries: entries}
+	}
+
+	// ROMs given by path are told from the bundled ones by being absolute,
+	// "-" reads the ROM from a pipe
+	if romPath == stdinRom {
+		if stdinData, err = io.ReadAll(io.LimitReader(os.Stdin, chip8.MaxMemorySize)); err != nil || len(stdinData) == 0 {
+			slog.Error("Failed to read the ROM from stdin", "err", err, "size", len(stdinData))
+			closeLog()
+			os.Exit(2)
+		}
+	} else if romPath != "" {
+		if romPath, err = filepath.Abs(romPath); err != nil {
+			slog.Error("Invalid ROM path", "rom", romPath, "err", err)
+			closeLog()
+			os.Exit(2)
+		}
+	}
+
+	// Phones and tablets have no keyboard to play with
+	if runtime.GOOS == "android" && optionOrigins["keypad"] == fromDefault {
+		showKeypad = true
+	}
+
+	if netHost != "" && netJoin != "" {
+		slog.Error("Only one of -host and -join can be given")
+		closeLog()
+		os.Exit(2)
+	}
+	if splitScreen && (netHost != "" || netJoin != "") {
+		slog.Error("Netplay can't be combined with -split")
+		closeLog()
+		os.Exit(2)
+	}
+
+	// Commands that don't open a window
+	switch flag.Arg(0) {
+	case "":
+	case "info":
+		if err := runInfo(flag.Args()[1:]); err != nil {
+			slog.Error("Info failed", "err", err)
+			closeLog()
+			os.Exit(1)
+		}
+		return
+	case "test-suite":
+		if err := runTestSuite(flag.Args()[1:]); err != nil {
+			slog.Error("Test suite failed", "err", err)
+			closeLog()
+			os.Exit(1)
+		}
+		return
+	case "golden":
+		if err := runGolden(flag.Args()[1:]); err != nil {
+			slog.Error("Golden frames check failed", "err", err)
+			closeLog()
+			os.Exit(1)
+		}
+		return
+	case "compare":
+		if err := runCompare(flag.Args()[1:]); err != nil {
+			slog.Error("Screen comparison failed", "err", err)
+			closeLog()
+			os.Exit(1)
+		}
+		return
+	case "config":
+		if err := runConfig(flag.Args()[1:]); err != nil {
+			slog.Error("Config failed", "err", err)
+			closeLog()
+			os.Exit(1)
+		}
+		return
+	default:
+		slog.Error("Unknown command, want info, test-suite, golden, compare or config", "command", flag.Arg(0))
+		closeLog()
+		os.Exit(2)
+	}
+
+	if apiAddr != "" {
+		if err := startAPI(apiAddr); err != nil {
+			slog.Error("Failed to start the control API", "err", err)
+			closeLog()
+			os.Exit(1)
+		}
+	}
+
+	if opcodeStatsTo != "" {
+		opcodeCounts = make([]uint64, 0x10000)
+	}
+	status := run()
+	if opcodeStatsTo != "" {
+		if err := writeOpcodeStats(opcodeStatsTo); err != nil {
+			slog.Error("Failed to write the opcode statistics", "err", err)
+		}
+	}
+	if status == runFailed {
+		closeLog()
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Translations of the text shown in the window, by language and then by the
+// English text. Text missing from a catalog is shown in English. The font
+// only has Latin-1 glyphs, so are the translations.
+var catalogs = map[string]map[string]string{
+	"es": {
+		// Menu
+		"Click on a ROM to play":                     "Elige una ROM para jugar",
+		"delay: %d (j: -100, l: +100)":               "retardo: %d (j: -100, l: +100)",
+		"target_fps: %d (i: -5, p: +5)":              "fps objetivo: %d (i: -5, p: +5)",
+		"scale: %dx ([: -1, ]: +1), integer: %s (u)": "escala: %dx ([: -1, ]: +1), entera: %s (u)",
+		"on":  "sí",
+		"off": "no",
+		"<D> more ROMs, <T> self test, <Escape> to exit": "<D> más ROMs, <T> autoprueba, <Escape> para salir",
+		"Self test with the %s quirks: %d of %d passed":  "Autoprueba con las rarezas %s: %d de %d bien",
+		"ok": "bien",
+		"Input latency: press a key the game reads":        "Latencia de entrada: pulsa una tecla que lea el juego",
+		"Sound: %s, %.0f ms behind the sound timer":        "Sonido: %s, %.0f ms de retraso sobre el temporizador",
+		"Machine state dumped to %s":                       "Estado de la máquina volcado en %s",
+		"Screen copied to the clipboard":                   "Pantalla copiada al portapapeles",
+		"Failed to copy the screen":                        "No se pudo copiar la pantalla",
+		"Settings exported to %s":                          "Ajustes exportados a %s",
+		"Sound muted":                                      "Sonido silenciado",
+		"Sound on, volume %d%%":                            "Sonido activado, volumen %d%%",
+		"Volume: %d%%":                                     "Volumen: %d%%",
+		"Input latency: %d ms, %d frames":                  "Latencia de entrada: %d ms, %d fotogramas",
+		"Last %d keys: %.1f ms on average, %d ms at worst": "Últimas %d teclas: %.1f ms de media, %d ms como mucho",
+		"FAIL":                           "FALLO",
+		"<Enter> or <Escape> to go back": "<Enter> o <Escape> para volver",
+		"</> search, <O> open a file, <Enter> play": "</> buscar, <O> abrir, <Enter> jugar",
+		"Open ROM":     "Abrir ROM",
+		"Search: %s_":  "Buscar: %s_",
+		"by %s":        "de %s",
+		"Controls: %s": "Controles: %s",
+
+		// Game
+		"<%s> to exit, <%s> to restart": "<%s> para salir, <%s> para reiniciar",
+
+		// Save states
+		"Save state": "Guardar partida",
+		"Load state": "Cargar partida",
+		"Arrows/0-9 to choose, <Enter> to confirm, <Escape> to cancel": "Flechas/0-9 para elegir, <Enter> para confirmar, <Escape> para cancelar",
+		"Empty":                      "Vacía",
+		"Slot %d":                    "Ranura %d",
+		"Resume where you left off?": "¿Seguir donde lo dejaste?",
+		"Saved %s":                   "Guardada el %s",
+		"<Y>/<Enter> to resume, <N>/<Escape> to start over": "<Y>/<Enter> para seguir, <N>/<Escape> para empezar de nuevo",
+
+		// Cheats
+		"Cheats":                              "Trucos",
+		"No cheats for this ROM, add them to": "Esta ROM no tiene trucos, añádelos en",
+		"<Up>/<Down> to choose, <Enter> to toggle, <Escape> to close": "<Arriba>/<Abajo> para elegir, <Enter> para activar, <Escape> para cerrar",
+
+		// Memory search
+		"Memory search: %d addresses": "Búsqueda en memoria: %d direcciones",
+		"%s: %d addresses left":       "%s: quedan %d direcciones",
+		"%s is not a byte":            "%s no es un byte",
+		"Equal to %d":                 "Igual a %d",
+		"Equal to: %s":                "Igual a: %s",
+		"Increased":                   "Aumentaron",
+		"Decreased":                   "Disminuyeron",
+		"Unchanged":                   "Sin cambios",
+		"New search":                  "Nueva búsqueda",
+		"Added cheat %s":              "Truco añadido: %s",
+		"%03X: %3d (last search %3d)": "%03X: %3d (búsqueda anterior %3d)",
+		"0-9 <Enter> equal to, + increased, - decreased, = unchanged":    "0-9 <Enter> igual a, + aumentaron, - disminuyeron, = sin cambios",
+		"<N> new search, <F> freeze as cheat, <Escape> back to the game": "<N> nueva búsqueda, <F> congelar como truco, <Escape> volver al juego",
+
+		// Sprites
+		"Sprites: %d found": "Sprites: %d encontrados",
+		"Added watch %s":    "Vigilando %s",
+		"Arrows choose, <Enter> or a click adds a watch, <Escape> back": "Flechas, <Enter> o clic para vigilar, <Escape> vuelve",
+
+		// Toasts
+		"Failed to save the state":         "No se pudo guardar el estado",
+		"State saved to slot %d":           "Estado guardado en la ranura %d",
+		"State loaded from slot %d":        "Estado cargado de la ranura %d",
+		"Speed: %d instructions per frame": "Velocidad: %d instrucciones por fotograma",
+		"Frame blending":                   "Mezcla de fotogramas",
+		"Not in -deterministic mode":       "No en el modo -deterministic",
+		"Not during netplay":               "No durante el juego en red",
+		"CRT effects":                      "Efectos CRT",
+		"Changed pixels":                   "Píxeles cambiados",
+		"%s on":                            "%s: sí",
+		"%s off":                           "%s: no",
+		"Resumed":                          "Reanudado",
+		"Patched %s":                       "%s parcheada",
+		"Reloaded %s":                      "%s recargada",
+		"The code moved, starting over":    "El código cambió de sitio, empezando de nuevo",
+
+		// Downloads
+		"Download ROMs from the CHIP-8 Archive": "Descargar ROMs del CHIP-8 Archive",
+		"downloaded":                            "descargada",
+		"Downloaded %s":                         "%s descargada",
+		"<Up>/<Down> to choose, <Enter> to download, <Escape> to go back": "Flechas para elegir, <Enter> descarga, <Escape> vuelve",
+
+		// ZIP archives
+		"<Up>/<Down> to choose, <Enter> to play, <Escape> to go back": "Flechas para elegir, <Enter> para jugar, <Escape> vuelve",
+
+		// Speed presets
+		"Speed":            "Velocidad",
+		"Speed: %s":        "Velocidad: %s",
+		"COSMAC VIP":       "COSMAC VIP",
+		"HP-48 SCHIP":      "HP-48 SCHIP",
+		"Modern, uncapped": "Moderna, sin límite",
+		"%d a second":      "%d por segundo",
+		"Now %d instructions per frame, %d a second": "Ahora %d instrucciones por fotograma, %d por segundo",
+
+		// Quirks
+		"<Q> quirks: %s":   "<Q> rarezas: %s",
+		"custom":           "a medida",
+		"Quirks":           "Rarezas",
+		"Profile: < %s >":  "Perfil: < %s >",
+		"Shift VY":         "Desplazar VY",
+		"Increment I":      "Incrementar I",
+		"Jump to XNN + VX": "Saltar a XNN + VX",
+		"Reset VF":         "Borrar VF",
+		"Wrap X":           "Envolver en X",
+		"Wrap Y":           "Envolver en Y",
+		"8XY6 and 8XYE shift VY into VX, as on the COSMAC VIP":   "8XY6 y 8XYE desplazan VY a VX, como el COSMAC VIP",
+		"FX55 and FX65 move I past the registers, as on the VIP": "FX55 y FX65 dejan I tras los registros, como el VIP",
+		"BXNN jumps to XNN plus VX as on SCHIP, not to NNN + V0": "BXNN salta a XNN más VX como SCHIP, no a NNN + V0",
+		"8XY1, 8XY2 and 8XY3 clear VF, as on the COSMAC VIP":     "8XY1, 8XY2 y 8XY3 borran VF, como el COSMAC VIP",
+		"Sprites past the right edge come back on the left":      "Los sprites que salen por la derecha vuelven por la izquierda",
+		"Sprites past the bottom edge come back at the top":      "Los sprites que salen por abajo vuelven por arriba",
+		"Save as: %s_": "Guardar como: %s_",
+		"Saved as %s":  "Guardado como %s",
+		"<Left>/<Right> profile, <Space> toggle, <S> save, <Esc> back": "Flechas: perfil, <Espacio> cambia, <S> guarda, <Esc> vuelve",
+
+		// Netplay
+		"Connecting to %s":                   "Conectando con %s",
+		"Waiting for the other player on %s": "Esperando al otro jugador en %s",
+		"<Escape> to cancel":                 "<Escape> para cancelar",
+	},
+}
+
+// Language of the interface, from -lang or else the locale
+var language string
+
+// tr returns text in the language of the interface, formatted with args if there are any
+func tr(text string, args ...any) string {
+	if translated, ok := catalogs[language][text]; ok {
+		text = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// localeLanguage returns the language of the locale set in the environment,
+// like "es" for LANG=es_ES.UTF-8
+func localeLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			lang, _, _ := strings.Cut(locale, "_")
+			lang, _, _ = strings.Cut(lang, ".")
+			return strings.ToLower(lang)
+		}
+	}
+	return "en"
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// How long a peer may stay silent before the session is dropped
+const netTimeout = 10 * time.Second
+
+// Bumped whenever the messages below change
+const netVersion = 6
+
+var errCancelled = errors.New("cancelled")
+
+// netHello is exchanged once connected, both sides must run the same ROM on
+// the same machine. Seed and IPF are only meaningful coming from the host.
+type netHello struct {
+	Version    uint8
+	Hash       [40]byte
+	MemorySize uint32
+	Strict     bool
+	LoadAt     uint16
+	Hires      bool
+	Font       uint32
+	Quirks     chip8.Quirks
+	Seed       int64
+	IPF        uint16
+}
+
+// netFrame carries the keypad of a player at the start of a frame, to apply
+// on the next one, along with a checksum of the machine so a desync is
+// noticed right away.
+type netFrame struct {
+	Frame uint32
+	Keys  uint16
+	Check uint32
+}
+
+// Netplay keeps two machines running the same ROM in lockstep over TCP.
+// Both run the same instructions every frame, and the keys pressed on either
+// side apply to both a frame later, by when the other side has them.
+type Netplay struct {
+	conn  net.Conn
+	frame uint32
+
+	// The frame sent last, its keys apply next
+	sent netFrame
+}
+
+// connectPeer hosts a session on addr, or joins the one at addr, showing a
+// waiting screen until the other player shows up or the wait is cancelled.
+func connectPeer(renderer *sdl.Renderer, texts *TextCache, host bool, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+
+	message := tr("Connecting to %s", addr)
+	if host {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		defer ln.Close()
+		message = tr("Waiting for the other player on %s", ln.Addr())
+
+		go func() {
+			conn, err := ln.Accept()
+			done <- result{conn, err}
+		}()
+	} else {
+		go func() {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", addr)
+			done <- result{conn, err}
+		}()
+	}
+
+	// Lay out in menu coordinates whatever the window size
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	lines := []string{message, tr("<Escape> to cancel")}
+	for {
+		select {
+		case r := <-done:
+			return r.conn, r.err
+		default:
+		}
+
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return nil, errCancelled
+			case *sdl.KeyboardEvent:
+				if t.Type == sdl.KEYDOWN && t.Keysym.Sym == sdl.K_ESCAPE {
+					return nil, errCancelled
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+		y := winHeight/2 - int32(fontSize)
+		for _, line := range lines {
+			w, _, err := texts.Size(line)
+			if err != nil {
+				slog.Error("Failed to render text", "err", err)
+				continue
+			}
+			if _, _, err := texts.Draw(line, white, (winWidth-w)/2, y); err != nil {
+				slog.Error("Failed to render text", "err", err)
+			}
+			y += int32(fontSize) + 12
+		}
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
+
+// startNetplay checks that both players run the same ROM on the same machine
+// and has the host pick the random seed they share.
+func startNetplay(conn net.Conn, host bool, inst *Instance) (*Netplay, error) {
+	conn.SetDeadline(time.Now().Add(netTimeout))
+
+	local := netHello{
+		Version:    netVersion,
+		MemorySize: uint32(len(inst.CPU.Memory)),
+		Strict:     inst.CPU.Strict,
+		LoadAt:     uint16(loadAddress),
+		Hires:      inst.CPU.Hires,
+		Font:       crc32.ChecksumIEEE(inst.CPU.Font),
+		Quirks:     inst.CPU.Quirks,
+	}
+	copy(local.Hash[:], inst.Hash)
+	if host {
+		local.Seed = time.Now().UnixNano()
+		if deterministic {
+			local.Seed = deterministicSeed
+		}
+		local.IPF = uint16(inst.perFrame())
+	}
+	if err := binary.Write(conn, binary.BigEndian, local); err != nil {
+		return nil, err
+	}
+
+	var remote netHello
+	if err := binary.Read(conn, binary.BigEndian, &remote); err != nil {
+		return nil, err
+	}
+	switch {
+	case remote.Version != local.Version:
+		return nil, fmt.Errorf("the other player runs netplay version %d, this is version %d", remote.Version, local.Version)
+	case remote.Hash != local.Hash:
+		return nil, errors.New("the other player picked a different ROM")
+	case remote.MemorySize != local.MemorySize || remote.Strict != local.Strict || remote.LoadAt != local.LoadAt || remote.Hires != local.Hires || remote.Font != local.Font || remote.Quirks != local.Quirks:
+		return nil, errors.New("the other player runs with different -memory, -strict, -load-address, -machine, -font or -quirks options")
+	}
+
+	seed := local.Seed
+	if !host {
+		// The host sets the pace too, a side running faster would go out of sync
+		seed, inst.ipf = remote.Seed, int(remote.IPF)
+	}
+	inst.CPU.Rand = rand.New(rand.NewSource(seed))
+
+	// The RPL flags kept on disk differ between the players, start both without them
+	inst.CPU.RPL = [8]uint8{}
+
+	slog.Info("Netplay session started", "peer", conn.RemoteAddr(), "host", host)
+	return &Netplay{conn: conn}, nil
+}
+
+// syncNet is called at the start of every frame of the machine of inst with
+// the emulation locked. It sends the keypad of this player for the next frame
+// and applies the keypads both players sent on the frame before, the one of
+// the other player having had a whole frame to arrive. The emulation is
+// unlocked while the keypads are traded, so the window keeps responding
+// however long the other player takes to answer.
+func (e *Emulation) syncNet(inst *Instance) error {
+	n := inst.Net
+	local := netFrame{Frame: n.frame, Keys: packKeys(inst.Keys), Check: machineChecksum(&inst.CPU)}
+	e.Unlock()
+	remote, err := n.trade(local)
+	e.Lock()
+	if err != nil {
+		return err
+	}
+
+	// Nothing was sent before the first frame, it runs without keys
+	if n.frame > 0 {
+		if remote.Frame != n.sent.Frame {
+			return fmt.Errorf("the other player is at frame %d, this is frame %d", remote.Frame, n.sent.Frame)
+		}
+		if remote.Check != n.sent.Check {
+			return fmt.Errorf("the machines went out of sync at frame %d", n.sent.Frame)
+		}
+		inst.CPU.SetKeys(unpackKeys(n.sent.Keys | remote.Keys))
+	}
+	n.frame++
+	n.sent = local
+	return nil
+}
+
+// trade sends the frame of this player and returns the one the other player
+// sent on the frame before, none on the first frame
+func (n *Netplay) trade(local netFrame) (netFrame, error) {
+	var remote netFrame
+	n.conn.SetDeadline(time.Now().Add(netTimeout))
+	if err := binary.Write(n.conn, binary.BigEndian, local); err != nil || local.Frame == 0 {
+		return remote, err
+	}
+	err := binary.Read(n.conn, binary.BigEndian, &remote)
+	return remote, err
+}
+
+// Close ends the session
+func (n *Netplay) Close() error {
+	return n.conn.Close()
+}
+
+func packKeys(keys [16]bool) uint16 {
+	var packed uint16
+	for i, down := range keys {
+		if down {
+			packed |= 1 << i
+		}
+	}
+	return packed
+}
+
+func unpackKeys(packed uint16) [16]bool {
+	var keys [16]bool
+	for i := range keys {
+		keys[i] = packed&(1<<i) != 0
+	}
+	return keys
+}
+
+// machineChecksum sums up the registers, any difference between the two
+// machines soon shows up in them.
+func machineChecksum(cpu *chip8.CPU) uint32 {
+	buf := make([]byte, 0, 16+4)
+	buf = append(buf, cpu.V[:]...)
+	buf = binary.BigEndian.AppendUint16(buf, cpu.I)
+	buf = binary.BigEndian.AppendUint16(buf, cpu.Pc)
+	return crc32.ChecksumIEEE(buf)
+}
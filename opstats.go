@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/petersid2022/chip8/cmd"
+)
+
+// opcodeCounts counts the instructions the machines ran with -opcode-stats,
+// by opcode. It is nil without the option and only the emulation goroutine
+// touches it while the machines run.
+var opcodeCounts []uint64
+
+// The widest bar of the opcode histogram, in characters
+const opcodeBarWidth = 40
+
+// OpcodeStat is how often the instructions of a class ran
+type OpcodeStat struct {
+	Class    string `json:"class"`
+	Mnemonic string `json:"mnemonic"`
+	Count    uint64 `json:"count"`
+}
+
+// opcodeStats sums up opcodeCounts by class, the most run first
+func opcodeStats() []OpcodeStat {
+	byClass := map[string]*OpcodeStat{}
+	for opcode, n := range opcodeCounts {
+		if n == 0 {
+			continue
+		}
+		class := chip8.OpcodeClass(uint16(opcode))
+		if byClass[class] == nil {
+			// The operands of the mnemonic are those of the first opcode seen
+			byClass[class] = &OpcodeStat{Class: class, Mnemonic: chip8.Disassemble(uint16(opcode))}
+		}
+		byClass[class].Count += n
+	}
+	stats := make([]OpcodeStat, 0, len(byClass))
+	for _, s := range byClass {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Class < stats[j].Class
+	})
+	return stats
+}
+
+// writeOpcodeStats writes the instructions run as a histogram to standard
+// output for -opcode-stats -, or as JSON to the file given otherwise
+func writeOpcodeStats(path string) error {
+	stats := opcodeStats()
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+	return writeOpcodeHistogram(os.Stdout, stats)
+}
+
+// writeOpcodeHistogram prints a line per class with its share of the instructions
+func writeOpcodeHistogram(w io.Writer, stats []OpcodeStat) error {
+	var total uint64
+	for _, s := range stats {
+		total += s.Count
+	}
+	if total == 0 {
+		_, err := fmt.Fprintln(w, "No instructions ran")
+		return err
+	}
+	fmt.Fprintf(w, "%d instructions ran\n", total)
+	for _, s := range stats {
+		bar := strings.Repeat("#", int(s.Count*opcodeBarWidth/stats[0].Count))
+		if _, err := fmt.Fprintf(w, "  %-5s %-16s %12d %5.1f%% %s\n", s.Class, "e.g. "+s.Mnemonic, s.Count, float64(s.Count)*100/float64(total), bar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// How many frames the performance HUD graphs, 3 seconds at 60 frames a
+// second, and how wide each one is in window pixels
+const (
+	perfSamples = 180
+	perfWidth   = 2
+)
+
+// perfSample is what happened between two frames drawn
+type perfSample struct {
+	frameTime    uint32 // milliseconds
+	instructions int64
+	draws        int64
+}
+
+// PerfHUD graphs the last few seconds of the frame time, the instructions
+// run per frame and how often the programs drew, shown with -perf-hud or
+// <Shift>+<F2>
+type PerfHUD struct {
+	samples [perfSamples]perfSample
+	next    int
+	count   int
+
+	// The counters at the last frame
+	ticks               uint32
+	instructions, draws int64
+}
+
+// sample notes a frame drawn, from the counters of the emulation loop
+func (p *PerfHUD) sample() {
+	now := sdl.GetTicks()
+	instructions, draws := statInstructions.Value(), statDraws.Value()
+	if p.ticks != 0 {
+		p.samples[p.next] = perfSample{
+			frameTime:    now - p.ticks,
+			instructions: instructions - p.instructions,
+			draws:        draws - p.draws,
+		}
+		p.next = (p.next + 1) % perfSamples
+		p.count = min(p.count+1, perfSamples)
+	}
+	p.ticks, p.instructions, p.draws = now, instructions, draws
+}
+
+// Draw draws the graphs in the bottom left corner of screen
+func (p *PerfHUD) Draw(renderer *sdl.Renderer, texts *TextCache, screen sdl.Rect) {
+	const graphHeight = 32
+	lineHeight := int32(fontSize) + 2
+	rowHeight := lineHeight + graphHeight + 8
+	box := sdl.Rect{X: screen.X + 8, W: perfSamples*perfWidth + 16, H: 3*rowHeight + 8}
+	box.Y = screen.Y + screen.H - box.H - 8
+
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	renderer.SetDrawColor(0, 0, 0, 192)
+	renderer.FillRect(&box)
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+
+	// The samples oldest first
+	ordered := make([]perfSample, 0, p.count)
+	for i := 0; i < p.count; i++ {
+		ordered = append(ordered, p.samples[(p.next-p.count+i+perfSamples)%perfSamples])
+	}
+
+	graph := func(row int, label string, value func(s perfSample) int64) {
+		var total, peak int64
+		for _, s := range ordered {
+			total += value(s)
+			peak = max(peak, value(s))
+		}
+		average := 0.0
+		if len(ordered) > 0 {
+			average = float64(total) / float64(len(ordered))
+		}
+
+		y := box.Y + 8 + int32(row)*rowHeight
+		if _, _, err := texts.Draw(fmt.Sprintf("%s %.1f (max %d)", label, average, peak), white, box.X+8, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+		bottom := y + lineHeight + graphHeight
+		renderer.SetDrawColor(48, 48, 48, 255)
+		renderer.DrawLine(box.X+8, bottom, box.X+8+perfSamples*perfWidth-1, bottom)
+		renderer.SetDrawColor(yellow.R, yellow.G, yellow.B, 255)
+		for i, s := range ordered {
+			if peak == 0 {
+				break
+			}
+			h := int32(value(s) * graphHeight / peak)
+			x := box.X + 8 + int32(perfSamples-len(ordered)+i)*perfWidth
+			renderer.FillRect(&sdl.Rect{X: x, Y: bottom - h, W: perfWidth, H: h})
+		}
+	}
+	graph(0, "ms/frame", func(s perfSample) int64 { return int64(s.frameTime) })
+	graph(1, "instr/frame", func(s perfSample) int64 { return s.instructions })
+	graph(2, "draws/frame", func(s perfSample) int64 { return s.draws })
+}
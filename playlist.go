@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// PlaylistEntry is a ROM of a -playlist, played for Minutes or until its
+// game over condition turns true
+type PlaylistEntry struct {
+	Rom     string
+	Minutes float64
+
+	// The game is over once the condition turns true, like M[0x1F0] == 0
+	// for the lives running out. Nil plays the ROM for Minutes.
+	GameOver *Condition
+}
+
+// Condition compares two watch expressions, with ==, !=, <, <=, > or >=
+type Condition struct {
+	Text        string
+	left, right watchExpr
+	compare     func(a, b int) bool
+}
+
+// The comparisons of conditions, the two character ones first
+var conditionOps = []struct {
+	op      string
+	compare func(a, b int) bool
+}{
+	{"==", func(a, b int) bool { return a == b }},
+	{"!=", func(a, b int) bool { return a != b }},
+	{"<=", func(a, b int) bool { return a <= b }},
+	{">=", func(a, b int) bool { return a >= b }},
+	{"<", func(a, b int) bool { return a < b }},
+	{">", func(a, b int) bool { return a > b }},
+}
+
+// parseCondition compiles a condition like V3 == 0 or M[0x2F0] < 2
+func parseCondition(text string) (*Condition, error) {
+	for _, c := range conditionOps {
+		i := strings.Index(text, c.op)
+		if i == -1 {
+			continue
+		}
+		left, err := parseWatch(text[:i])
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseWatch(text[i+len(c.op):])
+		if err != nil {
+			return nil, err
+		}
+		return &Condition{Text: text, left: left.expr, right: right.expr, compare: c.compare}, nil
+	}
+	return nil, fmt.Errorf("no comparison in %q, want ==, !=, <, <=, > or >=", text)
+}
+
+// Holds reports whether the condition is true of the machine
+func (c *Condition) Holds(cpu *chip8.CPU) bool {
+	return c.compare(c.left(cpu), c.right(cpu))
+}
+
+// readPlaylist reads a -playlist file. Every line is
+//
+//	<rom> <minutes> [game over condition]
+//
+// where rom is a bundled ROM or a file, relative to the playlist, and "#"
+// starts a comment.
+func readPlaylist(name string) ([]PlaylistEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir, err := filepath.Abs(filepath.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []PlaylistEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: want <rom> <minutes> [game over condition], got %q", name, line, text)
+		}
+		entry := PlaylistEntry{Rom: fields[0]}
+		if entry.Minutes, err = strconv.ParseFloat(fields[1], 64); err != nil || entry.Minutes <= 0 {
+			return nil, fmt.Errorf("%s:%d: invalid minutes %q", name, line, fields[1])
+		}
+		if len(fields) > 2 {
+			if entry.GameOver, err = parseCondition(strings.Join(fields[2:], " ")); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+		}
+		if !filepath.IsAbs(entry.Rom) && !bundledRom(entry.Rom) {
+			entry.Rom = filepath.Join(dir, entry.Rom)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no ROMs in the playlist", name)
+	}
+	return entries, nil
+}
+
+// bundledRom reports whether name is one of the ROMs of the roms directory
+func bundledRom(name string) bool {
+	_, err := fs.Stat(content, path.Join("roms", name))
+	return err == nil
+}
+
+// Playlist goes through the ROMs of a -playlist, over and over
+type Playlist struct {
+	entries []PlaylistEntry
+	next    int
+
+	// The ROM playing and since when
+	entry   *PlaylistEntry
+	started uint32
+
+	// Whether the game over condition held on the last frame, the game is
+	// over once it turns true rather than while it is, since many games
+	// start out looking like they are over
+	held bool
+}
+
+// The -playlist being played, nil without one
+var playlist *Playlist
+
+// advance returns the next ROM to play, after the last one the first again
+func (p *Playlist) advance() string {
+	p.entry, p.started, p.held = &p.entries[p.next], sdl.GetTicks(), true
+	p.next = (p.next + 1) % len(p.entries)
+	return p.entry.Rom
+}
+
+// over reports whether the ROM playing had its time or reached its game over
+func (p *Playlist) over(cpu *chip8.CPU) bool {
+	if float64(sdl.GetTicks()-p.started) >= p.entry.Minutes*60000 {
+		slog.Info("Playlist ROM played its time", "rom", p.entry.Rom)
+		return true
+	}
+	if p.entry.GameOver == nil {
+		return false
+	}
+	held := p.entry.GameOver.Holds(cpu)
+	turned := held && !p.held
+	p.held = held
+	if turned {
+		slog.Info("Playlist ROM game over", "rom", p.entry.Rom, "condition", p.entry.GameOver.Text)
+	}
+	return turned
+}
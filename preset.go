@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/petersid2022/chip8/cmd"
+)
+
+// Preset is the settings a ROM plays well with, exported from a game with
+// <Ctrl>+<F5> and imported with -preset, to share what works for fussy ROMs
+type Preset struct {
+	// The ROM the settings are for, its name and the SHA-1 of its contents
+	Rom  string `json:"rom"`
+	SHA1 string `json:"sha1"`
+
+	Quirks chip8.Quirks `json:"quirks"`
+
+	// Instructions per frame, 0 for one instruction at a time
+	IPF int `json:"ipf"`
+
+	Palette  string `json:"palette"`
+	Keycodes bool   `json:"keycodes"`
+}
+
+// The -preset imported, nil without one
+var preset *Preset
+
+// presetFor returns the imported preset if it is for the ROM with hash
+func presetFor(hash string) *Preset {
+	if preset == nil || !strings.EqualFold(preset.SHA1, hash) {
+		return nil
+	}
+	return preset
+}
+
+func presetDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "presets"), nil
+}
+
+// exportPreset writes the settings inst plays with as a preset named after
+// the ROM and returns its path
+func (inst *Instance) exportPreset() (string, error) {
+	p := Preset{
+		Rom:      filepath.Base(inst.Name),
+		SHA1:     inst.Hash,
+		Quirks:   inst.CPU.Quirks,
+		Palette:  flag.Lookup("palette").Value.String(),
+		Keycodes: keycodeMapping,
+	}
+	if inst.framed() {
+		p.IPF = inst.perFrame()
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := presetDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(p.Rom, filepath.Ext(p.Rom))
+	path := filepath.Join(dir, name+".json")
+	return path, os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// readPreset reads a preset exported by someone, checking its settings
+func readPreset(name string) (*Preset, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p := &Preset{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if p.SHA1 == "" {
+		return nil, fmt.Errorf("%s: no sha1 of the ROM the preset is for", name)
+	}
+	if p.IPF < 0 || p.IPF > maxIPF {
+		return nil, fmt.Errorf("%s: invalid instructions per frame %d", name, p.IPF)
+	}
+	if p.Palette != "" {
+		if _, err := parsePalette(p.Palette); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return p, nil
+}
+
+// applyFlags gives the options of the whole run the preset sets their
+// value, but those set on the command line. The quirks and the speed only
+// apply to the ROM of the preset, when it is loaded.
+func (p *Preset) applyFlags(flags *flag.FlagSet) error {
+	values := map[string]string{"keycodes": strconv.FormatBool(p.Keycodes)}
+	if p.Palette != "" {
+		values["palette"] = p.Palette
+	}
+	for name, value := range values {
+		if optionOrigins[name] == fromCommandLine {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// QuirksProfile is a named set of quirks, picked with -quirks or on the
+// quirks screen of the menu
+type QuirksProfile struct {
+	Name   string
+	Quirks chip8.Quirks
+}
+
+// The profiles that come with the emulator, the first is the default. The
+// ones saved from the quirks screen follow them.
+var builtinQuirks = []QuirksProfile{
+	{Name: "chip8"},
+	{Name: "vip", Quirks: chip8.Quirks{ShiftVY: true, IncrementI: true, ResetVF: true}},
+	{Name: "schip", Quirks: chip8.Quirks{JumpVX: true}},
+}
+
+// The color of the descriptions of the quirks screen
+var gray = sdl.Color{R: 160, G: 160, B: 160, A: 255}
+
+// The quirks the quirks screen lists, with what they change
+var quirkSettings = []struct {
+	name        string
+	description string
+	flag        func(q *chip8.Quirks) *bool
+}{
+	{"Shift VY", "8XY6 and 8XYE shift VY into VX, as on the COSMAC VIP", func(q *chip8.Quirks) *bool { return &q.ShiftVY }},
+	{"Increment I", "FX55 and FX65 move I past the registers, as on the VIP", func(q *chip8.Quirks) *bool { return &q.IncrementI }},
+	{"Jump to XNN + VX", "BXNN jumps to XNN plus VX as on SCHIP, not to NNN + V0", func(q *chip8.Quirks) *bool { return &q.JumpVX }},
+	{"Reset VF", "8XY1, 8XY2 and 8XY3 clear VF, as on the COSMAC VIP", func(q *chip8.Quirks) *bool { return &q.ResetVF }},
+	{"Wrap X", "Sprites past the right edge come back on the left", func(q *chip8.Quirks) *bool { return &q.WrapX }},
+	{"Wrap Y", "Sprites past the bottom edge come back at the top", func(q *chip8.Quirks) *bool { return &q.WrapY }},
+}
+
+// Names of saved profiles, they become file names
+var quirksNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+func quirksDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "quirks"), nil
+}
+
+// quirkProfiles returns the built-in profiles followed by the saved ones, by name
+func quirkProfiles() ([]QuirksProfile, error) {
+	profiles := append([]QuirksProfile(nil), builtinQuirks...)
+	dir, err := quirksDir()
+	if err != nil {
+		return profiles, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return profiles, err
+	}
+	sort.Strings(paths)
+
+	var errs []error
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if builtinProfile(name) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		profile := QuirksProfile{Name: name}
+		if err := json.Unmarshal(data, &profile.Quirks); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, errors.Join(errs...)
+}
+
+func builtinProfile(name string) bool {
+	for _, p := range builtinQuirks {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findQuirks returns the quirks of the profile called name
+func findQuirks(name string) (chip8.Quirks, error) {
+	profiles, err := quirkProfiles()
+	for _, p := range profiles {
+		if p.Name == name {
+			return p.Quirks, nil
+		}
+	}
+	if err != nil {
+		return chip8.Quirks{}, err
+	}
+	return chip8.Quirks{}, fmt.Errorf("no quirks profile %q", name)
+}
+
+// writeQuirks saves a profile for -quirks and the quirks screen
+func writeQuirks(name string, q chip8.Quirks) error {
+	if !quirksNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q, want letters, digits, - and _", name)
+	}
+	if builtinProfile(name) {
+		return fmt.Errorf("%s is one of the built-in profiles", name)
+	}
+	dir, err := quirksDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".json"), append(data, '\n'), 0644)
+}
+
+// quirksLabel names the quirks the next ROM runs with, for the menu
+func quirksLabel() string {
+	if quirksName == "" {
+		return tr("custom")
+	}
+	return quirksName
+}
+
+// showQuirks lets the player pick a profile, toggle its quirks and save
+// them as a profile of their own. The quirks left selected apply to the
+// ROMs played next.
+func showQuirks(renderer *sdl.Renderer, texts *TextCache) {
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	profiles, err := quirkProfiles()
+	if err != nil {
+		slog.Error("Failed to read quirks", "err", err)
+	}
+	profile := 0
+	for i, p := range profiles {
+		if p.Name == quirksName {
+			profile = i
+		}
+	}
+
+	lineHeight := int32(fontSize) + 8
+	selected := 0
+	status := ""
+
+	// Typing the name of the profile to save, started with "S"
+	naming := false
+	name := ""
+
+	draw := func(text string, color sdl.Color, x, y int32) {
+		if _, _, err := texts.Draw(text, color, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return
+			case *sdl.TextInputEvent:
+				if naming {
+					name += t.GetText()
+				}
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				if naming {
+					switch t.Keysym.Sym {
+					case sdl.K_ESCAPE:
+						naming = false
+					case sdl.K_BACKSPACE:
+						if len(name) > 0 {
+							name = name[:len(name)-1]
+						}
+					case sdl.K_RETURN, sdl.K_KP_ENTER:
+						naming = false
+						if err := writeQuirks(name, quirks); err != nil {
+							status = err.Error()
+							break
+						}
+						if profiles, err = quirkProfiles(); err != nil {
+							slog.Error("Failed to read quirks", "err", err)
+						}
+						for i, p := range profiles {
+							if p.Name == name {
+								profile = i
+							}
+						}
+						quirksName = name
+						status = tr("Saved as %s", name)
+					}
+					break
+				}
+				switch t.Keysym.Sym {
+				case sdl.K_ESCAPE:
+					return
+				case sdl.K_UP:
+					if selected > 0 {
+						selected--
+					}
+				case sdl.K_DOWN:
+					if selected < len(quirkSettings)-1 {
+						selected++
+					}
+				case sdl.K_LEFT, sdl.K_RIGHT:
+					if t.Keysym.Sym == sdl.K_LEFT {
+						profile = (profile + len(profiles) - 1) % len(profiles)
+					} else {
+						profile = (profile + 1) % len(profiles)
+					}
+					quirks, quirksName = profiles[profile].Quirks, profiles[profile].Name
+					status = ""
+				case sdl.K_RETURN, sdl.K_KP_ENTER, sdl.K_SPACE:
+					on := quirkSettings[selected].flag(&quirks)
+					*on = !*on
+					// Toggled quirks make a profile of their own until saved
+					quirksName = ""
+					if quirks == profiles[profile].Quirks {
+						quirksName = profiles[profile].Name
+					}
+				case sdl.K_s:
+					naming, name, status = true, "", ""
+					// Don't type the "s" itself into the name
+					sdl.FlushEvent(sdl.TEXTINPUT)
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		draw(tr("Quirks"), yellow, 32, 32)
+		draw(tr("Profile: < %s >", quirksLabel()), white, 32, 32+lineHeight)
+
+		// Every quirk takes a row and its description the lines below
+		descriptionHeight := int32(fontSize) + 2
+		y := 32 + 3*lineHeight
+		for i, setting := range quirkSettings {
+			lines := wrapText(texts, tr(setting.description), winWidth-112)
+			if i == selected {
+				renderer.SetDrawColor(64, 64, 64, 255)
+				renderer.FillRect(&sdl.Rect{X: 24, Y: y - 4, W: winWidth - 48, H: lineHeight + descriptionHeight*int32(len(lines))})
+			}
+			box := "[ ]"
+			if *setting.flag(&quirks) {
+				box = "[x]"
+			}
+			draw(box+" "+tr(setting.name), white, 32, y)
+			y += lineHeight
+			for _, line := range lines {
+				draw(line, gray, 80, y)
+				y += descriptionHeight
+			}
+			y += 4
+		}
+
+		switch {
+		case naming:
+			draw(tr("Save as: %s_", name), yellow, 32, winHeight-2*lineHeight-8)
+		case status != "":
+			draw(status, yellow, 32, winHeight-2*lineHeight-8)
+		}
+		draw(tr("<Left>/<Right> profile, <Space> toggle, <S> save, <Esc> back"), white, 32, winHeight-lineHeight-8)
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
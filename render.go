@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Frame is a CHIP-8 screen, one byte per pixel in row-major order
+type Frame struct {
+	Pixels        []byte
+	Width, Height int
+}
+
+// cpuFrame returns the current screen of cpu, it changes as the emulation goes on
+func cpuFrame(cpu *chip8.CPU) Frame {
+	return Frame{Pixels: cpu.Framebuffer(), Width: cpu.Width(), Height: cpu.Height()}
+}
+
+// stateFrame returns the screen of a saved state
+func stateFrame(s *chip8.State) Frame {
+	return Frame{Pixels: s.Display, Width: s.DisplayWidth, Height: s.DisplayHeight}
+}
+
+// frameImage returns a frame as a black and white image, every pixel scale x scale
+func frameImage(frame Frame, scale int) *image.Paletted {
+	palette := color.Palette{color.Black, color.White}
+	img := image.NewPaletted(image.Rect(0, 0, frame.Width*scale, frame.Height*scale), palette)
+	for y := 0; y < frame.Height*scale; y++ {
+		for x := 0; x < frame.Width*scale; x++ {
+			img.SetColorIndex(x, y, frame.Pixels[(y/scale)*frame.Width+x/scale])
+		}
+	}
+	return img
+}
+
+// frameText returns a frame as text art, a line per row of pixels with #
+// for the lit ones and . for the others. With blocks it is drawn with the
+// Unicode half blocks instead, two rows of pixels a line so the pixels come
+// out about square in a chat or a terminal.
+func frameText(frame Frame, blocks bool) string {
+	lit := func(x, y int) bool {
+		return y < frame.Height && frame.Pixels[y*frame.Width+x] != 0
+	}
+	var b strings.Builder
+	if !blocks {
+		for y := 0; y < frame.Height; y++ {
+			for x := 0; x < frame.Width; x++ {
+				if lit(x, y) {
+					b.WriteByte('#')
+				} else {
+					b.WriteByte('.')
+				}
+			}
+			b.WriteByte('\n')
+		}
+		return b.String()
+	}
+	// By whether the top and the bottom pixel are lit
+	halves := [2][2]string{{" ", "▄"}, {"▀", "█"}}
+	for y := 0; y < frame.Height; y += 2 {
+		for x := 0; x < frame.Width; x++ {
+			top, bottom := 0, 0
+			if lit(x, y) {
+				top = 1
+			}
+			if lit(x, y+1) {
+				bottom = 1
+			}
+			b.WriteString(halves[top][bottom])
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// parseColor reads a color written as RRGGBB, with or without a leading "#"
+func parseColor(s string) (sdl.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return sdl.Color{}, fmt.Errorf("invalid color %q: want RRGGBB", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return sdl.Color{}, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	return sdl.Color{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// drawGrid draws thin lines between the pixels of a width x height screen drawn into rect
+func drawGrid(renderer *sdl.Renderer, rect sdl.Rect, width, height int) {
+	w, h := int32(width), int32(height)
+	renderer.SetDrawColor(48, 48, 48, 255)
+	for j := int32(1); j < w; j++ {
+		x := rect.X + j*rect.W/w
+		renderer.DrawLine(x, rect.Y, x, rect.Y+rect.H-1)
+	}
+	for i := int32(1); i < h; i++ {
+		y := rect.Y + i*rect.H/h
+		renderer.DrawLine(rect.X, y, rect.X+rect.W-1, y)
+	}
+}
+
+// Colors of the pixels the last change of the screen set and cleared, with -show-changes
+const (
+	changeSet   = 0xFFFF4040
+	changeClear = 0xFF4060FF
+)
+
+// How much the CRT effect bulges the screen, as a fraction of its size at the corners
+const crtCurvature = 0.06
+
+// ScreenRenderer draws the CHIP-8 framebuffer through a texture holding one
+// texel per CHIP-8 pixel, which the GPU scales to the window. With CRT
+// effects on the screen goes through intermediate render targets first.
+type ScreenRenderer struct {
+	renderer      *sdl.Renderer
+	screen        *sdl.Texture
+	width, height int
+	pixels        []uint32
+
+	// The previous frame, blended with the current one to hide flicker
+	previous []uint8
+
+	// The last frame shown and when the screen last flashed, for -reduce-flashes
+	shown     []uint8
+	lastFlash time.Time
+
+	// The screen before its last change and after it. ShowChanges tints the
+	// pixels that differ between the two
+	before, after []uint8
+	ShowChanges   bool
+
+	// Render targets for the CRT effects, only used if the renderer can render to textures
+	targets          bool
+	first, second    *sdl.Texture
+	targetW, targetH int32
+}
+
+func NewScreenRenderer(renderer *sdl.Renderer) (*ScreenRenderer, error) {
+	s := &ScreenRenderer{renderer: renderer}
+	if err := s.resizeScreen(chip8.LoresWidth, chip8.LoresHeight); err != nil {
+		return nil, err
+	}
+	if info, err := renderer.GetInfo(); err == nil && info.Flags&sdl.RENDERER_TARGETTEXTURE != 0 {
+		s.targets = true
+	} else {
+		slog.Warn("Renderer can't render to textures, CRT effects are disabled")
+	}
+	return s, nil
+}
+
+// resizeScreen makes sure the screen texture matches the resolution of the machine
+func (s *ScreenRenderer) resizeScreen(width, height int) error {
+	if s.screen != nil && s.width == width && s.height == height {
+		return nil
+	}
+	screen, err := s.renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, int32(width), int32(height))
+	if err != nil {
+		return err
+	}
+	screen.SetBlendMode(sdl.BLENDMODE_NONE)
+
+	if s.screen != nil {
+		s.screen.Destroy()
+	}
+	s.screen = screen
+	s.width, s.height = width, height
+	s.pixels = make([]uint32, width*height)
+	s.previous = make([]uint8, width*height)
+	s.shown = make([]uint8, width*height)
+	s.before = make([]uint8, width*height)
+	s.after = make([]uint8, width*height)
+	return nil
+}
+
+// Draw draws a frame scaled into rect
+func (s *ScreenRenderer) Draw(frame Frame, rect sdl.Rect) error {
+	if err := s.resizeScreen(frame.Width, frame.Height); err != nil {
+		return err
+	}
+	// Sprites are erased and redrawn with XOR, which makes them flicker. Mixing
+	// every frame with the one before keeps them lit while that happens.
+	weight := 0.0
+	if antiFlicker {
+		weight = frameBlend
+	}
+	pixels := frame.Pixels
+	if reduceFlashes {
+		pixels = s.limitFlashes(pixels)
+	}
+	for i, pixel := range pixels {
+		level := float64(pixel)*(1-weight) + float64(s.previous[i])*weight
+		s.pixels[i] = palette.mix(level)
+	}
+	copy(s.previous, pixels)
+
+	// The screen keeps the tint of its last change until it changes again,
+	// so it shows what a single step drew
+	if !bytes.Equal(frame.Pixels, s.after) {
+		copy(s.before, s.after)
+		copy(s.after, frame.Pixels)
+	}
+	if s.ShowChanges {
+		for i := range s.after {
+			switch {
+			case s.after[i] != 0 && s.before[i] == 0:
+				s.pixels[i] = changeSet
+			case s.after[i] == 0 && s.before[i] != 0:
+				s.pixels[i] = changeClear
+			}
+		}
+	}
+	if err := s.screen.UpdateRGBA(nil, s.pixels, s.width); err != nil {
+		return err
+	}
+
+	if !crtEffects || !s.targets {
+		return s.renderer.Copy(s.screen, nil, &rect)
+	}
+	return s.drawCRT(rect)
+}
+
+// drawCRT draws the screen with scanlines and a vignette, then bulges it
+// like the glass of a CRT by squeezing the ends of every row and column.
+func (s *ScreenRenderer) drawCRT(rect sdl.Rect) error {
+	if err := s.resizeTargets(rect.W, rect.H); err != nil {
+		return err
+	}
+	r := s.renderer
+	w, h := rect.W, rect.H
+
+	if err := r.SetRenderTarget(s.first); err != nil {
+		return err
+	}
+	r.Copy(s.screen, nil, nil)
+
+	r.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+
+	// Scanlines, every third line is darker
+	r.SetDrawColor(0, 0, 0, 96)
+	for y := int32(0); y < h; y += 3 {
+		r.DrawLine(0, y, w-1, y)
+	}
+
+	// Vignette, rings getting darker towards the edges
+	const rings = 16
+	step := w / 4 / rings
+	if h/4/rings < step {
+		step = h / 4 / rings
+	}
+	if step < 1 {
+		step = 1
+	}
+	for k := int32(0); k < rings; k++ {
+		r.SetDrawColor(0, 0, 0, uint8(6*(rings-k)))
+		inset := k * step
+		iw, ih := w-2*inset, h-2*inset
+		r.FillRects([]sdl.Rect{
+			{X: inset, Y: inset, W: iw, H: step},
+			{X: inset, Y: h - inset - step, W: iw, H: step},
+			{X: inset, Y: inset + step, W: step, H: ih - 2*step},
+			{X: w - inset - step, Y: inset + step, W: step, H: ih - 2*step},
+		})
+	}
+
+	r.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+
+	// Curvature, first squeezing the rows into the second target...
+	const strip = 2
+	if err := r.SetRenderTarget(s.second); err != nil {
+		return err
+	}
+	r.SetDrawColor(borderColor.R, borderColor.G, borderColor.B, 255)
+	r.Clear()
+	for y := int32(0); y < h; y += strip {
+		dy := (float64(y)+strip/2)/float64(h)*2 - 1
+		inset := int32(crtCurvature * dy * dy * float64(w) / 2)
+		r.Copy(s.first, &sdl.Rect{X: 0, Y: y, W: w, H: strip}, &sdl.Rect{X: inset, Y: y, W: w - 2*inset, H: strip})
+	}
+
+	// ...then the columns onto the window
+	if err := r.SetRenderTarget(nil); err != nil {
+		return err
+	}
+	for x := int32(0); x < w; x += strip {
+		dx := (float64(x)+strip/2)/float64(w)*2 - 1
+		inset := int32(crtCurvature * dx * dx * float64(h) / 2)
+		r.Copy(s.second, &sdl.Rect{X: x, Y: 0, W: strip, H: h}, &sdl.Rect{X: rect.X + x, Y: rect.Y + inset, W: strip, H: h - 2*inset})
+	}
+	return nil
+}
+
+// resizeTargets makes sure the CRT render targets are w x h
+func (s *ScreenRenderer) resizeTargets(w, h int32) error {
+	if s.first != nil && s.targetW == w && s.targetH == h {
+		return nil
+	}
+	s.destroyTargets()
+
+	var err error
+	if s.first, err = s.renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_TARGET, w, h); err != nil {
+		return err
+	}
+	if s.second, err = s.renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_TARGET, w, h); err != nil {
+		s.destroyTargets()
+		return err
+	}
+	s.first.SetBlendMode(sdl.BLENDMODE_NONE)
+	s.second.SetBlendMode(sdl.BLENDMODE_NONE)
+	s.targetW, s.targetH = w, h
+	return nil
+}
+
+func (s *ScreenRenderer) destroyTargets() {
+	if s.first != nil {
+		s.first.Destroy()
+		s.first = nil
+	}
+	if s.second != nil {
+		s.second.Destroy()
+		s.second = nil
+	}
+}
+
+func (s *ScreenRenderer) Destroy() {
+	s.destroyTargets()
+	s.screen.Destroy()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// BenchmarkRender draws a changing screen with the software renderer in
+// every mode, the speed of the CPU is measured by the benchmarks of cmd
+func BenchmarkRender(b *testing.B) {
+	modes := []struct {
+		name             string
+		crt, antiFlicker bool
+	}{
+		{"plain", false, false},
+		{"anti-flicker", false, true},
+		{"crt", true, false},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			crtEffects, antiFlicker = mode.crt, mode.antiFlicker
+			defer func() { crtEffects, antiFlicker = false, false }()
+			benchRender(b)
+		})
+	}
+}
+
+func benchRender(b *testing.B) {
+	surface, err := sdl.CreateRGBSurfaceWithFormat(0, winWidth, winHeight, 32, sdl.PIXELFORMAT_ARGB8888)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer surface.Free()
+
+	renderer, err := sdl.CreateSoftwareRenderer(surface)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer renderer.Destroy()
+
+	screen, err := NewScreenRenderer(renderer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer screen.Destroy()
+
+	frame := Frame{Pixels: make([]byte, chip8.LoresWidth*chip8.LoresHeight), Width: chip8.LoresWidth, Height: chip8.LoresHeight}
+	rect := displayRect(winWidth, winHeight, frame.Width, frame.Height)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// A checkerboard that shifts every frame
+		for j := range frame.Pixels {
+			frame.Pixels[j] = byte((j/frame.Width + j%frame.Width + i) % 2)
+		}
+		renderer.SetDrawColor(borderColor.R, borderColor.G, borderColor.B, 255)
+		renderer.Clear()
+		if err := screen.Draw(frame, rect); err != nil {
+			b.Fatal(err)
+		}
+		if showGrid {
+			drawGrid(renderer, rect, frame.Width, frame.Height)
+		}
+		renderer.Present()
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "frames/s")
+}
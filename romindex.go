@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// The descriptions of the bundled ROMs, by file name, are kept in this file of the roms directory
+const romIndexFile = "index.json"
+
+// RomMeta describes a ROM for the side panel of the menu, every field is optional
+type RomMeta struct {
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	Controls    string `json:"controls"`
+	Description string `json:"description"`
+
+	// Quirks the game needs, like {"wrap_y": true}. They override the
+	// quirks picked, the ones left out stay as picked.
+	Quirks json.RawMessage `json:"quirks"`
+}
+
+// readRomIndex reads the descriptions of the bundled ROMs, there are none
+// if the roms directory has no index
+func readRomIndex() (map[string]RomMeta, error) {
+	data, err := content.ReadFile(path.Join("roms", romIndexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index map[string]RomMeta
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%s: %w", romIndexFile, err)
+	}
+	return index, nil
+}
+
+// romQuirks returns the quirks to run a ROM with, the ones picked with the
+// quirks the ROM index sets for it on top
+func romQuirks(romName string, picked chip8.Quirks) (chip8.Quirks, error) {
+	index, err := readRomIndex()
+	if err != nil {
+		return picked, err
+	}
+	meta, ok := index[filepath.Base(romName)]
+	if !ok || meta.Quirks == nil {
+		return picked, nil
+	}
+	q := picked
+	if err := json.Unmarshal(meta.Quirks, &q); err != nil {
+		return picked, fmt.Errorf("%s: quirks of %s: %w", romIndexFile, filepath.Base(romName), err)
+	}
+	return q, nil
+}
+
+// wrapText splits text in lines no wider than width, breaking it between words
+func wrapText(texts *TextCache, text string, width int32) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		next := word
+		if line != "" {
+			next = line + " " + word
+		}
+		if w, _, err := texts.Size(next); err == nil && w > width && line != "" {
+			lines = append(lines, line)
+			next = word
+		}
+		line = next
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// drawRomMeta draws the description of a ROM into rect, leaving out what doesn't fit
+func drawRomMeta(renderer *sdl.Renderer, texts *TextCache, meta RomMeta, rect sdl.Rect) {
+	renderer.SetDrawColor(24, 24, 24, 255)
+	renderer.FillRect(&rect)
+
+	lineHeight := int32(fontSize) + 2
+	width := rect.W - 16
+	y := rect.Y + 8
+	paragraph := func(text string, color sdl.Color) {
+		for _, line := range wrapText(texts, text, width) {
+			if y+lineHeight > rect.Y+rect.H {
+				return
+			}
+			if _, _, err := texts.Draw(line, color, rect.X+8, y); err != nil {
+				slog.Error("Failed to render text", "err", err)
+			}
+			y += lineHeight
+		}
+		y += lineHeight / 2
+	}
+
+	if meta.Title != "" {
+		paragraph(meta.Title, yellow)
+	}
+	if meta.Author != "" {
+		paragraph(tr("by %s", meta.Author), white)
+	}
+	if meta.Controls != "" {
+		paragraph(tr("Controls: %s", meta.Controls), white)
+	}
+	if meta.Description != "" {
+		paragraph(meta.Description, white)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/petersid2022/chip8/cmd"
+)
+
+// How often a watched ROM is looked at
+const watchInterval = 250 * time.Millisecond
+
+// fileWatch notices when a file changes, going by its size and modification
+// time. It polls rather than asking the system to be told, which needs no
+// code of its own per system.
+type fileWatch struct {
+	path    string
+	size    int64
+	modTime time.Time
+	checked time.Time
+
+	// The contents the program was loaded from, for -watch-keep
+	rom []byte
+}
+
+func newFileWatch(path string) *fileWatch {
+	w := &fileWatch{path: path}
+	w.changed()
+	var err error
+	if w.rom, err = readRomFile(path); err != nil {
+		slog.Error("Failed to read the ROM", "rom", path, "err", err)
+	}
+	return w
+}
+
+// changed reports whether the file changed since it was last looked at. A
+// file that went missing, like while an editor replaces it, hasn't changed yet.
+func (w *fileWatch) changed() bool {
+	if time.Since(w.checked) < watchInterval {
+		return false
+	}
+	w.checked = time.Now()
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false
+	}
+	if info.Size() == w.size && info.ModTime().Equal(w.modTime) {
+		return false
+	}
+	w.size, w.modTime = info.Size(), info.ModTime()
+	return true
+}
+
+// reload loads the new version of the watched ROM into inst. With -watch-keep
+// the changes are patched into the running program instead, unless it is
+// running code the new version doesn't have anymore, then it starts over.
+func (w *fileWatch) reload(inst *Instance) {
+	data, err := readRomFile(w.path)
+	if err != nil {
+		slog.Error("Failed to reload the ROM", "rom", w.path, "err", err)
+		return
+	}
+
+	if watchKeep && w.rom != nil {
+		err := inst.CPU.PatchRom(w.rom, data)
+		if err == nil {
+			w.rom = data
+			notify("Patched %s", filepath.Base(w.path))
+			return
+		}
+		if !errors.Is(err, chip8.ErrPcMoved) {
+			slog.Error("Failed to patch the ROM", "rom", w.path, "err", err)
+			return
+		}
+		slog.Info("Starting the ROM over", "rom", w.path, "reason", err)
+		notify("The code moved, starting over")
+	}
+
+	if err := inst.Load(w.path); err != nil {
+		slog.Error("Failed to reload the ROM", "rom", w.path, "err", err)
+		return
+	}
+	w.rom = data
+	notify("Reloaded %s", filepath.Base(w.path))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Window scale limits, as multiples of the 64x32 CHIP-8 screen
+const (
+	minScale = 1
+	maxScale = 16
+)
+
+// setScale resizes the window to scale times the CHIP-8 resolution
+func setScale(window *sdl.Window, scale int) {
+	if scale < minScale {
+		scale = minScale
+	}
+	if scale > maxScale {
+		scale = maxScale
+	}
+	windowScale = scale
+	window.SetSize(64*int32(scale), 32*int32(scale))
+}
+
+// handleScaleKey resizes the window on Ctrl+1..9 and reports whether the key was used
+func handleScaleKey(window *sdl.Window, t *sdl.KeyboardEvent) bool {
+	if t.Keysym.Mod&sdl.KMOD_CTRL == 0 || t.Keysym.Sym < sdl.K_1 || t.Keysym.Sym > sdl.K_9 {
+		return false
+	}
+	setScale(window, int(t.Keysym.Sym-sdl.K_0))
+	return true
+}
+
+// displayRect returns the part of a window a width x height CHIP-8 screen is
+// drawn in. With integer scaling every CHIP-8 pixel is the same whole number
+// of window pixels and the screen is centered, otherwise it is stretched to
+// the window.
+func displayRect(windowWidth, windowHeight int32, width, height int) sdl.Rect {
+	if !integerScaling {
+		return sdl.Rect{X: 0, Y: 0, W: windowWidth, H: windowHeight}
+	}
+
+	scale := windowWidth / int32(width)
+	if windowHeight/int32(height) < scale {
+		scale = windowHeight / int32(height)
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	w, h := int32(width)*scale, int32(height)*scale
+	return sdl.Rect{X: (windowWidth - w) / 2, Y: (windowHeight - h) / 2, W: w, H: h}
+}
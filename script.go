@@ -0,0 +1,114 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Script reacts to the emulation of a machine: cheats, auto-splitters, bots.
+// Scripts are Go values for now, an embedded language would bind its
+// callbacks and the ScriptContext calls the same way.
+type Script interface {
+	// Frame is called every time the screen is drawn
+	Frame(ctx *ScriptContext)
+
+	// Instruction is called after every instruction, pc is its address
+	Instruction(ctx *ScriptContext, pc, opcode uint16)
+}
+
+// ScriptContext is what a script can see and change of its machine
+type ScriptContext struct {
+	cpu *chip8.CPU
+	hud []hudText
+}
+
+// Text a script asked to draw over the screen
+type hudText struct {
+	x, y int
+	text string
+}
+
+// Peek reads a byte of memory, addresses wrap around the end of memory
+func (ctx *ScriptContext) Peek(addr int) uint8 {
+	return ctx.cpu.Memory[addr%len(ctx.cpu.Memory)]
+}
+
+// Poke writes a byte of memory, addresses wrap around the end of memory
+func (ctx *ScriptContext) Poke(addr int, value uint8) {
+	ctx.cpu.Memory[addr%len(ctx.cpu.Memory)] = value
+}
+
+// Reg returns register Vx
+func (ctx *ScriptContext) Reg(x int) uint8 {
+	return ctx.cpu.V[x&0xF]
+}
+
+// SetReg sets register Vx
+func (ctx *ScriptContext) SetReg(x int, value uint8) {
+	ctx.cpu.V[x&0xF] = value
+}
+
+// I returns the index register
+func (ctx *ScriptContext) I() uint16 {
+	return ctx.cpu.I
+}
+
+// Pc returns the address of the next instruction
+func (ctx *ScriptContext) Pc() uint16 {
+	return ctx.cpu.Pc
+}
+
+// Print draws text over the screen until the next frame, at (x, y) in
+// CHIP-8 pixels from the top left corner of the screen.
+func (ctx *ScriptContext) Print(x, y int, text string) {
+	ctx.hud = append(ctx.hud, hudText{x, y, text})
+}
+
+// AddScript attaches a script to the machine
+func (inst *Instance) AddScript(script Script) {
+	if inst.script == nil {
+		inst.script = &ScriptContext{cpu: &inst.CPU}
+	}
+	inst.scripts = append(inst.scripts, script)
+	inst.hookScripts()
+}
+
+// hookScripts has the machine call the scripts after every instruction
+func (inst *Instance) hookScripts() {
+	if inst.script == nil {
+		return
+	}
+	inst.CPU.Hooks.AfterExecute = func(pc, opcode uint16) {
+		for _, s := range inst.scripts {
+			s.Instruction(inst.script, pc, opcode)
+		}
+	}
+}
+
+// runFrameScripts calls the scripts of the machine before its screen is drawn
+func (inst *Instance) runFrameScripts() {
+	if inst.script == nil {
+		return
+	}
+	inst.script.hud = inst.script.hud[:0]
+	for _, s := range inst.scripts {
+		s.Frame(inst.script)
+	}
+}
+
+// drawHUD draws the text the scripts printed over the screen drawn into rect
+func (inst *Instance) drawHUD(texts *TextCache, rect sdl.Rect) {
+	if inst.script == nil {
+		return
+	}
+	frame := cpuFrame(&inst.CPU)
+	for _, t := range inst.script.hud {
+		x := rect.X + int32(t.x)*rect.W/int32(frame.Width)
+		y := rect.Y + int32(t.y)*rect.H/int32(frame.Height)
+		if _, _, err := texts.Draw(t.text, white, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+}
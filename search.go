@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// MemorySearch narrows down the addresses holding a value the player can
+// watch change, like the score or the lives, by comparing memory between
+// two looks at it.
+type MemorySearch struct {
+	candidates []int
+	previous   []uint8
+}
+
+// Reset makes every address a candidate again
+func (m *MemorySearch) Reset(memory []uint8) {
+	m.candidates = m.candidates[:0]
+	for addr := range memory {
+		m.candidates = append(m.candidates, addr)
+	}
+	m.previous = append(m.previous[:0], memory...)
+}
+
+// Filter keeps the candidates whose current and previous values satisfy keep
+func (m *MemorySearch) Filter(memory []uint8, keep func(now, before uint8) bool) {
+	kept := m.candidates[:0]
+	for _, addr := range m.candidates {
+		if keep(memory[addr], m.previous[addr]) {
+			kept = append(kept, addr)
+		}
+	}
+	m.candidates = kept
+	m.previous = append(m.previous[:0], memory...)
+}
+
+// showMemorySearch shows the memory search of a machine. The search is kept
+// between visits, so the player can go back to the game, change the value
+// and look again.
+func showMemorySearch(renderer *sdl.Renderer, texts *TextCache, inst *Instance) {
+	// Lay out in menu coordinates whatever the window size
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	search := &inst.search
+	memory := inst.CPU.Memory
+	if search.previous == nil || len(search.previous) != len(memory) {
+		search.Reset(memory)
+	}
+
+	selected := 0
+	value := ""
+	status := ""
+	lineHeight := int32(fontSize) + 8
+
+	draw := func(text string, x, y int32) {
+		if _, _, err := texts.Draw(text, white, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	filter := func(name string, keep func(now, before uint8) bool) {
+		search.Filter(memory, keep)
+		selected = 0
+		status = tr("%s: %d addresses left", name, len(search.candidates))
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				key := t.Keysym.Sym
+				switch {
+				case key == sdl.K_ESCAPE || key == sdl.K_F7:
+					return
+				case key == sdl.K_UP:
+					if selected > 0 {
+						selected--
+					}
+				case key == sdl.K_DOWN:
+					if selected < len(search.candidates)-1 {
+						selected++
+					}
+				case key >= sdl.K_0 && key <= sdl.K_9 && len(value) < 3:
+					value += string(rune('0' + key - sdl.K_0))
+				case key == sdl.K_BACKSPACE && value != "":
+					value = value[:len(value)-1]
+				case key == sdl.K_RETURN && value != "":
+					n, err := strconv.Atoi(value)
+					if err != nil || n > 255 {
+						status = tr("%s is not a byte", value)
+					} else {
+						filter(tr("Equal to %d", n), func(now, before uint8) bool { return now == uint8(n) })
+					}
+					value = ""
+				case key == sdl.K_EQUALS && t.Keysym.Mod&sdl.KMOD_SHIFT != 0, key == sdl.K_KP_PLUS:
+					filter(tr("Increased"), func(now, before uint8) bool { return now > before })
+				case key == sdl.K_MINUS, key == sdl.K_KP_MINUS:
+					filter(tr("Decreased"), func(now, before uint8) bool { return now < before })
+				case key == sdl.K_EQUALS:
+					filter(tr("Unchanged"), func(now, before uint8) bool { return now == before })
+				case key == sdl.K_n:
+					search.Reset(memory)
+					selected = 0
+					status = tr("New search")
+				case key == sdl.K_f && selected < len(search.candidates):
+					// Freeze the address at its current value
+					addr := search.candidates[selected]
+					cheat := &Cheat{
+						Name:    fmt.Sprintf("Found at %03X", addr),
+						Kind:    cheatFreeze,
+						Addr:    addr,
+						Bytes:   []byte{memory[addr]},
+						Enabled: true,
+					}
+					inst.cheats.Add(&inst.CPU, cheat)
+					status = tr("Added cheat %s", cheat)
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		draw(tr("Memory search: %d addresses", len(search.candidates)), 32, 32)
+		if value != "" {
+			draw(tr("Equal to: %s", value), 32, 32+lineHeight)
+		} else if status != "" {
+			draw(status, 32, 32+lineHeight)
+		}
+
+		// Scroll so the selected address stays on screen
+		visible := int((winHeight - 32 - 6*lineHeight) / lineHeight)
+		first := 0
+		if selected >= visible {
+			first = selected - visible + 1
+		}
+		for i := first; i < len(search.candidates) && i < first+visible; i++ {
+			addr := search.candidates[i]
+			y := 32 + int32(i-first+3)*lineHeight
+			if i == selected {
+				renderer.SetDrawColor(64, 64, 64, 255)
+				renderer.FillRect(&sdl.Rect{X: 24, Y: y - 4, W: winWidth - 48, H: lineHeight})
+			}
+			draw(tr("%03X: %3d (last search %3d)", addr, memory[addr], search.previous[addr]), 32, y)
+		}
+
+		draw(tr("0-9 <Enter> equal to, + increased, - decreased, = unchanged"), 32, winHeight-2*lineHeight-16)
+		draw(tr("<N> new search, <F> freeze as cheat, <Escape> back to the game"), 32, winHeight-lineHeight-16)
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
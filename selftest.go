@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// How many instructions a self test program runs, they all reach the jump
+// to itself they end in well before
+const selfTestCycles = 100
+
+// The color of the self tests that failed
+var red = sdl.Color{R: 255, G: 64, B: 64, A: 255}
+
+// A selfTest is a small program loaded at 0x200 and what the machine must
+// look like once it ran, given the quirks picked
+type selfTest struct {
+	name    string
+	program []uint16
+	check   func(cpu *chip8.CPU, q chip8.Quirks) bool
+}
+
+// The self test, a program per instruction or quirk. Every program ends in
+// a jump to itself, appended when it is assembled.
+var selfTests = []selfTest{
+	{"6XNN 7XNN", []uint16{0x6005, 0x7003}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0] == 8
+	}},
+	{"7XNN leaves VF", []uint16{0x6F05, 0x60FF, 0x7002}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0] == 1 && cpu.V[0xF] == 5
+	}},
+	{"8XY4 carry", []uint16{0x60FF, 0x6102, 0x8014}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0] == 1 && cpu.V[0xF] == 1
+	}},
+	{"8XY5 borrow", []uint16{0x6001, 0x6102, 0x8015}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0] == 0xFF && cpu.V[0xF] == 0
+	}},
+	{"8XY7 borrow", []uint16{0x6005, 0x6103, 0x8017}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0] == 0xFE && cpu.V[0xF] == 0
+	}},
+	{"3XNN 4XNN 5XY0 9XY0", []uint16{0x6005, 0x3005, 0x6101, 0x4006, 0x6201, 0x6305, 0x5030, 0x6401, 0x9030, 0x6501}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[1] == 0 && cpu.V[2] == 0 && cpu.V[4] == 0 && cpu.V[5] == 1
+	}},
+	// CALL 208, then halt at 204; the subroutine sets V2
+	{"2NNN 00EE", []uint16{0x2208, 0x6101, 0x1204, 0x0000, 0x6201, 0x00EE}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[1] == 1 && cpu.V[2] == 1 && cpu.CallDepth() == 0
+	}},
+	// B206 lands on 20A with V0 and on 20E with V2
+	{"BNNN (Jump to XNN + VX)", []uint16{0x6004, 0x6208, 0xB206, 0x0000, 0x0000, 0x6A01, 0x120C, 0x6B01}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		if q.JumpVX {
+			return cpu.V[0xA] == 0 && cpu.V[0xB] == 1
+		}
+		return cpu.V[0xA] == 1 && cpu.V[0xB] == 0
+	}},
+	{"ANNN FX1E", []uint16{0xA300, 0x6005, 0xF01E}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.I == 0x305
+	}},
+	{"FX33 BCD", []uint16{0xA300, 0x60FE, 0xF033, 0xF265}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0] == 2 && cpu.V[1] == 5 && cpu.V[2] == 4
+	}},
+	{"FX55 (Increment I)", []uint16{0xA300, 0x6001, 0x6102, 0xF155}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		want := uint16(0x300)
+		if q.IncrementI {
+			want = 0x302
+		}
+		return cpu.Memory[0x300] == 1 && cpu.Memory[0x301] == 2 && cpu.I == want
+	}},
+	{"FX65 (Increment I)", []uint16{0xA300, 0x6007, 0xF055, 0x6000, 0xA300, 0xF065}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		want := uint16(0x300)
+		if q.IncrementI {
+			want = 0x301
+		}
+		return cpu.V[0] == 7 && cpu.I == want
+	}},
+	{"8XY6 (Shift VY)", []uint16{0x6001, 0x6104, 0x8016}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		if q.ShiftVY {
+			return cpu.V[0] == 2 && cpu.V[0xF] == 0
+		}
+		return cpu.V[0] == 0 && cpu.V[0xF] == 1
+	}},
+	{"8XYE (Shift VY)", []uint16{0x6081, 0x6101, 0x801E}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		if q.ShiftVY {
+			return cpu.V[0] == 2 && cpu.V[0xF] == 0
+		}
+		return cpu.V[0] == 2 && cpu.V[0xF] == 1
+	}},
+	{"8XY1 8XY2 8XY3 (Reset VF)", []uint16{0x6F05, 0x6001, 0x6102, 0x8011, 0x8212, 0x8313}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		vf := uint8(5)
+		if q.ResetVF {
+			vf = 0
+		}
+		return cpu.V[0] == 3 && cpu.V[0xF] == vf
+	}},
+	{"CXNN", []uint16{0xC00F, 0xC100}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0]&0xF0 == 0 && cpu.V[1] == 0
+	}},
+	{"FX15 FX07", []uint16{0x6030, 0xF015, 0xF107}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[1] == 0x30
+	}},
+	{"EX9E EXA1", []uint16{0x6005, 0xE09E, 0x6101, 0xE0A1, 0x6201}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[1] == 1 && cpu.V[2] == 0
+	}},
+	// The 0 of the font at 0,0
+	{"DXYN FX29", []uint16{0x6000, 0xF029, 0x6100, 0x6200, 0xD125}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0xF] == 0 && drewFont(cpu, 0, 0)
+	}},
+	// Drawing the same sprite twice erases it and collides, VF is kept in VA
+	{"DXYN collision", []uint16{0x6000, 0xF029, 0xD005, 0xD005, 0x8AF0}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return cpu.V[0xA] == 1 && blank(cpu)
+	}},
+	{"00E0", []uint16{0x6000, 0xF029, 0xD005, 0x00E0}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		return blank(cpu)
+	}},
+	// The 0 of the font at 62,0, its right half past the edge
+	{"DXYN (Wrap X)", []uint16{0x6000, 0xF029, 0x613E, 0x6200, 0xD125}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		wrapped := cpu.Framebuffer()[0] != 0
+		return wrapped == q.WrapX
+	}},
+	// The 0 of the font at 0,30, its last rows past the bottom
+	{"DXYN (Wrap Y)", []uint16{0x6000, 0xF029, 0x6100, 0x621E, 0xD125}, func(cpu *chip8.CPU, q chip8.Quirks) bool {
+		wrapped := cpu.Framebuffer()[0] != 0
+		return wrapped == q.WrapY
+	}},
+}
+
+// drewFont reports whether the 0 of the font is on the screen at x, y
+func drewFont(cpu *chip8.CPU, x, y int) bool {
+	frame := cpuFrame(cpu)
+	for row := 0; row < 5; row++ {
+		bits := cpu.Memory[chip8.FontAddress+row]
+		for col := 0; col < 8; col++ {
+			lit := frame.Pixels[(y+row)*frame.Width+x+col] != 0
+			if lit != (bits&(0x80>>col) != 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// blank reports whether every pixel of the screen is off
+func blank(cpu *chip8.CPU) bool {
+	for _, p := range cpu.Framebuffer() {
+		if p != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// selfTestResult is how one of the self tests went, err is nil if it passed
+type selfTestResult struct {
+	name string
+	err  error
+}
+
+// runSelfTest runs every self test on a machine set up like the ROMs are,
+// with the quirks picked
+func runSelfTest() []selfTestResult {
+	results := make([]selfTestResult, len(selfTests))
+	for i, test := range selfTests {
+		results[i] = selfTestResult{name: test.name, err: test.run(quirks)}
+	}
+	return results
+}
+
+// run assembles the program of the test, runs it and checks the machine
+func (test selfTest) run(q chip8.Quirks) error {
+	var clock chip8.ManualClock
+	cpu := chip8.CPU{Font: fontData, Quirks: q, Clock: &clock, OnInvalid: chip8.InvalidStop}
+	cpu.Init()
+
+	// End in a jump to itself
+	program := append(test.program, 0x1000|uint16(chip8.LoadAddress+2*len(test.program)))
+	data := make([]byte, 0, 2*len(program))
+	for _, op := range program {
+		data = append(data, byte(op>>8), byte(op))
+	}
+	if err := cpu.LoadRomData(data); err != nil {
+		return err
+	}
+
+	for i := 0; i < selfTestCycles; i++ {
+		if err := cpu.EmulateCycle(); err != nil {
+			return err
+		}
+	}
+	if !test.check(&cpu, q) {
+		return fmt.Errorf("wrong result")
+	}
+	return nil
+}
+
+// showSelfTest runs the self test and lists how every part of it went
+func showSelfTest(renderer *sdl.Renderer, texts *TextCache) {
+	// Lay out in menu coordinates whatever the window size
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	results := runSelfTest()
+	passed := 0
+	for _, r := range results {
+		if r.err == nil {
+			passed++
+		} else {
+			slog.Warn("Self test failed", "test", r.name, "quirks", quirksLabel(), "err", r.err)
+		}
+	}
+
+	lineHeight := int32(fontSize) + 4
+	rows := (len(results) + 1) / 2
+	draw := func(text string, color sdl.Color, x, y int32) {
+		if _, _, err := texts.Draw(text, color, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return
+			case *sdl.KeyboardEvent:
+				if t.Type == sdl.KEYDOWN && (t.Keysym.Sym == sdl.K_ESCAPE || t.Keysym.Sym == sdl.K_RETURN) {
+					return
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		draw(tr("Self test with the %s quirks: %d of %d passed", quirksLabel(), passed, len(results)), yellow, 32, 32)
+		for i, r := range results {
+			x, y := 32+int32(i/rows)*(winWidth/2-16), 32+int32(2+i%rows)*lineHeight
+			status, color := tr("ok"), white
+			if r.err != nil {
+				status, color = tr("FAIL"), red
+			}
+			draw(status, color, x, y)
+			draw(r.name, color, x+64, y)
+		}
+		draw(tr("<Enter> or <Escape> to go back"), white, 32, winHeight-lineHeight-8)
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
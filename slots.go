@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/petersid2022/chip8/cmd"
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Number of save-state slots kept for every ROM
+const numSlots = 10
+
+type SaveSlot struct {
+	Used  bool
+	Saved time.Time
+	State chip8.State
+}
+
+// romHash identifies a ROM by its contents, so save states survive renaming the file
+func romHash(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// stateDir returns the directory holding the save states of a ROM
+func stateDir(hash string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chip8", "states", hash), nil
+}
+
+func slotPath(hash string, slot int) (string, error) {
+	dir, err := stateDir(hash)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("slot%d.state", slot)), nil
+}
+
+func writeSlot(hash string, slot int, state chip8.State) error {
+	path, err := slotPath(hash, slot)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, state)
+}
+
+func autosavePath(hash string) (string, error) {
+	dir, err := stateDir(hash)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "autosave.state"), nil
+}
+
+// writeAutosave stores the state the ROM was quit in, so it can be resumed on the next launch
+func writeAutosave(hash string, state chip8.State) error {
+	path, err := autosavePath(hash)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(path, state)
+}
+
+// readAutosave returns the state the ROM was last quit in, if there is one
+func readAutosave(hash string) (SaveSlot, bool) {
+	path, err := autosavePath(hash)
+	if err != nil {
+		return SaveSlot{}, false
+	}
+	slot, err := readStateFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Failed to read autosave", "err", err)
+		}
+		return SaveSlot{}, false
+	}
+	return slot, true
+}
+
+func rplPath(hash string) (string, error) {
+	dir, err := stateDir(hash)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "rpl.flags"), nil
+}
+
+// readRPL returns the RPL user flags a ROM stored with FX75 in earlier sessions
+func readRPL(hash string) ([8]uint8, error) {
+	var flags [8]uint8
+	path, err := rplPath(hash)
+	if err != nil {
+		return flags, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return flags, nil
+		}
+		return flags, err
+	}
+	copy(flags[:], data)
+	return flags, nil
+}
+
+func writeRPL(hash string, flags [8]uint8) error {
+	path, err := rplPath(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, flags[:], 0644)
+}
+
+func writeStateFile(path string, state chip8.State) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := chip8.WriteState(f, state); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func readStateFile(path string) (SaveSlot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return SaveSlot{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return SaveSlot{}, err
+	}
+	state, err := chip8.ReadState(f)
+	if err != nil {
+		return SaveSlot{}, err
+	}
+	return SaveSlot{Used: true, Saved: info.ModTime(), State: state}, nil
+}
+
+// readSlots loads every slot of a ROM, missing or unreadable slots are left empty
+func readSlots(hash string) [numSlots]SaveSlot {
+	var slots [numSlots]SaveSlot
+	for i := range slots {
+		path, err := slotPath(hash, i)
+		if err != nil {
+			continue
+		}
+		slot, err := readStateFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				slog.Error("Failed to read save slot", "slot", i, "err", err)
+			}
+			continue
+		}
+		slots[i] = slot
+	}
+	return slots
+}
+
+// drawDisplay draws a CHIP-8 screen scaled to fit into rect
+func drawDisplay(renderer *sdl.Renderer, frame Frame, rect sdl.Rect) {
+	renderer.SetDrawColor(palette.Off.R, palette.Off.G, palette.Off.B, 255)
+	renderer.FillRect(&rect)
+
+	// Pixel edges are computed separately so the screen fills rect exactly
+	// even when its size isn't a multiple of the resolution
+	w, h := int32(frame.Width), int32(frame.Height)
+	renderer.SetDrawColor(palette.On.R, palette.On.G, palette.On.B, 255)
+	for i := int32(0); i < h; i++ {
+		for j := int32(0); j < w; j++ {
+			if frame.Pixels[i*w+j] == 1 {
+				x0, x1 := rect.X+j*rect.W/w, rect.X+(j+1)*rect.W/w
+				y0, y1 := rect.Y+i*rect.H/h, rect.Y+(i+1)*rect.H/h
+				renderer.FillRect(&sdl.Rect{X: x0, Y: y0, W: x1 - x0, H: y1 - y0})
+			}
+		}
+	}
+}
+
+// showSlotPicker shows the save slots with a thumbnail of their screen and
+// returns the chosen slot, or -1 if the picker was dismissed.
+func showSlotPicker(renderer *sdl.Renderer, texts *TextCache, title string, slots [numSlots]SaveSlot) int {
+	// Lay out in menu coordinates whatever the window size
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	const slotsPerRow = 5
+	const thumbWidth, thumbHeight = 64 * 2, 32 * 2
+
+	cellWidth := winWidth / slotsPerRow
+	cellHeight := thumbHeight + 2*int32(fontSize) + 32
+	selected := 0
+
+	thumbBounds := func(i int) sdl.Rect {
+		column, row := int32(i%slotsPerRow), int32(i/slotsPerRow)
+		return sdl.Rect{
+			X: column*cellWidth + (cellWidth-thumbWidth)/2,
+			Y: 128 + row*cellHeight,
+			W: thumbWidth,
+			H: thumbHeight,
+		}
+	}
+
+	// centered draws text horizontally centered around x
+	centered := func(text string, x, y int32) {
+		w, _, err := texts.Size(text)
+		if err != nil {
+			slog.Error("Failed to render text", "err", err)
+			return
+		}
+		if _, _, err := texts.Draw(text, white, x-w/2, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return -1
+			case *sdl.MouseButtonEvent:
+				if t.Type == sdl.MOUSEBUTTONDOWN {
+					for i := range slots {
+						b := thumbBounds(i)
+						if t.X >= b.X && t.X < b.X+b.W && t.Y >= b.Y && t.Y < b.Y+b.H {
+							return i
+						}
+					}
+				}
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				switch t.Keysym.Sym {
+				case sdl.K_ESCAPE:
+					return -1
+				case sdl.K_RETURN:
+					return selected
+				case sdl.K_LEFT:
+					if selected > 0 {
+						selected--
+					}
+				case sdl.K_RIGHT:
+					if selected < numSlots-1 {
+						selected++
+					}
+				case sdl.K_UP:
+					if selected >= slotsPerRow {
+						selected -= slotsPerRow
+					}
+				case sdl.K_DOWN:
+					if selected+slotsPerRow < numSlots {
+						selected += slotsPerRow
+					}
+				default:
+					// Number keys pick the slot directly
+					if t.Keysym.Sym >= sdl.K_0 && t.Keysym.Sym <= sdl.K_9 {
+						return int(t.Keysym.Sym - sdl.K_0)
+					}
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		centered(title, winWidth/2, 32)
+		centered(tr("Arrows/0-9 to choose, <Enter> to confirm, <Escape> to cancel"), winWidth/2, winHeight-int32(fontSize)-16)
+
+		for i, slot := range slots {
+			b := thumbBounds(i)
+
+			// Frame the selected slot
+			if i == selected {
+				renderer.SetDrawColor(255, 255, 255, 255)
+				renderer.FillRect(&sdl.Rect{X: b.X - 4, Y: b.Y - 4, W: b.W + 8, H: b.H + 8})
+			}
+
+			label := tr("Empty")
+			if slot.Used {
+				drawDisplay(renderer, stateFrame(&slot.State), b)
+				label = slot.Saved.Format("01-02 15:04")
+			} else {
+				renderer.SetDrawColor(0, 0, 0, 255)
+				renderer.FillRect(&b)
+				renderer.SetDrawColor(96, 96, 96, 255)
+				renderer.DrawRect(&b)
+			}
+
+			centered(tr("Slot %d", i), b.X+b.W/2, b.Y+b.H+8)
+			centered(label, b.X+b.W/2, b.Y+b.H+8+int32(fontSize))
+		}
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
+
+// askResume offers to continue from an autosave, showing the screen it was left on
+func askResume(renderer *sdl.Renderer, texts *TextCache, autosave SaveSlot) bool {
+	// Lay out in menu coordinates whatever the window size
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	const thumbWidth, thumbHeight = 64 * 6, 32 * 6
+
+	lines := []string{
+		tr("Resume where you left off?"),
+		tr("Saved %s", autosave.Saved.Format("2006-01-02 15:04")),
+		tr("<Y>/<Enter> to resume, <N>/<Escape> to start over"),
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return false
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				switch t.Keysym.Sym {
+				case sdl.K_y, sdl.K_RETURN:
+					return true
+				case sdl.K_n, sdl.K_ESCAPE:
+					return false
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		thumb := sdl.Rect{X: (winWidth - thumbWidth) / 2, Y: 64, W: thumbWidth, H: thumbHeight}
+		renderer.SetDrawColor(255, 255, 255, 255)
+		renderer.FillRect(&sdl.Rect{X: thumb.X - 4, Y: thumb.Y - 4, W: thumb.W + 8, H: thumb.H + 8})
+		drawDisplay(renderer, stateFrame(&autosave.State), thumb)
+
+		y := thumb.Y + thumb.H + 32
+		for _, line := range lines {
+			w, _, err := texts.Size(line)
+			if err != nil {
+				slog.Error("Failed to render text", "err", err)
+				continue
+			}
+			if _, _, err := texts.Draw(line, white, (winWidth-w)/2, y); err != nil {
+				slog.Error("Failed to render text", "err", err)
+			}
+			y += int32(fontSize) + 12
+		}
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
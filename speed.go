@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// Instructions per frame of a ROM switched to frame timing with <PageUp> or
+// <PageDown> while -ipf is off, and the most a ROM can ask for
+const (
+	defaultIPF = 15
+	maxIPF     = 1000
+)
+
+// SpeedPreset is a speed the ROMs of a machine of old ran at, in
+// instructions per frame
+type SpeedPreset struct {
+	Name string
+	IPF  int
+}
+
+// The speed presets, slowest first. The COSMAC VIP ran about 540
+// instructions a second, the HP-48 calculators SCHIP games were written for
+// a few times that, and the modern preset runs as fast as the frontend lets
+// a ROM go.
+var speedPresets = []SpeedPreset{
+	{"COSMAC VIP", 9},
+	{"HP-48 SCHIP", 30},
+	{"Modern, uncapped", maxIPF},
+}
+
+// How many bursts a frame is split in, the keyboard is read before each one
+// so programs waiting with FX0A see a key within a fraction of a frame.
+const inputBursts = 4
+
+func speedPath(hash string) (string, error) {
+	dir, err := stateDir(hash)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ipf.txt"), nil
+}
+
+// readSpeed returns the instructions per frame set for a ROM, 0 if there are none
+func readSpeed(hash string) (int, error) {
+	path, err := speedPath(hash)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	ipf, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || ipf < 0 || ipf > maxIPF {
+		return 0, fmt.Errorf("%s: invalid instructions per frame %q", path, strings.TrimSpace(string(data)))
+	}
+	return ipf, nil
+}
+
+func writeSpeed(hash string, ipf int) error {
+	path, err := speedPath(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(ipf)+"\n"), 0644)
+}
+
+// framed reports whether the machine runs instructions in frames, rather
+// than one per turn of the loop paced by the delay of the menu. Machines of
+// -deterministic runs always are, so their timers count frames rather than
+// the time that passed, and so are netplay ones, which trade keys per frame.
+func (inst *Instance) framed() bool {
+	return inst.ipf > 0 || frameIPF > 0 || deterministic || inst.Net != nil
+}
+
+// perFrame returns how many instructions the machine runs every frame
+func (inst *Instance) perFrame() int {
+	switch {
+	case inst.ipf > 0:
+		return inst.ipf
+	case frameIPF > 0:
+		return frameIPF
+	}
+	return defaultIPF
+}
+
+// changeSpeed adds to the instructions per frame of the ROM and keeps the
+// new number for the next time it is played
+func (inst *Instance) changeSpeed(delta int) {
+	inst.ipf = min(max(inst.perFrame()+delta, 1), maxIPF)
+	if err := writeSpeed(inst.Hash, inst.ipf); err != nil {
+		slog.Error("Failed to save instructions per frame", "rom", inst.Name, "err", err)
+	}
+	notify("Speed: %d instructions per frame", inst.ipf)
+}
+
+// setSpeed runs the ROM at a preset and keeps it for the next time it is played
+func (inst *Instance) setSpeed(preset SpeedPreset) {
+	inst.ipf = preset.IPF
+	if err := writeSpeed(inst.Hash, inst.ipf); err != nil {
+		slog.Error("Failed to save instructions per frame", "rom", inst.Name, "err", err)
+	}
+	notify("Speed: %s", tr(preset.Name))
+}
+
+// showSpeedPresets lets the player run the ROM at the speed of a machine of
+// old, rather than at a number of instructions
+func showSpeedPresets(renderer *sdl.Renderer, texts *TextCache, inst *Instance) {
+	// Lay out in menu coordinates whatever the window size
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	lineHeight := int32(fontSize) + 8
+	selected := 0
+	for i, preset := range speedPresets {
+		if preset.IPF <= inst.perFrame() {
+			selected = i
+		}
+	}
+
+	draw := func(text string, color sdl.Color, x, y int32) {
+		if _, _, err := texts.Draw(text, color, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				switch t.Keysym.Sym {
+				case sdl.K_ESCAPE:
+					return
+				case sdl.K_UP:
+					if selected > 0 {
+						selected--
+					}
+				case sdl.K_DOWN:
+					if selected < len(speedPresets)-1 {
+						selected++
+					}
+				case sdl.K_RETURN, sdl.K_KP_ENTER:
+					inst.setSpeed(speedPresets[selected])
+					return
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		draw(tr("Speed"), yellow, 32, 32)
+		draw(tr("Now %d instructions per frame, %d a second", inst.perFrame(), inst.perFrame()*60), white, 32, 32+lineHeight)
+		y := 32 + 3*lineHeight
+		for i, preset := range speedPresets {
+			if i == selected {
+				renderer.SetDrawColor(64, 64, 64, 255)
+				renderer.FillRect(&sdl.Rect{X: 24, Y: y - 4, W: winWidth - 48, H: lineHeight})
+			}
+			draw(tr(preset.Name), white, 32, y)
+			draw(tr("%d a second", preset.IPF*60), white, winWidth/2+64, y)
+			y += lineHeight
+		}
+		draw(tr("<Up>/<Down> to choose, <Enter> to confirm, <Escape> to cancel"), white, 32, winHeight-lineHeight-8)
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
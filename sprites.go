@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// How many instructions after an ANNN a DXYN still counts as drawing from it
+const spriteReach = 8
+
+// SpriteRef is a run of bytes the program seems to draw as a sprite, 8 pixels
+// wide and one row per byte
+type SpriteRef struct {
+	Addr   int
+	Height int
+}
+
+// findSprites looks through memory for ANNN instructions followed closely by
+// a DXYN, which most likely draws the sprite at NNN. N being the height,
+// sprites are 1 to 15 bytes long, the 16x16 sprites of DXY0 are left out.
+// The tallest height drawn from an address wins.
+func findSprites(memory []uint8) []SpriteRef {
+	heights := map[int]int{}
+	for i := 0; i+1 < len(memory); i += 2 {
+		opcode := uint16(memory[i])<<8 | uint16(memory[i+1])
+		if opcode&0xF000 != 0xA000 {
+			continue
+		}
+		addr := int(opcode & 0x0FFF)
+		for j := i + 2; j+1 < len(memory) && j <= i+2*spriteReach; j += 2 {
+			next := uint16(memory[j])<<8 | uint16(memory[j+1])
+			if next&0xF000 == 0xA000 {
+				break
+			}
+			if n := int(next & 0x000F); next&0xF000 == 0xD000 && n != 0 {
+				if addr+n <= len(memory) {
+					heights[addr] = max(heights[addr], n)
+				}
+				break
+			}
+		}
+	}
+
+	sprites := make([]SpriteRef, 0, len(heights))
+	for addr, height := range heights {
+		sprites = append(sprites, SpriteRef{Addr: addr, Height: height})
+	}
+	sort.Slice(sprites, func(i, j int) bool { return sprites[i].Addr < sprites[j].Addr })
+	return sprites
+}
+
+// The size of a sprite cell of the browser, in menu coordinates, and of its pixels
+const (
+	spriteCellWidth  = 96
+	spriteCellHeight = 112
+	spritePixel      = 4
+)
+
+// showSprites shows the sprites found in the memory of a machine, with their
+// addresses. <Enter> or a click on one adds a watch on its first byte to the
+// debugger.
+func showSprites(renderer *sdl.Renderer, texts *TextCache, inst *Instance) {
+	// Lay out in menu coordinates whatever the window size
+	renderer.SetLogicalSize(winWidth, winHeight)
+
+	memory := inst.CPU.Memory
+	sprites := findSprites(memory)
+	lineHeight := int32(fontSize) + 8
+	columns := int((winWidth - 64) / spriteCellWidth)
+	rows := int((winHeight - 32 - 5*lineHeight) / spriteCellHeight)
+	top := 32 + 2*lineHeight
+	selected, first := 0, 0
+	status := ""
+
+	draw := func(text string, color sdl.Color, x, y int32) {
+		if _, _, err := texts.Draw(text, color, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	watch := func(sprite SpriteRef) {
+		text := fmt.Sprintf("M[0x%03X]", sprite.Addr)
+		if err := inst.debug.addWatch(text); err != nil {
+			status = err.Error()
+			return
+		}
+		status = tr("Added watch %s", text)
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return
+			case *sdl.MouseButtonEvent:
+				if t.Type != sdl.MOUSEBUTTONDOWN || t.Button != sdl.BUTTON_LEFT || t.X < 32 || t.Y < top {
+					break
+				}
+				column, row := int((t.X-32)/spriteCellWidth), int((t.Y-top)/spriteCellHeight)
+				if i := first + row*columns + column; column < columns && row < rows && i < len(sprites) {
+					selected = i
+					watch(sprites[i])
+				}
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				switch t.Keysym.Sym {
+				case sdl.K_ESCAPE, sdl.K_F7:
+					return
+				case sdl.K_LEFT:
+					selected = max(selected-1, 0)
+				case sdl.K_RIGHT:
+					if selected < len(sprites)-1 {
+						selected++
+					}
+				case sdl.K_UP:
+					selected = max(selected-columns, 0)
+				case sdl.K_DOWN:
+					if selected+columns < len(sprites) {
+						selected += columns
+					}
+				case sdl.K_RETURN, sdl.K_KP_ENTER:
+					if selected < len(sprites) {
+						watch(sprites[selected])
+					}
+				}
+			}
+		}
+
+		// Scroll by rows so the selected sprite stays on screen
+		if selected < first {
+			first = selected / columns * columns
+		} else if selected >= first+rows*columns {
+			first = (selected/columns - rows + 1) * columns
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		draw(tr("Sprites: %d found", len(sprites)), yellow, 32, 32)
+		if status != "" {
+			draw(status, white, 32, 32+lineHeight)
+		}
+		for i := first; i < len(sprites) && i < first+rows*columns; i++ {
+			sprite := sprites[i]
+			x := 32 + int32((i-first)%columns)*spriteCellWidth
+			y := top + int32((i-first)/columns)*spriteCellHeight
+			if i == selected {
+				renderer.SetDrawColor(64, 64, 64, 255)
+				renderer.FillRect(&sdl.Rect{X: x, Y: y, W: spriteCellWidth - 8, H: spriteCellHeight - 8})
+			}
+
+			renderer.SetDrawColor(palette.On.R, palette.On.G, palette.On.B, 255)
+			for row := 0; row < sprite.Height; row++ {
+				bits := memory[sprite.Addr+row]
+				for col := 0; col < 8; col++ {
+					if bits&(0x80>>col) != 0 {
+						renderer.FillRect(&sdl.Rect{X: x + 8 + int32(col)*spritePixel, Y: y + 4 + int32(row)*spritePixel, W: spritePixel, H: spritePixel})
+					}
+				}
+			}
+			draw(fmt.Sprintf("%03X x%d", sprite.Addr, sprite.Height), white, x+4, y+8+15*spritePixel)
+		}
+
+		draw(tr("Arrows choose, <Enter> or a click adds a watch, <Escape> back"), white, 32, winHeight-lineHeight-16)
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}
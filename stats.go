@@ -0,0 +1,45 @@
+package main
+
+import (
+	"expvar"
+	"time"
+)
+
+// Counters of the emulation loop, served as expvar variables by the control
+// API at /debug/vars: the instructions run, the frames shown and the times a
+// program drew on the screen, in total and over the last second.
+var (
+	statInstructions = expvar.NewInt("instructions")
+	statFrames       = expvar.NewInt("frames")
+	statDraws        = expvar.NewInt("draws")
+	statRates        = expvar.NewMap("per_second")
+)
+
+// loopStats works out the rates of the counters once a second
+type loopStats struct {
+	since                       time.Time
+	instructions, frames, draws int64
+}
+
+func (l *loopStats) update() {
+	now := time.Now()
+	if l.since.IsZero() {
+		l.since = now
+	}
+	elapsed := now.Sub(l.since).Seconds()
+	if elapsed < 1 {
+		return
+	}
+
+	rate := func(name string, counter *expvar.Int, last *int64) {
+		value := counter.Value()
+		f := new(expvar.Float)
+		f.Set(float64(value-*last) / elapsed)
+		statRates.Set(name, f)
+		*last = value
+	}
+	rate("instructions", statInstructions, &l.instructions)
+	rate("frames", statFrames, &l.frames)
+	rate("draws", statDraws, &l.draws)
+	l.since = now
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/petersid2022/chip8/cmd"
+)
+
+// Instructions run per frame by the test suite, timers tick once per frame
+const suiteFrameCycles = 16
+
+// SuiteResult is how a ROM fared in the test suite
+type SuiteResult struct {
+	Rom    string
+	Hash   string `json:",omitempty"`
+	Status string // ok, unknown opcodes, crashed or not loaded
+	Frames int    // frames run before it crashed, or all of them
+	Error  string `json:",omitempty"`
+
+	// Unknown opcodes it ran into, in hex, and whether it drew anything
+	Unknown []string `json:",omitempty"`
+	Drew    bool
+}
+
+// runTestSuite runs every ROM of a directory headlessly and writes a compatibility report
+func runTestSuite(args []string) error {
+	flags := flag.NewFlagSet("test-suite", flag.ContinueOnError)
+	frames := flags.Int("frames", 600, "frames to run every ROM for")
+	format := flags.String("format", "markdown", "report format: markdown or json")
+	output := flags.String("o", "", "write the report to this file instead of stdout")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "ROMs to run at the same time")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: chip8 test-suite [options] <dir>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("want one ROM directory")
+	}
+	if *frames <= 0 {
+		return fmt.Errorf("invalid number of frames %d", *frames)
+	}
+	if *jobs <= 0 {
+		return fmt.Errorf("invalid number of jobs %d", *jobs)
+	}
+	if *format != "markdown" && *format != "json" {
+		return fmt.Errorf("invalid format %q, want markdown or json", *format)
+	}
+
+	dir := flags.Arg(0)
+	entries, err := listRoms(os.DirFS(dir), ".")
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	results := suiteRunAll(paths, *frames, *jobs)
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	return writeSuiteMarkdown(w, results)
+}
+
+// headless is a machine run without a window by the test commands, with no
+// keys pressed and the random numbers of -deterministic, so every run of a
+// ROM comes out the same. Unknown opcodes are noted and skipped.
+type headless struct {
+	cpu     chip8.CPU
+	clock   chip8.ManualClock
+	unknown map[uint16]bool
+}
+
+// newHeadless loads a ROM into a machine set up by the command line options
+func newHeadless(data []byte) (*headless, error) {
+	h := &headless{unknown: map[uint16]bool{}}
+	h.cpu = chip8.CPU{
+		MemorySize: memorySize,
+		Strict:     strictMemory,
+		LoadAt:     loadAddress,
+		Hires:      machine == "hires",
+		Font:       fontData,
+		OnInvalid:  chip8.InvalidStop,
+		Clock:      &h.clock,
+		Rand:       rand.New(rand.NewSource(deterministicSeed)),
+		Quirks:     quirks,
+	}
+	h.cpu.Init()
+	if err := h.cpu.LoadRomData(data); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// run emulates frames of suiteFrameCycles instructions and returns how many
+// it completed. It stops early on any error but an unknown opcode, a panic
+// is returned as an error too.
+func (h *headless) run(frames int) (n int, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	for ; n < frames; n++ {
+		for i := 0; i < suiteFrameCycles; i++ {
+			err := h.cpu.EmulateCycle()
+			var opcodeErr *chip8.OpcodeError
+			if errors.As(err, &opcodeErr) {
+				h.unknown[opcodeErr.Opcode] = true
+				h.cpu.Pc += 2
+				continue
+			}
+			if err != nil {
+				return n, err
+			}
+		}
+		h.clock.Advance(1)
+	}
+	return n, nil
+}
+
+// suiteRun runs a ROM for the test suite
+func suiteRun(path string, frames int) SuiteResult {
+	result := SuiteResult{Rom: filepath.Base(path), Status: "ok"}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		result.Status, result.Error = "not loaded", err.Error()
+		return result
+	}
+	result.Hash = romHash(data)
+	h, err := newHeadless(data)
+	if err != nil {
+		result.Status, result.Error = "not loaded", err.Error()
+		return result
+	}
+
+	if result.Frames, err = h.run(frames); err != nil {
+		result.Status, result.Error = "crashed", err.Error()
+	}
+	for opcode := range h.unknown {
+		result.Unknown = append(result.Unknown, fmt.Sprintf("%04X", opcode))
+	}
+	sort.Strings(result.Unknown)
+	if result.Status == "ok" && len(h.unknown) > 0 {
+		result.Status = "unknown opcodes"
+	}
+	for _, pixel := range h.cpu.Framebuffer() {
+		result.Drew = result.Drew || pixel != 0
+	}
+	return result
+}
+
+// suiteRunAll runs the ROMs for the test suite, jobs of them at a time on
+// machines of their own, and returns the results in the order of paths
+func suiteRunAll(paths []string, frames, jobs int) []SuiteResult {
+	results := make([]SuiteResult, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < min(jobs, len(paths)); j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = suiteRun(paths[i], frames)
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+func writeSuiteMarkdown(w io.Writer, results []SuiteResult) error {
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(w, "# Compatibility report\n\n")
+	fmt.Fprintf(w, "%d ROMs: %d ok, %d with unknown opcodes, %d crashed, %d not loaded\n\n",
+		len(results), counts["ok"], counts["unknown opcodes"], counts["crashed"], counts["not loaded"])
+	fmt.Fprintf(w, "| ROM | Status | Frames | Drew | Unknown opcodes | Error |\n")
+	fmt.Fprintf(w, "| --- | --- | --- | --- | --- | --- |\n")
+	for _, r := range results {
+		drew := "no"
+		if r.Drew {
+			drew = "yes"
+		}
+		_, err := fmt.Fprintf(w, "| %s | %s | %d | %s | %s | %s |\n", r.Rom, r.Status, r.Frames, drew,
+			strings.Join(r.Unknown, " "), strings.ReplaceAll(r.Error, "|", "\\|"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	sdl "github.com/veandco/go-sdl2/sdl"
+	"github.com/veandco/go-sdl2/ttf"
+)
+
+var white = sdl.Color{R: 255, G: 255, B: 255, A: 255}
+
+type textKey struct {
+	text  string
+	color sdl.Color
+}
+
+type cachedText struct {
+	texture *sdl.Texture
+	w, h    int32
+	used    bool
+}
+
+// TextCache keeps the textures of rendered strings between frames, so text is
+// only rendered again when it changes.
+type TextCache struct {
+	renderer *sdl.Renderer
+	font     *ttf.Font
+	textures map[textKey]*cachedText
+}
+
+func NewTextCache(renderer *sdl.Renderer, font *ttf.Font) *TextCache {
+	return &TextCache{renderer: renderer, font: font, textures: map[textKey]*cachedText{}}
+}
+
+// Texture returns the texture of text rendered in color, along with its size.
+// The texture belongs to the cache and must not be destroyed.
+func (c *TextCache) Texture(text string, color sdl.Color) (*sdl.Texture, int32, int32, error) {
+	key := textKey{text, color}
+	if cached, ok := c.textures[key]; ok {
+		cached.used = true
+		return cached.texture, cached.w, cached.h, nil
+	}
+
+	surface, err := c.font.RenderUTF8Solid(text, color)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer surface.Free()
+
+	texture, err := c.renderer.CreateTextureFromSurface(surface)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	c.textures[key] = &cachedText{texture: texture, w: surface.W, h: surface.H, used: true}
+	return texture, surface.W, surface.H, nil
+}
+
+// Draw renders text with its top left corner at (x, y) and returns its size
+func (c *TextCache) Draw(text string, color sdl.Color, x, y int32) (int32, int32, error) {
+	texture, w, h, err := c.Texture(text, color)
+	if err != nil {
+		return 0, 0, err
+	}
+	c.renderer.Copy(texture, nil, &sdl.Rect{X: x, Y: y, W: w, H: h})
+	return w, h, nil
+}
+
+// Size returns the size text is drawn at
+func (c *TextCache) Size(text string) (int32, int32, error) {
+	_, w, h, err := c.Texture(text, white)
+	return w, h, err
+}
+
+// Sweep destroys the textures that weren't used since the last sweep, call
+// it once per frame so strings that changed don't pile up.
+func (c *TextCache) Sweep() {
+	for key, cached := range c.textures {
+		if !cached.used {
+			cached.texture.Destroy()
+			delete(c.textures, key)
+			continue
+		}
+		cached.used = false
+	}
+}
+
+// Destroy frees every texture in the cache
+func (c *TextCache) Destroy() {
+	for key, cached := range c.textures {
+		cached.texture.Destroy()
+		delete(c.textures, key)
+	}
+}
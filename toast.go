@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// How long a toast is shown and how long of that it fades out for, in
+// milliseconds, and how many are shown at once
+const (
+	toastDuration = 2500
+	toastFade     = 500
+	maxToasts     = 3
+)
+
+// A toast is a short message shown over the game, like "Saved to slot 3"
+type toast struct {
+	text  string
+	shown uint32
+}
+
+var (
+	toastsMu sync.Mutex
+	toasts   []toast
+)
+
+// notify shows a toast in the language of the interface and logs it. It can
+// be called from any goroutine.
+func notify(text string, args ...any) {
+	text = tr(text, args...)
+	slog.Info(text)
+
+	toastsMu.Lock()
+	defer toastsMu.Unlock()
+	toasts = append(toasts, toast{text: text, shown: sdl.GetTicks()})
+	if len(toasts) > maxToasts {
+		toasts = toasts[len(toasts)-maxToasts:]
+	}
+}
+
+// drawToasts draws the toasts at the top of rect, newest last, and reports
+// whether there were any, for the screen to be drawn again as they fade
+func drawToasts(renderer *sdl.Renderer, texts *TextCache, rect sdl.Rect) bool {
+	toastsMu.Lock()
+	defer toastsMu.Unlock()
+
+	now := sdl.GetTicks()
+	kept := toasts[:0]
+	for _, t := range toasts {
+		if now-t.shown < toastDuration {
+			kept = append(kept, t)
+		}
+	}
+	toasts = kept
+
+	lineHeight := int32(fontSize) + 8
+	y := rect.Y + 8
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	for _, t := range toasts {
+		alpha := uint8(255)
+		if left := toastDuration - (now - t.shown); left < toastFade {
+			alpha = uint8(255 * left / toastFade)
+		}
+		texture, w, h, err := texts.Texture(t.text, white)
+		if err != nil {
+			slog.Error("Failed to render text", "err", err)
+			continue
+		}
+		x := rect.X + (rect.W-w)/2
+		renderer.SetDrawColor(0, 0, 0, uint8(int(alpha)*3/4))
+		renderer.FillRect(&sdl.Rect{X: x - 8, Y: y, W: w + 16, H: h + 8})
+		texture.SetAlphaMod(alpha)
+		renderer.Copy(texture, nil, &sdl.Rect{X: x, Y: y + 4, W: w, H: h})
+		texture.SetAlphaMod(255)
+		y += lineHeight + 4
+	}
+	renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+	return len(toasts) > 0
+}
+
+// onOff returns the toast telling a setting was switched on or off
+func onOff(setting string, on bool) string {
+	if on {
+		return tr("%s on", tr(setting))
+	}
+	return tr("%s off", tr(setting))
+}
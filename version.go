@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// The release and the commit the binary was built from, set by the Makefile
+// with -ldflags "-X main.version=... -X main.commit=...". Builds without
+// them fall back on what the Go toolchain recorded.
+var (
+	version string
+	commit  string
+)
+
+// How long the menu shows the version when the emulator starts, in milliseconds
+const versionShown = 5000
+
+// buildVersion describes the build, like "v1.2 (3be002c) go1.21.0 linux/amd64"
+func buildVersion() string {
+	return fmt.Sprintf("%s %s %s/%s", releaseVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// releaseVersion returns the release and the commit of the build, like "v1.2 (3be002c)"
+func releaseVersion() string {
+	v, c, dirty := version, commit, false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && c == "":
+				c = s.Value
+			case s.Key == "vcs.modified" && commit == "":
+				dirty = s.Value == "true"
+			}
+		}
+	}
+	if v == "" {
+		v = "dev"
+	}
+	if len(c) > 7 {
+		c = c[:7]
+	}
+	if dirty {
+		c += "-dirty"
+	}
+	if c != "" {
+		v += " (" + c + ")"
+	}
+	return v
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/petersid2022/chip8/cmd"
+)
+
+// Watch is an expression the debugger shows the value of, like V[3],
+// Memory[0x300] or I+2. Expressions add and subtract numbers, registers
+// (V0-VF or V[x], I, PC, SP, DT, ST) and bytes of memory (Memory[addr] or M[addr]).
+type Watch struct {
+	Text string
+	expr watchExpr
+
+	// The value in the previous frame, to highlight changes
+	value, previous int
+	changed         bool
+	evaluated       bool
+}
+
+type watchExpr func(cpu *chip8.CPU) int
+
+// parseWatch compiles a watch expression
+func parseWatch(text string) (*Watch, error) {
+	p := &watchParser{text: text}
+	expr, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.text) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.text[p.pos:], text)
+	}
+	return &Watch{Text: text, expr: expr}, nil
+}
+
+// Update evaluates the watch and notes whether its value changed since the last update
+func (w *Watch) Update(cpu *chip8.CPU) {
+	w.previous, w.value = w.value, w.expr(cpu)
+	w.changed = w.evaluated && w.value != w.previous
+	w.evaluated = true
+}
+
+type watchParser struct {
+	text string
+	pos  int
+}
+
+func (p *watchParser) skipSpace() {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// sum := term (("+" | "-") term)*
+func (p *watchParser) sum() (watchExpr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.text) || (p.text[p.pos] != '+' && p.text[p.pos] != '-') {
+			return left, nil
+		}
+		op := p.text[p.pos]
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == '+' {
+			left = func(cpu *chip8.CPU) int { return l(cpu) + right(cpu) }
+		} else {
+			left = func(cpu *chip8.CPU) int { return l(cpu) - right(cpu) }
+		}
+	}
+}
+
+// term := number | register | name "[" sum "]" | "(" sum ")"
+func (p *watchParser) term() (watchExpr, error) {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return nil, fmt.Errorf("%q ends too early", p.text)
+	}
+
+	if p.text[p.pos] == '(' {
+		p.pos++
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(')')
+	}
+
+	start := p.pos
+	for p.pos < len(p.text) && (unicode.IsLetter(rune(p.text[p.pos])) || unicode.IsDigit(rune(p.text[p.pos]))) {
+		p.pos++
+	}
+	word := p.text[start:p.pos]
+	if word == "" {
+		return nil, fmt.Errorf("unexpected %q in %q", p.text[p.pos:], p.text)
+	}
+
+	if unicode.IsDigit(rune(word[0])) {
+		n, err := strconv.ParseInt(word, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", word)
+		}
+		return func(*chip8.CPU) int { return int(n) }, nil
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.text) && p.text[p.pos] == '[' {
+		p.pos++
+		index, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+		switch strings.ToUpper(word) {
+		case "V":
+			return func(cpu *chip8.CPU) int { return int(cpu.V[index(cpu)&0xF]) }, nil
+		case "M", "MEMORY":
+			return func(cpu *chip8.CPU) int {
+				addr := index(cpu) % len(cpu.Memory)
+				if addr < 0 {
+					addr += len(cpu.Memory)
+				}
+				return int(cpu.Memory[addr])
+			}, nil
+		}
+		return nil, fmt.Errorf("unknown array %q, want V or Memory", word)
+	}
+
+	switch upper := strings.ToUpper(word); upper {
+	case "I":
+		return func(cpu *chip8.CPU) int { return int(cpu.I) }, nil
+	case "PC":
+		return func(cpu *chip8.CPU) int { return int(cpu.Pc) }, nil
+	case "SP":
+		return func(cpu *chip8.CPU) int { return int(cpu.Stack_pointer) }, nil
+	case "DT":
+		return func(cpu *chip8.CPU) int { return int(cpu.DelayTimer()) }, nil
+	case "ST":
+		return func(cpu *chip8.CPU) int { return int(cpu.SoundTimer()) }, nil
+	default:
+		if len(upper) == 2 && upper[0] == 'V' {
+			if x, err := strconv.ParseUint(upper[1:], 16, 4); err == nil {
+				return func(cpu *chip8.CPU) int { return int(cpu.V[x]) }, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown name %q", word)
+}
+
+func (p *watchParser) expect(c byte) error {
+	p.skipSpace()
+	if p.pos >= len(p.text) || p.text[p.pos] != c {
+		return fmt.Errorf("missing %q in %q", c, p.text)
+	}
+	p.pos++
+	return nil
+}
+
+func watchesPath(hash string) (string, error) {
+	dir, err := stateDir(hash)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "watches.txt"), nil
+}
+
+// readWatches returns the watches kept for a ROM, one expression per line
+func readWatches(hash string) ([]*Watch, error) {
+	path, err := watchesPath(hash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var watches []*Watch
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		w, err := parseWatch(line)
+		if err != nil {
+			return watches, fmt.Errorf("%s: %w", path, err)
+		}
+		watches = append(watches, w)
+	}
+	return watches, nil
+}
+
+func writeWatches(hash string, watches []*Watch) error {
+	path, err := watchesPath(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, w := range watches {
+		b.WriteString(w.Text + "\n")
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
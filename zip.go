@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	sdl "github.com/veandco/go-sdl2/sdl"
+)
+
+// ROMs in ZIP archives are named after their archive, like games.zip/PONG.ch8,
+// and games.zip alone stands for the first ROM in it. ROMs are the members
+// with this extension.
+const romExtension = ".ch8"
+
+// splitZip splits the name of a ROM in a ZIP archive into the archive and
+// the member, "" for the first ROM. ok is false if the name isn't in an archive.
+func splitZip(name string) (archive, member string, ok bool) {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".zip") {
+		return name, "", true
+	}
+	// The member is separated by a slash, or by a backslash once the path
+	// went through filepath on Windows
+	for _, sep := range []string{".zip/", ".zip" + string(filepath.Separator)} {
+		if i := strings.Index(lower, sep); i != -1 {
+			return name[:i+len(".zip")], filepath.ToSlash(name[i+len(sep):]), true
+		}
+	}
+	return "", "", false
+}
+
+// zipRoms lists the ROMs in a ZIP archive, in alphabetical order
+func zipRoms(archive string) ([]string, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var roms []string
+	for _, f := range r.File {
+		if !f.FileInfo().IsDir() && strings.EqualFold(path.Ext(f.Name), romExtension) {
+			roms = append(roms, f.Name)
+		}
+	}
+	sort.Strings(roms)
+	return roms, nil
+}
+
+// readZipRom reads a member of a ZIP archive, or its first ROM if member is ""
+func readZipRom(archive, member string) ([]byte, error) {
+	if member == "" {
+		roms, err := zipRoms(archive)
+		if err != nil {
+			return nil, err
+		}
+		if len(roms) == 0 {
+			return nil, fmt.Errorf("%s: no %s files in the archive", archive, romExtension)
+		}
+		member = roms[0]
+	}
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := r.Open(member)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", archive, err)
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// chooseZipRom lets the player pick one of the ROMs of an archive and returns
+// its name, or "" if the player went back. An archive with a single ROM
+// doesn't ask.
+func chooseZipRom(window *sdl.Window, renderer *sdl.Renderer, texts *TextCache, archive string) string {
+	roms, err := zipRoms(archive)
+	if err != nil {
+		showError(window, "Failed to read the archive", err)
+		return ""
+	}
+	switch len(roms) {
+	case 0:
+		showError(window, "Failed to read the archive", fmt.Errorf("no %s files in %s", romExtension, archive))
+		return ""
+	case 1:
+		return archive + "/" + roms[0]
+	}
+
+	renderer.SetLogicalSize(winWidth, winHeight)
+	lineHeight := int32(fontSize) + 8
+	rows := int((winHeight - 32 - 4*lineHeight) / lineHeight)
+	selected := 0
+
+	draw := func(text string, color sdl.Color, x, y int32) {
+		if _, _, err := texts.Draw(text, color, x, y); err != nil {
+			slog.Error("Failed to render text", "err", err)
+		}
+	}
+
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				requestQuit()
+				return ""
+			case *sdl.KeyboardEvent:
+				if t.Type != sdl.KEYDOWN {
+					break
+				}
+				switch t.Keysym.Sym {
+				case sdl.K_ESCAPE:
+					return ""
+				case sdl.K_UP:
+					if selected > 0 {
+						selected--
+					}
+				case sdl.K_DOWN:
+					if selected < len(roms)-1 {
+						selected++
+					}
+				case sdl.K_RETURN, sdl.K_KP_ENTER:
+					return archive + "/" + roms[selected]
+				}
+			}
+		}
+
+		renderer.SetDrawColor(0, 0, 0, 255)
+		renderer.Clear()
+
+		draw(filepath.Base(archive), yellow, 32, 32)
+		first := max(selected-rows+1, 0)
+		y := 32 + 2*lineHeight
+		for i := first; i < len(roms) && i < first+rows; i++ {
+			if i == selected {
+				renderer.SetDrawColor(64, 64, 64, 255)
+				renderer.FillRect(&sdl.Rect{X: 24, Y: y - 4, W: winWidth - 48, H: lineHeight})
+			}
+			draw(roms[i], white, 32, y)
+			y += lineHeight
+		}
+		draw(tr("<Up>/<Down> to choose, <Enter> to play, <Escape> to go back"), white, 32, winHeight-lineHeight-8)
+
+		renderer.Present()
+		texts.Sweep()
+		sdl.Delay(16)
+	}
+}